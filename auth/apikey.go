@@ -0,0 +1,45 @@
+// Author: Vcentor
+// Date: 2026/10/19 3:18 下午
+// desc: 配置文件中的静态API Key鉴权
+
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+)
+
+// APIKey 静态API Key配置
+type APIKey struct {
+	Key   string   `toml:"key"`
+	ID    string   `toml:"id"`
+	Roles []string `toml:"roles"`
+}
+
+// APIKeyAuthenticator 静态API Key鉴权
+type APIKeyAuthenticator struct {
+	keys []APIKey
+}
+
+// NewAPIKeyAuthenticator 实例化API Key鉴权
+func NewAPIKeyAuthenticator(keys []APIKey) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{keys: keys}
+}
+
+// Name 鉴权方式名称
+func (a *APIKeyAuthenticator) Name() string {
+	return "api_key"
+}
+
+// Authenticate 校验API Key
+func (a *APIKeyAuthenticator) Authenticate(_ context.Context, credential string) (*Principal, error) {
+	for _, k := range a.keys {
+		if k.Key != "" && subtle.ConstantTimeCompare([]byte(k.Key), []byte(credential)) == 1 {
+			return &Principal{
+				ID:    k.ID,
+				Roles: append([]string(nil), k.Roles...),
+			}, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
@@ -0,0 +1,72 @@
+// Author: Vcentor
+// Date: 2026/10/19 3:10 下午
+// desc: 鉴权接口定义
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoCredential = errors.New("auth: no credential")
+	ErrInvalidToken = errors.New("auth: invalid token")
+	ErrTokenExpired = errors.New("auth: token expired")
+)
+
+// Principal 鉴权通过后的身份信息
+type Principal struct {
+	ID        string    `json:"id"`
+	Roles     []string  `json:"roles"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// HasRole 是否拥有角色
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator 鉴权接口
+type Authenticator interface {
+	// Name 鉴权方式名称
+	Name() string
+	// Authenticate 校验凭证，凭证不属于该鉴权方式时返回ErrInvalidToken
+	Authenticate(ctx context.Context, credential string) (*Principal, error)
+}
+
+// Chain 依次尝试多种鉴权方式
+type Chain []Authenticator
+
+// Name 鉴权方式名称
+func (c Chain) Name() string {
+	return "chain"
+}
+
+// Authenticate 任一鉴权方式通过即返回，过期错误优先返回
+func (c Chain) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	if credential == "" {
+		return nil, ErrNoCredential
+	}
+	var lastErr = ErrInvalidToken
+	for _, a := range c {
+		p, err := a.Authenticate(ctx, credential)
+		if err == nil {
+			if p.Method == "" {
+				p.Method = a.Name()
+			}
+			return p, nil
+		}
+		if err != ErrInvalidToken {
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,104 @@
+// Author: Vcentor
+// Date: 2026/10/19 4:30 下午
+// desc: 鉴权链和授权规则测试
+
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+// signJWT 生成HS256签名的JWT
+func signJWT(secret, claims string) string {
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims))
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(signed))
+	return signed + "." + enc.EncodeToString(h.Sum(nil))
+}
+
+func TestChain_Authenticate(t *testing.T) {
+	hmacAuth := NewHMACAuthenticator("hmac-secret")
+	validHMAC, _ := hmacAuth.Sign(HMACClaims{Subject: "device-1", Roles: []string{"device"}})
+	expiredHMAC, _ := hmacAuth.Sign(HMACClaims{Subject: "device-1", Expire: time.Now().Add(-time.Minute).Unix()})
+	jwtAuth, err := NewJWTAuthenticator(JWTOption{Secret: "jwt-secret", Issuer: "gateway"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := Chain{
+		NewAPIKeyAuthenticator([]APIKey{{Key: "k1", ID: "ops", Roles: []string{"admin"}}}),
+		hmacAuth,
+		jwtAuth,
+	}
+
+	tests := []struct {
+		name       string
+		credential string
+		wantID     string
+		wantRole   string
+		wantMethod string
+		wantErr    error
+	}{
+		{name: "api-key", credential: "k1", wantID: "ops", wantRole: "admin", wantMethod: "api_key"},
+		{name: "hmac", credential: validHMAC, wantID: "device-1", wantRole: "device", wantMethod: "hmac"},
+		{name: "hmac-expired", credential: expiredHMAC, wantErr: ErrTokenExpired},
+		{
+			name:       "jwt",
+			credential: signJWT("jwt-secret", `{"sub":"u1","iss":"gateway","roles":["user"]}`),
+			wantID:     "u1", wantRole: "user", wantMethod: "jwt",
+		},
+		{name: "jwt-bad-issuer", credential: signJWT("jwt-secret", `{"sub":"u1","iss":"other"}`), wantErr: ErrInvalidToken},
+		{name: "jwt-bad-secret", credential: signJWT("wrong", `{"sub":"u1","iss":"gateway"}`), wantErr: ErrInvalidToken},
+		{name: "jwt-expired", credential: signJWT("jwt-secret", `{"sub":"u1","iss":"gateway","exp":1}`), wantErr: ErrTokenExpired},
+		{name: "empty", credential: "", wantErr: ErrNoCredential},
+		{name: "unknown", credential: "k2", wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := chain.Authenticate(context.Background(), tt.credential)
+			if err != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.ID != tt.wantID || !p.HasRole(tt.wantRole) || p.Method != tt.wantMethod {
+				t.Errorf("Authenticate() got = %+v", p)
+			}
+		})
+	}
+}
+
+func TestPolicy_Allow(t *testing.T) {
+	p := &Policy{Rules: map[string][]string{
+		"KICK_SESSION": {"admin"},
+		"PROCESS_PCM":  {"device"},
+	}}
+	admin := &Principal{ID: "ops", Roles: []string{"admin"}}
+	device := &Principal{ID: "d1", Roles: []string{"device"}}
+
+	tests := []struct {
+		name      string
+		action    string
+		principal *Principal
+		want      bool
+	}{
+		{name: "admin-kick", action: "KICK_SESSION", principal: admin, want: true},
+		{name: "device-kick", action: "KICK_SESSION", principal: device, want: false},
+		{name: "device-pcm", action: "PROCESS_PCM", principal: device, want: true},
+		{name: "anonymous-pcm", action: "PROCESS_PCM", principal: nil, want: false},
+		{name: "no-rule", action: "HEARTBEAT", principal: nil, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Allow(tt.action, tt.principal); got != tt.want {
+				t.Errorf("Allow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
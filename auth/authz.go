@@ -0,0 +1,88 @@
+// Author: Vcentor
+// Date: 2026/10/19 5:40 下午
+// desc: 基于角色的action授权规则
+
+package auth
+
+import (
+	"sync/atomic"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Policy 授权规则，action -> 允许调用的角色
+// 未配置规则的action不做限制
+type Policy struct {
+	Rules map[string][]string `toml:"rules"`
+}
+
+// LoadPolicy 读取授权规则文件
+func LoadPolicy(file string) (*Policy, error) {
+	var p Policy
+	if _, err := toml.DecodeFile(file, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Allow 是否允许调用action，配置了规则的action需要拥有任一角色
+func (p *Policy) Allow(action string, principal *Principal) bool {
+	roles, ok := p.Rules[action]
+	if !ok {
+		return true
+	}
+	if principal == nil {
+		return false
+	}
+	for _, role := range roles {
+		if principal.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer 授权器，规则可以在运行时替换
+type Authorizer struct {
+	file   string
+	policy atomic.Value
+}
+
+// NewAuthorizer 读取规则文件并实例化授权器
+func NewAuthorizer(file string) (*Authorizer, error) {
+	a := &Authorizer{file: file}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload 重新读取规则文件，读取失败时保留原有规则
+func (a *Authorizer) Reload() error {
+	p, err := LoadPolicy(a.file)
+	if err != nil {
+		return err
+	}
+	a.policy.Store(p)
+	return nil
+}
+
+// Store 替换为已加载的规则
+func (a *Authorizer) Store(p *Policy) {
+	a.policy.Store(p)
+}
+
+// File 规则文件路径
+func (a *Authorizer) File() string {
+	return a.file
+}
+
+// Policy 当前生效的规则
+func (a *Authorizer) Policy() *Policy {
+	return a.policy.Load().(*Policy)
+}
+
+// Allow 是否允许调用action
+func (a *Authorizer) Allow(action string, principal *Principal) bool {
+	return a.Policy().Allow(action, principal)
+}
@@ -0,0 +1,79 @@
+// Author: Vcentor
+// Date: 2026/10/19 4:02 下午
+// desc: 鉴权配置
+
+package auth
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Config 鉴权配置选项
+type Config struct {
+	Enable        bool      `toml:"enable"`
+	Action        string    `toml:"action" default:"AUTH"`       // 鉴权action
+	QueryParam    string    `toml:"query_param" default:"token"` // websocket握手时携带token的参数名
+	PublicActions []string  `toml:"public_actions"`              // 无需鉴权即可调用的action
+	APIKeys       []APIKey  `toml:"api_keys"`
+	HMACSecret    string    `toml:"hmac_secret"`
+	JWT           JWTOption `toml:"jwt"`
+}
+
+// New 根据配置生成鉴权链，依次尝试API Key、HMAC token和JWT
+func New(conf Config) (Authenticator, error) {
+	var chain Chain
+	if len(conf.APIKeys) > 0 {
+		chain = append(chain, NewAPIKeyAuthenticator(conf.APIKeys))
+	}
+	if conf.HMACSecret != "" {
+		chain = append(chain, NewHMACAuthenticator(conf.HMACSecret))
+	}
+	if conf.JWT.Secret != "" || conf.JWT.PublicKeyFile != "" {
+		a, err := NewJWTAuthenticator(conf.JWT)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, a)
+	}
+	return chain, nil
+}
+
+// Reloadable 鉴权器，凭证配置可以在运行时替换
+type Reloadable struct {
+	authenticator atomic.Value
+}
+
+// NewReloadable 根据配置实例化可替换的鉴权器
+func NewReloadable(conf Config) (*Reloadable, error) {
+	r := &Reloadable{}
+	if err := r.Reload(conf); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 根据新配置生成鉴权链，配置非法时保留原有鉴权链
+func (r *Reloadable) Reload(conf Config) error {
+	a, err := New(conf)
+	if err != nil {
+		return err
+	}
+	r.Store(a)
+	return nil
+}
+
+// Store 替换鉴权链
+func (r *Reloadable) Store(a Authenticator) {
+	r.authenticator.Store(&a)
+}
+
+// Name 鉴权方式名称
+func (r *Reloadable) Name() string {
+	return (*r.authenticator.Load().(*Authenticator)).Name()
+}
+
+// Authenticate 使用当前的鉴权链校验凭证
+func (r *Reloadable) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	return (*r.authenticator.Load().(*Authenticator)).Authenticate(ctx, credential)
+}
@@ -0,0 +1,228 @@
+// Author: Vcentor
+// Date: 2026/10/19 3:45 下午
+// desc: JWT鉴权，使用本地密钥校验签名，支持HS256/384/512和RS256/384/512
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// JWTOption JWT鉴权配置
+type JWTOption struct {
+	Secret        string `toml:"secret"`                      // HS系列算法密钥
+	PublicKeyFile string `toml:"public_key_file"`             // RS系列算法PEM公钥文件
+	Issuer        string `toml:"issuer"`                      // 非空时校验iss
+	Audience      string `toml:"audience"`                    // 非空时校验aud
+	RolesClaim    string `toml:"roles_claim" default:"roles"` // 角色字段名
+	Leeway        int    `toml:"leeway" validate:"min=0"`     // 校验exp和nbf时允许的时钟误差，单位s
+}
+
+// JWTAuthenticator JWT鉴权
+type JWTAuthenticator struct {
+	opt       JWTOption
+	secret    []byte
+	publicKey *rsa.PublicKey
+}
+
+// jwtHeader JWT头
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+// NewJWTAuthenticator 实例化JWT鉴权，读取公钥文件
+func NewJWTAuthenticator(opt JWTOption) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{
+		opt:    opt,
+		secret: []byte(opt.Secret),
+	}
+	if a.opt.RolesClaim == "" {
+		a.opt.RolesClaim = "roles"
+	}
+	if opt.PublicKeyFile != "" {
+		b, err := ioutil.ReadFile(opt.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if a.publicKey, err = parseRSAPublicKey(b); err != nil {
+			return nil, err
+		}
+	}
+	if len(a.secret) == 0 && a.publicKey == nil {
+		return nil, errors.New("auth: jwt requires secret or public_key_file")
+	}
+	return a, nil
+}
+
+// parseRSAPublicKey 解析PEM格式的RSA公钥或证书
+func parseRSAPublicKey(b []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("auth: invalid pem public key")
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+		return nil, errors.New("auth: certificate is not rsa")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("auth: public key is not rsa")
+	}
+	return key, nil
+}
+
+// Name 鉴权方式名称
+func (a *JWTAuthenticator) Name() string {
+	return "jwt"
+}
+
+// Authenticate 校验JWT签名及标准声明
+func (a *JWTAuthenticator) Authenticate(_ context.Context, credential string) (*Principal, error) {
+	parts := strings.Split(credential, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := a.verify(header.Alg, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	leeway := time.Duration(a.opt.Leeway) * time.Second
+	p := &Principal{ID: sub, Roles: claimStrings(claims[a.opt.RolesClaim])}
+	if exp, ok := claims["exp"].(float64); ok {
+		p.ExpiresAt = time.Unix(int64(exp), 0)
+		if now.After(p.ExpiresAt.Add(leeway)) {
+			return nil, ErrTokenExpired
+		}
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, ErrInvalidToken
+	}
+	if a.opt.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.opt.Issuer {
+			return nil, ErrInvalidToken
+		}
+	}
+	if a.opt.Audience != "" && !containsString(claimStrings(claims["aud"]), a.opt.Audience) {
+		return nil, ErrInvalidToken
+	}
+	return p, nil
+}
+
+// verify 校验签名
+func (a *JWTAuthenticator) verify(alg, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "HS256", "RS256":
+		hash = crypto.SHA256
+	case "HS384", "RS384":
+		hash = crypto.SHA384
+	case "HS512", "RS512":
+		hash = crypto.SHA512
+	default:
+		return ErrInvalidToken
+	}
+
+	if strings.HasPrefix(alg, "HS") {
+		if len(a.secret) == 0 {
+			return ErrInvalidToken
+		}
+		var h = hmac.New(sha256.New, a.secret)
+		switch hash {
+		case crypto.SHA384:
+			h = hmac.New(sha512.New384, a.secret)
+		case crypto.SHA512:
+			h = hmac.New(sha512.New, a.secret)
+		}
+		h.Write([]byte(signed))
+		if !hmac.Equal(sig, h.Sum(nil)) {
+			return ErrInvalidToken
+		}
+		return nil
+	}
+
+	if a.publicKey == nil {
+		return ErrInvalidToken
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	if err := rsa.VerifyPKCS1v15(a.publicKey, hash, h.Sum(nil), sig); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// decodeSegment 解码JWT片段
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// claimStrings 声明值转换为字符串数组，支持数组和空格分隔的字符串
+func claimStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return strings.Fields(val)
+	case []interface{}:
+		var res = make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// containsString 是否包含字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+// Author: Vcentor
+// Date: 2026/10/27 11:20 上午
+// desc: bench命令，对运行中的服务或进程内启动的网关压测，输出耗时分位数、错误码和断连数
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"socketserver/env"
+	"socketserver/library/bench"
+	"time"
+)
+
+// benchFlags bench命令参数
+type benchFlags struct {
+	transport string
+	ws        string
+	tcp       string
+	conns     int
+	rate      float64
+	duration  time.Duration
+	requests  int
+	timeout   time.Duration
+	script    string
+	action    string
+	body      string
+	json      bool
+	dial      dialFlags
+}
+
+// register 注册bench命令参数
+func (f *benchFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.transport, "transport", bench.TRANSPORT_WS, "bench: 传输协议,ws或tcp")
+	fs.StringVar(&f.ws, "ws", "", "bench: websocket地址,与-tcp都为空时在进程内启动网关")
+	fs.StringVar(&f.tcp, "tcp", "", "bench: tcp地址,消息格式取自server.toml")
+	fs.IntVar(&f.conns, "conns", 10, "bench: 并发连接数")
+	fs.Float64Var(&f.rate, "rate", 0, "bench: 所有连接合计每秒发送的消息数,0为不限速")
+	fs.DurationVar(&f.duration, "duration", 10*time.Second, "bench: 发送时长,0为只按-requests结束")
+	fs.IntVar(&f.requests, "requests", 0, "bench: 每个连接发送的消息数,0为不限制")
+	fs.DurationVar(&f.timeout, "timeout", bench.DEFAULT_TIMEOUT, "bench: 发送结束后等待响应的最长时间")
+	fs.StringVar(&f.script, "script", "", "bench: toml格式的压测脚本,为空时循环发送-action")
+	fs.StringVar(&f.action, "action", "", "bench: 未指定脚本时发送的action")
+	fs.StringVar(&f.body, "body", "", "bench: 未指定脚本时的请求体json")
+	fs.BoolVar(&f.json, "json", false, "bench: 以json格式输出结果")
+	f.dial.register(fs, "bench")
+}
+
+// runBench 执行压测并输出结果
+func runBench(ctx context.Context, paths env.Paths, f benchFlags) error {
+	var script *bench.Script
+	switch {
+	case f.script != "":
+		s, err := bench.LoadScript(f.script)
+		if err != nil {
+			return err
+		}
+		script = s
+	case f.action != "":
+		script = &bench.Script{Steps: []bench.Step{{Action: f.action, Body: f.body}}}
+	default:
+		return errors.New("bench requires -script or -action")
+	}
+
+	t, err := resolveTarget(ctx, paths, f.ws, f.tcp)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+	addr := t.ws
+	if f.transport == bench.TRANSPORT_TCP {
+		addr = t.tcp
+	}
+	if addr == "" {
+		return errors.New("no " + f.transport + " address to bench")
+	}
+	dial, err := t.dialOption(f.transport, f.dial)
+	if err != nil {
+		return err
+	}
+
+	summary, err := bench.Run(ctx, bench.Options{
+		Dial:     dial,
+		Conns:    f.conns,
+		Rate:     f.rate,
+		Duration: f.duration,
+		Requests: f.requests,
+		Timeout:  f.timeout,
+		Script:   script,
+	})
+	if err != nil {
+		return err
+	}
+	if f.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summary)
+	}
+	summary.Report(os.Stdout)
+	return nil
+}
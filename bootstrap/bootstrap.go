@@ -5,32 +5,107 @@ package bootstrap
 
 import (
 	"context"
+	"socketserver/env"
 	"socketserver/gate"
+	"socketserver/library/config"
+	"socketserver/library/trace"
 	"socketserver/library/wslog"
 	"socketserver/logic"
+	"socketserver/logic/conf"
 	"socketserver/processer"
 )
 
 // Bootstrap 程序启动入口
 type Bootstrap struct {
-	ctx context.Context
+	ctx  context.Context
+	gate *gate.Gate
 }
 
-// NewBootstrap 初始化Bootstrap对象
-func NewBootstrap(ctx context.Context) Bootstrap {
+// NewBootstrap 初始化Bootstrap对象，设置配置、日志和数据目录
+func NewBootstrap(ctx context.Context, paths env.Paths) Bootstrap {
+	env.Setup(paths)
 	return Bootstrap{ctx: ctx}
 }
 
-// Init 初始化一些配置选项
-func (b Bootstrap) Init() Bootstrap {
+// Init 初始化日志、网关和业务路由
+func (b Bootstrap) Init() (Bootstrap, error) {
+	return b.init(nil)
+}
+
+// InitLocal 初始化只监听本机随机端口的网关，用于回放等本地工具，业务配置与线上一致
+// 不开启TLS、指标、健康检查、管理接口和抓包，不支持热加载
+func (b Bootstrap) InitLocal() (Bootstrap, error) {
+	return b.init(func(conf *gate.Config) {
+		if conf.WSConf.ListenAddr != "" {
+			conf.WSConf.ListenAddr = "127.0.0.1:0"
+		}
+		if conf.TCPConf.ListenAddr != "" {
+			conf.TCPConf.ListenAddr = "127.0.0.1:0"
+		}
+		conf.WSConf.CerFile, conf.WSConf.KeyFile = "", ""
+		conf.ProxyConf = gate.ProxyConfOption{HeaderTimeout: conf.ProxyConf.HeaderTimeout}
+		conf.MetricsConf.Enable = false
+		conf.HealthConf.Enable = false
+		conf.AdminConf.Enable = false
+		conf.CaptureConf.Enable = false
+	})
+}
+
+// init local不为空时修改配置后使用，不读取配置文件
+func (b Bootstrap) init(local func(conf *gate.Config)) (Bootstrap, error) {
+	// 日志需要在网关之前初始化，网关和连接使用全局Logger
+	file, err := env.ServerConfFile()
+	if err != nil {
+		return b, err
+	}
+	conf, err := gate.LoadConfig(file)
+	if err != nil {
+		return b, err
+	}
+	if err := wslog.Init(b.ctx, conf.LogConf); err != nil {
+		return b, err
+	}
+	if err := trace.Init(conf.TraceConf); err != nil {
+		return b, err
+	}
 	p := processer.NewJSONProcesser("requestId", "action", "body")
-	wslog.Init(b.ctx)
-	gate.Init(b.ctx, p)
-	logic.Init(p)
-	return b
+	opts := []gate.Option{gate.WithProcesser(p)}
+	if local != nil {
+		local(conf)
+		opts = append(opts, gate.WithConfig(conf))
+	}
+	g, err := gate.New(opts...)
+	if err != nil {
+		return b, err
+	}
+	if err := logic.Init(g, p); err != nil {
+		return b, err
+	}
+	b.gate = g
+	return b, nil
+}
+
+// Gate 初始化后的网关
+func (b Bootstrap) Gate() *gate.Gate {
+	return b.gate
+}
+
+// CheckConfig 校验所有配置文件，不启动服务
+func (b Bootstrap) CheckConfig() error {
+	var errs config.Errors
+	if err := gate.CheckConf(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := conf.Check(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
 
-// Run 运行服务
-func (b Bootstrap) Run() {
-	gate.Gateway.Run()
+// Run 运行服务，直到收到退出信号
+func (b Bootstrap) Run() error {
+	return b.gate.Run(b.ctx)
 }
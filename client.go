@@ -0,0 +1,327 @@
+// Author: Vcentor
+// Date: 2026/10/27 2:00 下午
+// desc: client命令，交互式连接websocket或tcp服务，发送json请求或二进制文件并格式化输出收到的消息
+// 输入历史保存到文件，下次启动时可以用!n重发
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"socketserver/env"
+	"socketserver/library/capture"
+	"socketserver/network"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 交互命令
+const clientHelp = `输入:
+  ACTION [body]   发送请求，requestId自动生成，body为json，如 PING {"a":1}
+  {...}           原样发送一行json
+  :file PATH      以二进制消息发送文件内容
+  :history        列出输入历史
+  !N              重发第N条历史
+  :help           显示帮助
+  :quit           退出
+`
+
+// 输出时二进制消息最多展示的字节数
+const clientMaxDump = 256
+
+// clientFlags client命令参数
+type clientFlags struct {
+	transport string
+	ws        string
+	tcp       string
+	lenMsgLen int
+	minMsgLen uint
+	maxMsgLen uint
+	endian    string
+	history   string
+	raw       bool
+	dial      dialFlags
+}
+
+// register 注册client命令参数
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	home, _ := os.UserHomeDir()
+	fs.StringVar(&f.transport, "transport", "ws", "client: 传输协议,ws或tcp")
+	fs.StringVar(&f.ws, "ws", "", "client: websocket地址,与-tcp都为空时在进程内启动网关")
+	fs.StringVar(&f.tcp, "tcp", "", "client: tcp地址")
+	fs.IntVar(&f.lenMsgLen, "len-msg-len", 0, "client: tcp长度字段字节数,1/2/4,0为取自server.toml")
+	fs.UintVar(&f.minMsgLen, "min-msg-len", 0, "client: tcp最小数据长度,0为取自server.toml")
+	fs.UintVar(&f.maxMsgLen, "max-msg-len", 0, "client: tcp最大数据长度,0为取自server.toml")
+	fs.StringVar(&f.endian, "endian", "", "client: tcp字节序,big或little,为空时取自server.toml")
+	fs.StringVar(&f.history, "history", filepath.Join(home, ".socketserver_history"), "client: 输入历史文件,为空时不保存")
+	fs.BoolVar(&f.raw, "raw", false, "client: 原样输出收到的json,不格式化")
+	f.dial.register(fs, "client")
+}
+
+// runClient 连接服务并进入交互
+func runClient(ctx context.Context, paths env.Paths, f clientFlags) error {
+	t, err := resolveTarget(ctx, paths, f.ws, f.tcp)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+
+	var addr string
+	switch f.transport {
+	case network.TRANSPORT_WS:
+		addr = t.ws
+	case network.TRANSPORT_TCP:
+		addr = t.tcp
+		if err := f.framing(t); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported transport %q", f.transport)
+	}
+	if addr == "" {
+		return errors.New("no " + f.transport + " address to connect")
+	}
+	opt, err := t.dialOption(f.transport, f.dial)
+	if err != nil {
+		return err
+	}
+	conn, err := network.Dial(ctx, opt)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	cli := &client{
+		conn:    conn,
+		out:     os.Stdout,
+		raw:     f.raw,
+		history: loadHistory(f.history),
+		file:    f.history,
+	}
+	fmt.Fprintf(cli.out, "connected to %s %s, :help for usage\n", f.transport, addr)
+	return cli.run(os.Stdin)
+}
+
+// framing 用参数覆盖server.toml中的tcp消息格式
+func (f clientFlags) framing(t *target) error {
+	if f.lenMsgLen != 0 {
+		t.framing.LenMsgLen = f.lenMsgLen
+	}
+	if f.minMsgLen != 0 {
+		t.framing.MinMsgLen = uint32(f.minMsgLen)
+	}
+	if f.maxMsgLen != 0 {
+		t.framing.MaxMsgLen = uint32(f.maxMsgLen)
+	}
+	switch f.endian {
+	case "":
+	case "big":
+		t.framing.LittleEndian = false
+	case "little":
+		t.framing.LittleEndian = true
+	default:
+		return fmt.Errorf("unsupported endian %q", f.endian)
+	}
+	return t.framing.Validate()
+}
+
+// client 交互会话
+type client struct {
+	conn    network.ClientConn
+	mutex   sync.Mutex // 保护输出，收到的消息和命令输出不交错
+	out     io.Writer
+	raw     bool
+	seq     int
+	history []string
+	file    string
+}
+
+// run 读取输入直到:quit、输入结束或连接断开
+func (c *client) run(in io.Reader) error {
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			data, binary, err := c.conn.ReadMsg()
+			if err != nil {
+				closed <- err
+				return
+			}
+			// tcp没有消息类型，按内容判断
+			if !binary {
+				binary = capture.MessageType(data) == capture.TYPE_BINARY
+			}
+			c.print(c.format(data, binary))
+		}
+	}()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	for {
+		select {
+		case err := <-closed:
+			c.print("connection closed: " + err.Error())
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			quit, err := c.exec(strings.TrimSpace(line))
+			if err != nil {
+				c.print("error: " + err.Error())
+			}
+			if quit {
+				return nil
+			}
+		}
+	}
+}
+
+// exec 执行一行输入，返回是否退出
+func (c *client) exec(line string) (bool, error) {
+	switch {
+	case line == "":
+		return false, nil
+	case line == ":quit" || line == ":q":
+		return true, nil
+	case line == ":help":
+		c.print(strings.TrimRight(clientHelp, "\n"))
+		return false, nil
+	case line == ":history":
+		var buf strings.Builder
+		for i, h := range c.history {
+			fmt.Fprintf(&buf, "%4d  %s\n", i+1, h)
+		}
+		c.print(strings.TrimRight(buf.String(), "\n"))
+		return false, nil
+	case strings.HasPrefix(line, "!"):
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 1 || n > len(c.history) {
+			return false, fmt.Errorf("no history entry %q", line[1:])
+		}
+		line = c.history[n-1]
+		c.print("> " + line)
+		return c.exec(line)
+	}
+
+	data, binary, err := c.message(line)
+	if err != nil {
+		return false, err
+	}
+	c.remember(line)
+	return false, c.conn.WriteMsg(data, binary)
+}
+
+// message 把输入转换为要发送的消息
+func (c *client) message(line string) ([]byte, bool, error) {
+	if strings.HasPrefix(line, ":file ") {
+		data, err := ioutil.ReadFile(strings.TrimSpace(strings.TrimPrefix(line, ":file ")))
+		return data, true, err
+	}
+	if strings.HasPrefix(line, ":") {
+		return nil, false, fmt.Errorf("unknown command %q, :help for usage", line)
+	}
+	if strings.HasPrefix(line, "{") {
+		if !json.Valid([]byte(line)) {
+			return nil, false, errors.New("invalid json")
+		}
+		return []byte(line), false, nil
+	}
+
+	action, body := line, "{}"
+	if i := strings.IndexAny(line, " \t"); i > 0 {
+		action, body = line[:i], strings.TrimSpace(line[i:])
+	}
+	if !json.Valid([]byte(body)) {
+		return nil, false, errors.New("body is not valid json")
+	}
+	c.seq++
+	data, err := json.Marshal(map[string]interface{}{
+		"requestId": "cli-" + strconv.Itoa(c.seq),
+		"action":    action,
+		"body":      json.RawMessage(body),
+	})
+	return data, false, err
+}
+
+// remember 记录输入历史并追加到历史文件
+func (c *client) remember(line string) {
+	c.history = append(c.history, line)
+	if c.file == "" {
+		return
+	}
+	f, err := os.OpenFile(c.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = fmt.Fprintln(f, line)
+}
+
+// format 格式化收到的消息，json缩进输出，二进制输出十六进制
+func (c *client) format(data []byte, binary bool) string {
+	if !binary && json.Valid(data) {
+		if c.raw {
+			return "< " + string(data)
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err == nil {
+			return "< " + buf.String()
+		}
+	}
+	if !binary {
+		return "< " + string(data)
+	}
+	dump := data
+	if len(dump) > clientMaxDump {
+		dump = dump[:clientMaxDump]
+	}
+	s := fmt.Sprintf("< binary %d bytes\n%s", len(data), strings.TrimRight(hex.Dump(dump), "\n"))
+	if len(data) > clientMaxDump {
+		s += "\n..."
+	}
+	return s
+}
+
+// print 输出一段内容
+func (c *client) print(s string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fmt.Fprintln(c.out, s)
+}
+
+// loadHistory 读取历史文件，不存在时返回空
+func loadHistory(file string) []string {
+	if file == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	var history []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			history = append(history, line)
+		}
+	}
+	return history
+}
@@ -0,0 +1,381 @@
+// Author: Vcentor
+// Date: 2026/10/27 3:50 下午
+// desc: 网关Go客户端，基于WSClient按requestId匹配请求和响应，支持订阅服务端推送和断线重连
+// 重连后用原凭证重新鉴权恢复会话，开启离线消息时服务端会补发断线期间的推送
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"socketserver/network"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 默认参数
+const (
+	DEFAULT_TIMEOUT     = 10 * time.Second
+	DEFAULT_CHAN_CAP    = 100
+	DEFAULT_RETRY       = 3
+	DEFAULT_AUTH_ACTION = "AUTH"
+)
+
+var (
+	ErrClosed       = errors.New("client is closed")
+	ErrDisconnected = errors.New("connection lost")
+)
+
+// Error 服务端返回的错误码
+type Error struct {
+	Action  string
+	Code    int
+	Message string
+}
+
+// Error 实现error接口
+func (e *Error) Error() string {
+	return fmt.Sprintf("action %s failed: code=%d message=%s", e.Action, e.Code, e.Message)
+}
+
+// Options 客户端选项
+type Options struct {
+	Addr         string               // websocket地址，如 ws://127.0.0.1:8989/digitalhuman-ws
+	Dial         network.WSDialOption // 握手请求头、TLS、代理、超时、压缩和状态回调，Addr、ChanCap、Retry以本结构体为准
+	Codec        Codec                // 为空时使用NewJSONCodec
+	Timeout      time.Duration        // ctx没有截止时间时Call的超时时间，默认10s
+	ChanCap      int                  // 读写channel缓冲，默认100
+	Retry        int                  // 每次建连的尝试次数，默认3
+	Reconnect    bool                 // 断线后自动重连
+	Backoff      network.Backoff      // 重连间隔
+	MaxReconnect int                  // 重连次数，<=0时直到成功或Close
+	Token        string               // 建连和重连后通过AUTH action鉴权，为空时不鉴权
+	AuthAction   string               // 鉴权action，默认AUTH
+}
+
+// result 请求结果
+type result struct {
+	msg *Message
+	err error
+}
+
+// subscription 推送订阅
+type subscription struct {
+	action  string
+	handler func(*Message)
+}
+
+// Client 网关客户端，并发安全
+type Client struct {
+	seq     uint64 // 原子操作，放在首位保证32位平台对齐
+	opt     Options
+	ctx     context.Context // Close时取消，结束重连
+	cancel  context.CancelFunc
+	prefix  string
+	mutex   sync.Mutex
+	ws      *network.WSClient
+	closed  bool
+	pending map[string]chan result
+	subs    []*subscription
+}
+
+// Dial 建立连接，设置了Token时鉴权通过后返回
+func Dial(ctx context.Context, opt Options) (*Client, error) {
+	if opt.Addr == "" {
+		return nil, errors.New("addr is required")
+	}
+	if opt.Codec == nil {
+		opt.Codec = NewJSONCodec()
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = DEFAULT_TIMEOUT
+	}
+	if opt.ChanCap <= 0 {
+		opt.ChanCap = DEFAULT_CHAN_CAP
+	}
+	if opt.Retry <= 0 {
+		opt.Retry = DEFAULT_RETRY
+	}
+	if opt.AuthAction == "" {
+		opt.AuthAction = DEFAULT_AUTH_ACTION
+	}
+	c := &Client{
+		opt:     opt,
+		prefix:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		pending: make(map[string]chan result),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	if err := c.connect(ctx); err != nil {
+		c.cancel()
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect 建立连接并启动读协程，设置了Token时鉴权
+func (c *Client) connect(ctx context.Context) error {
+	dial := c.opt.Dial
+	dial.Addr, dial.ChanCap, dial.Retry, dial.AutoReconnect = c.opt.Addr, c.opt.ChanCap, c.opt.Retry, false
+	ws, err := network.DialWS(ctx, dial)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		ws.Close()
+		return ErrClosed
+	}
+	c.ws = ws
+	c.mutex.Unlock()
+	go c.readLoop(ws)
+
+	if c.opt.Token == "" {
+		return nil
+	}
+	if _, err := c.Call(ctx, c.opt.AuthAction, map[string]string{"token": c.opt.Token}); err != nil {
+		// 先摘除连接，避免读协程按断线处理再次触发重连
+		c.mutex.Lock()
+		if c.ws == ws {
+			c.ws = nil
+		}
+		c.mutex.Unlock()
+		ws.Close()
+		return err
+	}
+	return nil
+}
+
+// readLoop 读取消息直到连接断开
+func (c *Client) readLoop(ws *network.WSClient) {
+	for {
+		data, messageType, err := ws.ReadMsg()
+		if err != nil {
+			break
+		}
+		c.dispatch(data, messageType)
+	}
+	c.lost(ws)
+}
+
+// dispatch 响应交给等待的请求，其它消息交给订阅者
+func (c *Client) dispatch(data []byte, messageType int) {
+	msg := &Message{Raw: data, Binary: messageType == websocket.BinaryMessage}
+	if !msg.Binary {
+		if m, err := c.opt.Codec.Decode(data); err == nil {
+			msg = m
+		}
+	}
+
+	c.mutex.Lock()
+	if ch, ok := c.pending[msg.RequestID]; ok && msg.RequestID != "" {
+		delete(c.pending, msg.RequestID)
+		c.mutex.Unlock()
+		ch <- result{msg: msg}
+		return
+	}
+	var handlers []func(*Message)
+	for _, s := range c.subs {
+		if s.action == "" || s.action == msg.Action {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	c.mutex.Unlock()
+	for _, h := range handlers {
+		h(msg)
+	}
+}
+
+// lost 连接断开，未完成的请求返回ErrDisconnected，开启重连时后台重连
+func (c *Client) lost(ws *network.WSClient) {
+	ws.Close()
+	c.mutex.Lock()
+	if c.ws != ws {
+		c.mutex.Unlock()
+		return
+	}
+	c.ws = nil
+	c.failPending(ErrDisconnected)
+	reconnect := c.opt.Reconnect && !c.closed
+	c.mutex.Unlock()
+	if reconnect {
+		go c.reconnect()
+	}
+}
+
+// reconnect 按退避间隔重连直到成功、超过MaxReconnect或Close
+func (c *Client) reconnect() {
+	for i := 0; c.opt.MaxReconnect <= 0 || i < c.opt.MaxReconnect; i++ {
+		timer := time.NewTimer(c.opt.Backoff.Duration(i))
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := c.connect(c.ctx); err == nil || err == ErrClosed {
+			return
+		}
+	}
+}
+
+// failPending 结束所有未完成的请求，调用方需持有锁
+func (c *Client) failPending(err error) {
+	for id, ch := range c.pending {
+		ch <- result{err: err}
+		delete(c.pending, id)
+	}
+}
+
+// nextID 生成请求id
+func (c *Client) nextID() string {
+	return c.prefix + "-" + strconv.FormatUint(atomic.AddUint64(&c.seq, 1), 10)
+}
+
+// conn 当前连接
+func (c *Client) conn() (*network.WSClient, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	if c.ws == nil {
+		return nil, ErrDisconnected
+	}
+	return c.ws, nil
+}
+
+// Call 发送请求并等待requestId相同的响应，错误码不为0时返回*Error
+// ctx没有截止时间时使用Options.Timeout，不能在订阅回调中调用
+func (c *Client) Call(ctx context.Context, action string, body interface{}) (*Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opt.Timeout)
+		defer cancel()
+	}
+	id := c.nextID()
+	data, err := c.opt.Codec.Encode(id, action, body)
+	if err != nil {
+		return nil, err
+	}
+	ws, ch, err := c.register(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.WriteMsg(network.WriteChan{Type: websocket.TextMessage, Message: data}); err != nil {
+		c.removePending(id)
+		return nil, ErrDisconnected
+	}
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return nil, r.err
+		}
+		if r.msg.Code != SUCCESS {
+			return r.msg, &Error{Action: action, Code: r.msg.Code, Message: r.msg.Message}
+		}
+		return r.msg, nil
+	case <-ctx.Done():
+		c.removePending(id)
+		return nil, ctx.Err()
+	}
+}
+
+// register 登记等待响应的请求，与获取当前连接在同一把锁内完成
+// 连接在登记后断开时lost会结束该请求，不会一直等到超时
+func (c *Client) register(id string) (*network.WSClient, chan result, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil, nil, ErrClosed
+	}
+	if c.ws == nil {
+		return nil, nil, ErrDisconnected
+	}
+	ch := make(chan result, 1)
+	c.pending[id] = ch
+	return c.ws, ch, nil
+}
+
+// removePending 放弃等待响应
+func (c *Client) removePending(id string) {
+	c.mutex.Lock()
+	delete(c.pending, id)
+	c.mutex.Unlock()
+}
+
+// Send 发送请求不等待响应
+func (c *Client) Send(action string, body interface{}) error {
+	data, err := c.opt.Codec.Encode(c.nextID(), action, body)
+	if err != nil {
+		return err
+	}
+	return c.write(websocket.TextMessage, data)
+}
+
+// SendBinary 发送二进制消息，如PCM音频
+func (c *Client) SendBinary(data []byte) error {
+	return c.write(websocket.BinaryMessage, data)
+}
+
+// write 写入当前连接
+func (c *Client) write(messageType int, data []byte) error {
+	ws, err := c.conn()
+	if err != nil {
+		return err
+	}
+	if err := ws.WriteMsg(network.WriteChan{Type: messageType, Message: data}); err != nil {
+		return ErrDisconnected
+	}
+	return nil
+}
+
+// Subscribe 订阅服务端推送，action为空时接收所有未匹配请求的消息(含二进制和无法解码的消息)
+// 回调在读协程中同步执行，不能阻塞；重连后订阅仍然有效，返回的函数用于取消订阅
+func (c *Client) Subscribe(action string, handler func(*Message)) func() {
+	s := &subscription{action: action, handler: handler}
+	c.mutex.Lock()
+	c.subs = append(c.subs, s)
+	c.mutex.Unlock()
+	return func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for i, sub := range c.subs {
+			if sub == s {
+				c.subs = append(c.subs[:i:i], c.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Connected 当前是否已连接
+func (c *Client) Connected() bool {
+	_, err := c.conn()
+	return err == nil
+}
+
+// Close 关闭连接并停止重连，未完成的请求返回ErrClosed
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	ws := c.ws
+	c.ws = nil
+	c.failPending(ErrClosed)
+	c.mutex.Unlock()
+	c.cancel()
+	if ws != nil {
+		ws.Close()
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Author: Vcentor
+// Date: 2026/10/27 4:30 下午
+// desc: 客户端请求响应、推送订阅、断线和重连测试
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"socketserver/auth"
+	"socketserver/gate"
+	"socketserver/network"
+	"socketserver/processer"
+	"testing"
+	"time"
+)
+
+// tokenAuth 测试鉴权，token为good时通过
+type tokenAuth struct{}
+
+func (tokenAuth) Name() string { return "test" }
+
+func (tokenAuth) Authenticate(_ context.Context, credential string) (*auth.Principal, error) {
+	if credential != "good" {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Principal{ID: "u1"}, nil
+}
+
+// startGate 启动测试网关，ECHO原样返回body，FAIL返回错误码，NOTIFY先推送再响应，BYE断开连接
+func startGate(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := gate.NewConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := processer.NewJSONProcesser("requestId", "action", "body")
+	g, err := gate.New(gate.WithConfig(conf), gate.WithProcesser(p), gate.WithWSListener(ln),
+		gate.WithAuthenticator(tokenAuth{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(agent interface{}, resp gate.JsonResponse) {
+		b, _ := json.Marshal(resp)
+		_ = agent.(gate.Session).WriteMsg(b)
+	}
+	p.RegisterRouter("ECHO", func(requestID string, body []byte, agent interface{}) {
+		write(agent, gate.JsonResponse{RequestId: requestID, Action: "ECHO", Body: json.RawMessage(body)})
+	})
+	p.RegisterRouter("FAIL", func(requestID string, body []byte, agent interface{}) {
+		write(agent, gate.JsonResponse{RequestId: requestID, Action: "FAIL", Code: gate.ERR_REQUEST_PARAMS, Message: "bad"})
+	})
+	p.RegisterRouter("NOTIFY", func(requestID string, body []byte, agent interface{}) {
+		write(agent, gate.JsonResponse{Action: "NOTICE", Body: json.RawMessage(body)})
+		write(agent, gate.JsonResponse{RequestId: requestID, Action: "NOTIFY"})
+	})
+	p.RegisterRouter("BYE", func(requestID string, body []byte, agent interface{}) {
+		agent.(gate.Session).Close()
+	})
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = g.Shutdown(context.Background()) })
+	return "ws://" + g.WSAddr().String() + network.WS_PATH
+}
+
+func TestClient_Call(t *testing.T) {
+	addr := startGate(t)
+	ctx := context.Background()
+	if _, err := Dial(ctx, Options{Addr: addr, Token: "bad"}); err == nil {
+		t.Fatal("Dial() with bad token error = nil")
+	}
+	c, err := Dial(ctx, Options{Addr: addr, Token: "good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	notices := make(chan *Message, 1)
+	cancel := c.Subscribe("NOTICE", func(m *Message) { notices <- m })
+	defer cancel()
+
+	tests := []struct {
+		name   string
+		action string
+		body   interface{}
+		want   string
+		code   int
+	}{
+		{name: "echo", action: "ECHO", body: map[string]int{"n": 1}, want: `{"n":1}`},
+		{name: "raw body", action: "ECHO", body: []byte(`[1,2]`), want: `[1,2]`},
+		{name: "error code", action: "FAIL", code: gate.ERR_REQUEST_PARAMS},
+		{name: "push before response", action: "NOTIFY", body: map[string]string{"k": "v"}, want: "null"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := c.Call(ctx, tt.action, tt.body)
+			var e *Error
+			if tt.code != 0 {
+				if !errors.As(err, &e) || e.Code != tt.code {
+					t.Fatalf("Call() error = %v, want code %d", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(m.Body) != tt.want {
+				t.Errorf("Call() body = %s, want %s", m.Body, tt.want)
+			}
+		})
+	}
+
+	select {
+	case m := <-notices:
+		if string(m.Body) != `{"k":"v"}` {
+			t.Errorf("push body = %s", m.Body)
+		}
+	case <-time.After(time.Second):
+		t.Error("push not received")
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	addr := startGate(t)
+	c, err := Dial(context.Background(), Options{
+		Addr:      addr,
+		Token:     "good",
+		Reconnect: true,
+		Backoff:   network.Backoff{Min: 10 * time.Millisecond},
+		Timeout:   time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Call(context.Background(), "BYE", nil); err != ErrDisconnected {
+		t.Fatalf("Call(BYE) error = %v, want ErrDisconnected", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		// 重连后重新鉴权，需要鉴权的action可以直接调用
+		if _, err := c.Call(context.Background(), "ECHO", map[string]int{}); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("Call() after reconnect error = %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_ = c.Close()
+	if _, err := c.Call(context.Background(), "ECHO", map[string]int{}); err != ErrClosed {
+		t.Errorf("Call() after Close error = %v, want ErrClosed", err)
+	}
+}
+
+func TestClient_CallDisconnect(t *testing.T) {
+	addr := startGate(t)
+	c, err := Dial(context.Background(), Options{Addr: addr, Token: "good", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 连接断开时并发的请求都应立即返回，不能等到超时
+	start := time.Now()
+	errs := make(chan error, 50)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			action := "ECHO"
+			if i == cap(errs)/2 {
+				action = "BYE"
+			}
+			_, err := c.Call(context.Background(), action, map[string]int{})
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil && err != ErrDisconnected {
+			t.Errorf("Call() error = %v, want nil or ErrDisconnected", err)
+		}
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Calls returned after %v", d)
+	}
+}
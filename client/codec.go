@@ -0,0 +1,100 @@
+// Author: Vcentor
+// Date: 2026/10/27 3:30 下午
+// desc: 客户端编解码，与服务端processer的消息格式对应
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// SUCCESS 请求成功的错误码，与网关一致
+const SUCCESS = 0
+
+// Message 服务端下发的消息
+type Message struct {
+	RequestID string
+	Action    string
+	Code      int
+	Message   string
+	Body      json.RawMessage
+	Binary    bool   // 二进制消息不解码，内容在Raw中
+	Raw       []byte // 原始数据
+}
+
+// Decode 把body解析到v
+func (m *Message) Decode(v interface{}) error {
+	if len(m.Body) == 0 {
+		return errors.New("message has no body")
+	}
+	return json.Unmarshal(m.Body, v)
+}
+
+// Codec 请求编码和响应解码，与服务端的processer对应
+type Codec interface {
+	Encode(requestID, action string, body interface{}) ([]byte, error)
+	Decode(data []byte) (*Message, error)
+}
+
+// JSONCodec 对应processer.JSONProcesser，字段名与服务端配置一致
+type JSONCodec struct {
+	RequestIDField string
+	ActionField    string
+	BodyField      string
+	CodeField      string
+	MessageField   string
+}
+
+// NewJSONCodec 默认字段名，与网关默认的JSONProcesser和JsonResponse一致
+func NewJSONCodec() *JSONCodec {
+	return &JSONCodec{
+		RequestIDField: "requestId",
+		ActionField:    "action",
+		BodyField:      "body",
+		CodeField:      "code",
+		MessageField:   "message",
+	}
+}
+
+// Encode 编码请求，body为[]byte或json.RawMessage时原样作为json
+func (c *JSONCodec) Encode(requestID, action string, body interface{}) ([]byte, error) {
+	m := map[string]interface{}{
+		c.RequestIDField: requestID,
+		c.ActionField:    action,
+	}
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		m[c.BodyField] = json.RawMessage(b)
+	default:
+		m[c.BodyField] = b
+	}
+	return json.Marshal(m)
+}
+
+// Decode 解码响应，缺少的字段为零值
+func (c *JSONCodec) Decode(data []byte) (*Message, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	msg := &Message{Raw: data, Body: m[c.BodyField]}
+	fields := []struct {
+		name string
+		v    interface{}
+	}{
+		{c.RequestIDField, &msg.RequestID},
+		{c.ActionField, &msg.Action},
+		{c.CodeField, &msg.Code},
+		{c.MessageField, &msg.Message},
+	}
+	for _, f := range fields {
+		if raw, ok := m[f.name]; ok {
+			if err := json.Unmarshal(raw, f.v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return msg, nil
+}
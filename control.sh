@@ -83,10 +83,25 @@ _killgroup() {
     #kill -TERM -"$1" 2>/dev/null || true
 }
 
+# 通过环境变量覆盖监听端口和机房，不修改配置文件
+export_env() {
+    [ -n "$PORT_MAIN" ] && export SOCKETSERVER_WS_LISTEN_ADDR="0.0.0.0:${PORT_MAIN}"
+    [ -n "$IDC_MAIN" ] && export SOCKETSERVER_WS_IDC="${IDC_MAIN}"
+    return 0
+}
+
+# 启动前校验配置，配置非法时不启动
+check_config() {
+    if ! $CMD check-config
+    then
+        _warning "$ACTS config is invalid"
+        exit 1
+    fi
+}
+
 control_start() {
-    AR_APP_TOMAL="${ACTS_DIR}/conf/ws_server.toml"
-    sed -i "s/\(listen_addr[^\"]*=[^\"]*\).*$/\1\"0.0.0.0:${PORT_MAIN}\"/g" AR_APP_TOMAL
-    sed -i "s/\(idc[^\"]*=[^\"]*\).*$/\1\"${IDC_MAIN}\"/g" AR_APP_TOMAL
+    export_env
+    check_config
     if is_running
     then
         _warning "$ACTS is already running"
@@ -116,14 +131,8 @@ control_start() {
 }
 
 foreground_start() {
-    # 根据环境变量解析真实端口
-    real_port=${PORT_MAIN}
-    idc=${IDC_MAIN}
-    # 设置目标conf位置
-    service_conf=${ACTS_DIR}/conf/app_template.toml
-
-    # 将template配置中的端口、idc替换生成正式conf
-    sed -e "s@MATRIX_PORT_MAIN@${real_port}@g;s@IDC@${idc}@g;" conf/app_template.toml > app.toml
+    export_env
+    check_config
     # 前台启动程序
     $CMD
 }
@@ -139,6 +148,26 @@ control_restart() {
     control_start
 }
 
+# 平滑重启：向supervise托管的进程发送SIGUSR2，新进程接管端口后旧进程排空
+# 托管的进程排空后保持运行并转发信号，supervise不会重新拉起
+control_upgrade() {
+    export_env
+    check_config
+    if ! is_running
+    then
+        _warning "$ACTS is not running"
+        exit 1
+    fi
+    monitor_pid=$(get_pid | head -n 1)
+    if [ ! -d /proc/$monitor_pid ]
+    then
+        _warning "$ACTS pid $monitor_pid not found"
+        exit 1
+    fi
+    kill -USR2 "$monitor_pid"
+    _message "$ACTS upgrade signal sent: pid=$monitor_pid"
+}
+
 control_check() {
     if is_running
     then
@@ -154,7 +183,7 @@ control_check_log() {
 }
 
 control_help() {
-    _message "Usage: $(basename "$0") [start|stop|restart|check|check_log]"
+    _message "Usage: $(basename "$0") [start|stop|restart|upgrade|check|check_config|check_log]"
 }
 
 check_with_case() {
@@ -172,7 +201,7 @@ cd $ACTS_DIR
 
 case "X$ACTION" in
     Xforeground_start)
-        Xforeground_start
+        foreground_start
         ;;
     Xcheck_with_case)
         check_with_case
@@ -183,12 +212,19 @@ case "X$ACTION" in
     Xrestart)
         control_restart
         ;;
+    Xupgrade)
+        control_upgrade
+        ;;
     Xstop)
         control_stop
         ;;
     Xcheck)
         control_check
         ;;
+    Xcheck_config)
+        export_env
+        check_config
+        ;;
     Xcheck_log)
         control_check_log
         ;;
@@ -4,48 +4,142 @@
 package env
 
 import (
+	"errors"
 	"os"
 	"path"
 	"path/filepath"
 )
 
-// RootPath 根目录
-func RootPath() string {
+// 目录环境变量，命令行参数未指定时生效
+const (
+	ENV_ROOT_DIR    = "SOCKETSERVER_ROOT"
+	ENV_CONF_DIR    = "SOCKETSERVER_CONF_DIR"
+	ENV_LOG_DIR     = "SOCKETSERVER_LOG_DIR"
+	ENV_DATA_DIR    = "SOCKETSERVER_DATA_DIR"
+	ENV_CONFIG_FILE = "SOCKETSERVER_CONFIG"
+)
+
+// Paths 目录配置，为空的项依次使用环境变量和默认值
+type Paths struct {
+	Root       string // 根目录，默认为可执行文件或当前工作目录中包含conf目录的那个
+	Conf       string // 配置目录，默认为ConfigFile所在目录或root/conf
+	Log        string // 日志目录，默认为root/log
+	Data       string // 数据目录，默认为root/data
+	ConfigFile string // server.toml路径，默认为conf/server.toml
+}
+
+var paths Paths
+
+// Setup 设置目录，相对路径按当前工作目录转换为绝对路径，需要在读取配置前调用
+func Setup(p Paths) {
+	paths = Paths{
+		Root:       abs(p.Root),
+		Conf:       abs(p.Conf),
+		Log:        abs(p.Log),
+		Data:       abs(p.Data),
+		ConfigFile: abs(p.ConfigFile),
+	}
+}
+
+// lookup 依次使用Setup设置的值和环境变量
+func lookup(value, name string) string {
+	if value != "" {
+		return value
+	}
+	return abs(os.Getenv(name))
+}
+
+// abs 转换为绝对路径，空字符串保持不变
+func abs(p string) string {
+	if p == "" {
+		return ""
+	}
+	if a, err := filepath.Abs(p); err == nil {
+		return a
+	}
+	return p
+}
+
+// hasConf 目录下是否有conf目录
+func hasConf(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "conf"))
+	return err == nil && info.IsDir()
+}
+
+// RootPath 根目录，未指定时查找包含conf目录的可执行文件所在目录或当前工作目录，都没有时返回错误
+func RootPath() (string, error) {
+	if dir := lookup(paths.Root, ENV_ROOT_DIR); dir != "" {
+		return dir, nil
+	}
 	pwd, err := os.Getwd()
 	if err != nil {
-		panic("Cannot get current dir: " + err.Error())
+		return "", errors.New("cannot get current dir: " + err.Error())
 	}
-	var dir string
 
 	bindir := filepath.Dir(os.Args[0])
 	if !filepath.IsAbs(bindir) {
 		bindir = filepath.Join(pwd, bindir)
 	}
-	// 如果有和可执行文件平级的conf目录，则当前目录就是根目录
+	// 如果有和可执行文件平级的conf目录，则可执行文件所在目录就是根目录
 	// 这通常是直接在代码目录里go build然后直接执行生成的结果
-	dir = filepath.Join(bindir, "conf")
-	if _, err := os.Stat(dir); !os.IsNotExist(err) {
-		dir = bindir
-		return dir
-	} else {
-		panic("Cannot get conf dir by current dir")
+	if hasConf(bindir) {
+		return bindir, nil
+	}
+	// go run、go test或可执行文件在其他目录时，使用当前工作目录
+	if hasConf(pwd) {
+		return pwd, nil
+	}
+	return "", errors.New("cannot find conf dir next to executable or in current dir, use --root or " + ENV_ROOT_DIR)
+}
+
+// rootJoin 根目录下的子目录
+func rootJoin(name string) (string, error) {
+	root, err := RootPath()
+	if err != nil {
+		return "", err
 	}
+	return path.Join(root, name), nil
 }
 
 // ConfPath conf目录
-func ConfPath() string {
-	return path.Join(RootPath(), "conf")
+func ConfPath() (string, error) {
+	if dir := lookup(paths.Conf, ENV_CONF_DIR); dir != "" {
+		return dir, nil
+	}
+	if file := lookup(paths.ConfigFile, ENV_CONFIG_FILE); file != "" {
+		return filepath.Dir(file), nil
+	}
+	return rootJoin("conf")
+}
+
+// ServerConfFile server.toml路径
+func ServerConfFile() (string, error) {
+	if file := lookup(paths.ConfigFile, ENV_CONFIG_FILE); file != "" {
+		return file, nil
+	}
+	dir, err := ConfPath()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "server.toml"), nil
 }
 
 // DataPath data目录
-func DataPath() string {
-	return path.Join(RootPath(), "data")
+func DataPath() (string, error) {
+	if dir := lookup(paths.Data, ENV_DATA_DIR); dir != "" {
+		return dir, nil
+	}
+	return rootJoin("data")
 }
 
-func LogPath() string {
-	return path.Join(RootPath(), "log")
+// LogPath log目录
+func LogPath() (string, error) {
+	if dir := lookup(paths.Log, ENV_LOG_DIR); dir != "" {
+		return dir, nil
+	}
+	return rootJoin("log")
 }
 
-func LogicPath() string {
-	return path.Join(RootPath(), "logic")
+func LogicPath() (string, error) {
+	return rootJoin("logic")
 }
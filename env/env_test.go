@@ -0,0 +1,123 @@
+// Author: Vcentor
+// Date: 2026/10/23 10:50 上午
+// desc: 运行目录和配置路径测试
+
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	defer Setup(Paths{})
+	for _, name := range []string{ENV_ROOT_DIR, ENV_CONF_DIR, ENV_LOG_DIR, ENV_DATA_DIR, ENV_CONFIG_FILE} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+
+	tests := []struct {
+		name  string
+		paths Paths
+		env   map[string]string
+		conf  string
+		file  string
+		log   string
+		data  string
+	}{
+		{
+			name:  "root",
+			paths: Paths{Root: "/srv"},
+			conf:  "/srv/conf",
+			file:  "/srv/conf/server.toml",
+			log:   "/srv/log",
+			data:  "/srv/data",
+		},
+		{
+			name:  "flag over env",
+			paths: Paths{Root: "/srv", Log: "/var/log/ss"},
+			env:   map[string]string{ENV_LOG_DIR: "/tmp/log", ENV_DATA_DIR: "/tmp/data"},
+			conf:  "/srv/conf",
+			file:  "/srv/conf/server.toml",
+			log:   "/var/log/ss",
+			data:  "/tmp/data",
+		},
+		{
+			name:  "config file",
+			paths: Paths{ConfigFile: "/etc/ss/server.toml"},
+			env:   map[string]string{ENV_ROOT_DIR: "/srv"},
+			conf:  "/etc/ss",
+			file:  "/etc/ss/server.toml",
+			log:   "/srv/log",
+			data:  "/srv/data",
+		},
+		{
+			name:  "conf dir",
+			paths: Paths{Root: "/srv"},
+			env:   map[string]string{ENV_CONF_DIR: "/etc/ss"},
+			conf:  "/etc/ss",
+			file:  "/etc/ss/server.toml",
+			log:   "/srv/log",
+			data:  "/srv/data",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+			Setup(tt.paths)
+			if got, _ := ConfPath(); got != tt.conf {
+				t.Errorf("ConfPath() = %s, want %s", got, tt.conf)
+			}
+			if got, _ := ServerConfFile(); got != tt.file {
+				t.Errorf("ServerConfFile() = %s, want %s", got, tt.file)
+			}
+			if got, _ := LogPath(); got != tt.log {
+				t.Errorf("LogPath() = %s, want %s", got, tt.log)
+			}
+			if got, _ := DataPath(); got != tt.data {
+				t.Errorf("DataPath() = %s, want %s", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestRootPath_Cwd(t *testing.T) {
+	dir, err := os.MkdirTemp("", "env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "conf"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pwd, _ := os.Getwd()
+	defer os.Chdir(pwd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer Setup(Paths{})
+	Setup(Paths{})
+	os.Unsetenv(ENV_ROOT_DIR)
+
+	// go test的可执行文件在临时目录，没有conf目录，使用当前工作目录
+	want, _ := filepath.EvalSymlinks(dir)
+	root, err := RootPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := filepath.EvalSymlinks(root); got != want {
+		t.Errorf("RootPath() = %s, want %s", got, want)
+	}
+
+	// 找不到conf目录时返回错误，不panic
+	if err := os.Remove(filepath.Join(dir, "conf")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DataPath(); err == nil {
+		t.Error("DataPath() without conf dir should fail")
+	}
+}
@@ -0,0 +1,23 @@
+// Author: Vcentor
+// Date: 2026/10/23 10:30 上午
+// desc: 版本信息，编译时通过-ldflags "-X socketserver/env.Version=..."写入
+
+package env
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// 版本信息，未通过-ldflags指定时为默认值
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildTime = "unknown"
+)
+
+// VersionInfo 版本信息，用于version子命令
+func VersionInfo() string {
+	return fmt.Sprintf("socketserver %s (commit %s, built %s, %s %s/%s)",
+		Version, GitCommit, BuildTime, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
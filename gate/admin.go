@@ -0,0 +1,279 @@
+// Author: Vcentor
+// Date: 2026/10/25 10:30 上午
+// desc: 管理接口，单独监听并使用API Key鉴权，供值班人员查看和处理线上会话
+// GET  /admin/sessions              会话列表，?uid=按用户过滤
+// GET  /admin/sessions/{id}         会话详情及属性
+// POST /admin/sessions/{id}/kick    踢掉会话，请求体{"reason": "..."}
+// POST /admin/broadcast             广播通知，请求体{"message": "...", "uid": "..."}，uid为空时发给所有会话
+// GET  /admin/actions               已注册的action
+
+package gate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"socketserver/auth"
+	"sort"
+	"strings"
+	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// 管理接口下发的通知
+const (
+	ACTION_KICKED = "KICKED" // 会话被踢掉，随后断开连接
+	ACTION_NOTICE = "NOTICE" // 广播通知
+)
+
+// adminPrefix 管理接口路径前缀
+const adminPrefix = "/admin/"
+
+// kickFlushTimeout 踢掉会话前等待通知发送的最长时间
+const kickFlushTimeout = time.Second
+
+// AdminConfOption 管理接口配置选项
+type AdminConfOption struct {
+	Enable     bool          `toml:"enable"`
+	ListenAddr string        `toml:"listen_addr" validate:"addr"`
+	APIKeys    []auth.APIKey `toml:"api_keys"` // 请求头Authorization: Bearer <key>
+}
+
+// Validate 开启时需要配置监听地址和API Key
+func (conf *AdminConfOption) Validate() error {
+	if !conf.Enable {
+		return nil
+	}
+	if conf.ListenAddr == "" {
+		return errors.New("listen_addr is required")
+	}
+	for _, k := range conf.APIKeys {
+		if k.Key != "" {
+			return nil
+		}
+	}
+	return errors.New("at least one api key is required")
+}
+
+// SessionInfo 会话信息
+type SessionInfo struct {
+	SessionID     string                 `json:"sessionId"`
+	Transport     string                 `json:"transport"`
+	RemoteAddr    string                 `json:"remoteAddr"`
+	UID           string                 `json:"uid,omitempty"`
+	Principal     *auth.Principal        `json:"principal,omitempty"`
+	PendingWrites int                    `json:"pendingWrites"`
+	Stats         SessionStats           `json:"stats"`
+	Attrs         map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// ActionInfo 已注册的action
+type ActionInfo struct {
+	Action string `json:"action"`
+	Public bool   `json:"public"`
+}
+
+// kickRequest 踢掉会话请求体
+type kickRequest struct {
+	Reason string `json:"reason"`
+}
+
+// broadcastRequest 广播请求体
+type broadcastRequest struct {
+	Message string `json:"message"`
+	UID     string `json:"uid"`
+}
+
+// adminHandler 管理接口
+type adminHandler struct {
+	gate          *Gate
+	authenticator auth.Authenticator
+}
+
+// adminHandler 管理接口路由
+func (gate *Gate) adminHandler() http.Handler {
+	return &adminHandler{
+		gate:          gate,
+		authenticator: auth.NewAPIKeyAuthenticator(gate.AdminConf.APIKeys),
+	}
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	operator, err := h.authenticator.Authenticate(r.Context(), token)
+	if token == "" || err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, adminPrefix) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, adminPrefix)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case path == "sessions" && r.Method == http.MethodGet:
+		h.listSessions(w, r)
+		return
+	case len(parts) == 2 && parts[0] == "sessions" && r.Method == http.MethodGet:
+		h.getSession(w, parts[1])
+		return
+	case len(parts) == 3 && parts[0] == "sessions" && parts[2] == "kick" && r.Method == http.MethodPost:
+		h.kick(w, r, parts[1], operator)
+		return
+	case path == "broadcast" && r.Method == http.MethodPost:
+		h.broadcast(w, r, operator)
+		return
+	case path == "actions" && r.Method == http.MethodGet:
+		h.listActions(w)
+		return
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+}
+
+// listSessions 会话列表，按连接时间排序
+func (h *adminHandler) listSessions(w http.ResponseWriter, r *http.Request) {
+	var sessions []Session
+	if uid := r.URL.Query().Get("uid"); uid != "" {
+		sessions = h.gate.Sessions.UserSessions(uid)
+	} else {
+		sessions = h.gate.Sessions.Sessions()
+	}
+	var infos = make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, h.gate.sessionInfo(s, false))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Stats.ConnectedAt.Before(infos[j].Stats.ConnectedAt)
+	})
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// getSession 会话详情
+func (h *adminHandler) getSession(w http.ResponseWriter, sid string) {
+	s := h.gate.Sessions.Get(sid)
+	if s == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, h.gate.sessionInfo(s, true))
+}
+
+// kick 通知客户端后断开会话
+func (h *adminHandler) kick(w http.ResponseWriter, r *http.Request, sid string, operator *auth.Principal) {
+	var req kickRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+	}
+	s := h.gate.Sessions.Get(sid)
+	if s == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+		return
+	}
+	h.gate.logger.Warning(s.Context(), "Admin kick session", logit.String("operator", operator.ID),
+		logit.String("reason", req.Reason))
+	// 写入不阻塞，写队列已满时会话直接按slow_consumer断开
+	h.gate.writeResp(s, "", ACTION_KICKED, SUCCESS, req.Reason, nil)
+	h.gate.closeAfterFlush(s, CLOSE_KICKED, kickFlushTimeout)
+	writeJSON(w, http.StatusOK, map[string]string{"sessionId": sid})
+}
+
+// broadcast 下发通知
+func (h *adminHandler) broadcast(w http.ResponseWriter, r *http.Request, operator *auth.Principal) {
+	var req broadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Message == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "message is required"})
+		return
+	}
+	var sessions []Session
+	if req.UID != "" {
+		sessions = h.gate.Sessions.UserSessions(req.UID)
+	} else {
+		sessions = h.gate.Sessions.Sessions()
+	}
+	b, _ := json.Marshal(&JsonResponse{Action: ACTION_NOTICE, Code: SUCCESS, Message: req.Message})
+	// WriteMsg不阻塞，慢连接不会拖住广播
+	var sent int
+	for _, s := range sessions {
+		if err := s.WriteMsg(b); err == nil {
+			sent++
+		}
+	}
+	h.gate.logger.Notice(h.gate.Ctx, "Admin broadcast", logit.String("operator", operator.ID),
+		logit.String("uid", req.UID), logit.Int("sessions", len(sessions)), logit.Int("sent", sent))
+	writeJSON(w, http.StatusOK, map[string]int{"sessions": len(sessions), "sent": sent})
+}
+
+// closeAfterFlush 后台等待已写入的消息发出后断开会话，超过timeout直接断开，不阻塞调用方
+func (gate *Gate) closeAfterFlush(s Session, reason string, timeout time.Duration) {
+	go func() {
+		ticker := time.NewTicker(drainPollInterval)
+		defer ticker.Stop()
+		deadline := time.NewTimer(timeout)
+		defer deadline.Stop()
+		for s.PendingWrites() > 0 {
+			select {
+			case <-ticker.C:
+			case <-deadline.C:
+				s.CloseWithReason(reason)
+				return
+			}
+		}
+		s.CloseWithReason(reason)
+	}()
+}
+
+// listActions 已注册的action
+func (h *adminHandler) listActions(w http.ResponseWriter) {
+	actions := h.gate.Processer.Actions()
+	if h.gate.authenticator != nil && !h.gate.Processer.HasRoute(h.gate.AuthConf.Action) {
+		actions = append(actions, h.gate.AuthConf.Action)
+		sort.Strings(actions)
+	}
+	var infos = make([]ActionInfo, 0, len(actions))
+	for _, action := range actions {
+		infos = append(infos, ActionInfo{Action: action, Public: h.gate.isPublic(action)})
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// sessionInfo 会话信息，withAttrs为true时包含会话属性
+func (gate *Gate) sessionInfo(s Session, withAttrs bool) SessionInfo {
+	info := SessionInfo{
+		SessionID:     s.SessionID(),
+		Transport:     s.Transport(),
+		RemoteAddr:    s.RemoteAddr().String(),
+		UID:           gate.Sessions.UID(s.SessionID()),
+		Principal:     s.Principal(),
+		PendingWrites: s.PendingWrites(),
+		Stats:         s.Stats(),
+	}
+	if withAttrs {
+		info.Attrs = make(map[string]interface{})
+		for _, k := range s.Attrs().Keys() {
+			v, ok := s.Attrs().Get(k)
+			if !ok {
+				continue
+			}
+			// 属性可能是连接、channel等无法序列化的对象
+			if _, err := json.Marshal(v); err != nil {
+				v = fmt.Sprintf("%T", v)
+			}
+			info.Attrs[k] = v
+		}
+	}
+	return info
+}
+
+// writeJSON 输出json
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
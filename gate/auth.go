@@ -0,0 +1,149 @@
+// Author: Vcentor
+// Date: 2026/10/19 4:45 下午
+// desc: 网关鉴权，握手时或通过AUTH action鉴权，未鉴权的会话只能调用公开action
+
+package gate
+
+import (
+	"encoding/json"
+	"net/http"
+	"socketserver/auth"
+	"socketserver/processer"
+	"strings"
+	"sync"
+	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+const (
+	DEFAULT_AUTH_ACTION      = "AUTH"
+	DEFAULT_AUTH_QUERY_PARAM = "token"
+)
+
+// sessionAuth 会话鉴权信息，嵌入到WSAgent和TCPAgent中
+type sessionAuth struct {
+	authMutex sync.RWMutex
+	principal *auth.Principal
+}
+
+// Principal 鉴权通过后的身份信息，未鉴权或已过期时返回nil
+func (s *sessionAuth) Principal() *auth.Principal {
+	s.authMutex.RLock()
+	defer s.authMutex.RUnlock()
+	if s.principal == nil {
+		return nil
+	}
+	if !s.principal.ExpiresAt.IsZero() && time.Now().After(s.principal.ExpiresAt) {
+		return nil
+	}
+	return s.principal
+}
+
+// setPrincipal 设置身份信息
+func (s *sessionAuth) setPrincipal(p *auth.Principal) {
+	s.authMutex.Lock()
+	s.principal = p
+	s.authMutex.Unlock()
+}
+
+// authRequest AUTH action请求体
+type authRequest struct {
+	Token string `json:"token"`
+}
+
+// initAuth 初始化鉴权，注册AUTH路由和鉴权中间件，指定自定义鉴权时无论是否开启都生效
+func (gate *Gate) initAuth() error {
+	if gate.customAuth != nil {
+		gate.AuthConf.Enable = true
+		gate.authenticator = new(auth.Reloadable)
+		gate.authenticator.Store(gate.customAuth)
+	} else if gate.AuthConf.Enable {
+		authenticator, err := auth.NewReloadable(gate.AuthConf)
+		if err != nil {
+			return err
+		}
+		gate.authenticator = authenticator
+	} else {
+		return nil
+	}
+	if gate.AuthConf.Action == "" {
+		gate.AuthConf.Action = DEFAULT_AUTH_ACTION
+	}
+	if gate.AuthConf.QueryParam == "" {
+		gate.AuthConf.QueryParam = DEFAULT_AUTH_QUERY_PARAM
+	}
+	// AUTH action和公开action只对本网关生效，不注册到可能被多个网关共用的处理器
+	gate.public[gate.AuthConf.Action] = true
+	for _, action := range gate.AuthConf.PublicActions {
+		gate.public[action] = true
+	}
+	gate.chain = append(gate.chain, gate.authMiddleware)
+	return nil
+}
+
+// authMiddleware 拦截未鉴权会话对非公开action的调用
+func (gate *Gate) authMiddleware(next processer.HandlerFunc) processer.HandlerFunc {
+	return func(p processer.Processer, agent interface{}) error {
+		if gate.isPublic(p.Action) {
+			return next(p, agent)
+		}
+		if s, ok := agent.(Session); !ok || s.Principal() == nil {
+			return processer.ErrUnauthenticated
+		}
+		return next(p, agent)
+	}
+}
+
+// handleAuth AUTH action，body为{"token": "..."}或token字符串
+func (gate *Gate) handleAuth(requestID string, body []byte, agent interface{}) {
+	s, ok := agent.(Session)
+	if !ok {
+		return
+	}
+	var req authRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		req.Token = string(body)
+	}
+	p, err := gate.authenticate(s, req.Token)
+	if err != nil {
+		gate.writeResp(s, requestID, gate.AuthConf.Action, ERR_UNAUTHENTICATED, err.Error(), nil)
+		return
+	}
+	gate.writeResp(s, requestID, gate.AuthConf.Action, SUCCESS, SUCCESS_MSG, p)
+}
+
+// handshakeAuth websocket握手时通过url参数或Authorization头鉴权
+// 未携带凭证时允许连接，之后可通过AUTH action鉴权；凭证无效时返回false
+func (gate *Gate) handshakeAuth(s Session, r *http.Request) bool {
+	if gate.authenticator == nil || r == nil {
+		return true
+	}
+	credential := r.URL.Query().Get(gate.AuthConf.QueryParam)
+	if h := r.Header.Get("Authorization"); credential == "" && h != "" {
+		credential = strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	if credential == "" {
+		return true
+	}
+	if _, err := gate.authenticate(s, credential); err != nil {
+		gate.writeResp(s, "", gate.AuthConf.Action, ERR_UNAUTHENTICATED, err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+// authenticate 校验凭证，成功后绑定会话身份并补发离线消息
+func (gate *Gate) authenticate(s Session, credential string) (*auth.Principal, error) {
+	p, err := gate.authenticator.Authenticate(s.Context(), credential)
+	if err != nil {
+		gate.logger.Notice(s.Context(), "Authenticate failed", logit.Error("error", err))
+		return nil, err
+	}
+	s.setPrincipal(p)
+	gate.logger.Notice(s.Context(), "Authenticate success", logit.String("principal", p.ID),
+		logit.String("method", p.Method))
+	gate.Login(p.ID, s)
+	gate.authenticated(s, p)
+	return p, nil
+}
@@ -0,0 +1,76 @@
+// Author: Vcentor
+// Date: 2026/10/19 6:05 下午
+// desc: 网关授权，按角色限制action调用，规则文件修改后自动生效
+
+package gate
+
+import (
+	"path"
+	"socketserver/auth"
+	"socketserver/env"
+	"socketserver/processer"
+	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// AuthzConfOption 授权配置选项
+type AuthzConfOption struct {
+	Enable         bool          `toml:"enable"`
+	RuleFile       string        `toml:"rule_file" default:"authz.toml"`   // 规则文件，相对conf目录
+	ReloadInterval time.Duration `toml:"reload_interval" validate:"min=0"` // 检查规则文件变化的间隔，单位s，<=0不自动加载
+}
+
+// ruleFile 规则文件路径，相对路径基于conf目录
+func (conf AuthzConfOption) ruleFile() (string, error) {
+	if path.IsAbs(conf.RuleFile) {
+		return conf.RuleFile, nil
+	}
+	dir, err := env.ConfPath()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, conf.RuleFile), nil
+}
+
+// initAuthz 初始化授权，注册授权中间件
+func (gate *Gate) initAuthz() error {
+	if !gate.AuthzConf.Enable {
+		return nil
+	}
+	ruleFile, err := gate.AuthzConf.ruleFile()
+	if err != nil {
+		return err
+	}
+	authorizer, err := auth.NewAuthorizer(ruleFile)
+	if err != nil {
+		return err
+	}
+	gate.authorizer = authorizer
+	gate.chain = append(gate.chain, gate.authzMiddleware)
+	return nil
+}
+
+// reloadAuthz 重新加载授权规则，失败时保留原有规则
+func (gate *Gate) reloadAuthz() {
+	if err := gate.authorizer.Reload(); err != nil {
+		gate.logger.Warning(gate.Ctx, "Reload authz rules failed, keep old rules", logit.Error("error", err))
+		return
+	}
+	gate.logger.Notice(gate.Ctx, "Reload authz rules success",
+		logit.Int("rules", len(gate.authorizer.Policy().Rules)))
+}
+
+// authzMiddleware 拒绝角色不匹配的调用
+func (gate *Gate) authzMiddleware(next processer.HandlerFunc) processer.HandlerFunc {
+	return func(p processer.Processer, agent interface{}) error {
+		var principal *auth.Principal
+		if s, ok := agent.(Session); ok {
+			principal = s.Principal()
+		}
+		if !gate.authorizer.Allow(p.Action, principal) {
+			return processer.ErrForbidden
+		}
+		return next(p, agent)
+	}
+}
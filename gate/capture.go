@@ -0,0 +1,94 @@
+// Author: Vcentor
+// Date: 2026/10/26 4:30 下午
+// desc: 流量抓包，开启后记录每个会话建立、断开和收发的消息，用于复现线上问题和回放回归
+// 开关和文件支持热加载，抓包文件包含原始数据，只建议短时间开启
+
+package gate
+
+import (
+	"path/filepath"
+	"socketserver/env"
+	"socketserver/library/capture"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// CaptureConfOption 抓包配置选项
+type CaptureConfOption struct {
+	Enable bool   `toml:"enable"`
+	Path   string `toml:"path" default:"capture/capture.jsonl"` // 相对日志目录，也可以是绝对路径
+}
+
+// file 抓包文件绝对路径
+func (conf CaptureConfOption) file() (string, error) {
+	if filepath.IsAbs(conf.Path) {
+		return conf.Path, nil
+	}
+	dir, err := env.LogPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, conf.Path), nil
+}
+
+// openCapture 按配置打开抓包文件，未开启时返回nil
+func openCapture(conf CaptureConfOption) (*capture.Writer, error) {
+	if !conf.Enable {
+		return nil, nil
+	}
+	file, err := conf.file()
+	if err != nil {
+		return nil, err
+	}
+	return capture.Create(file)
+}
+
+// setCapture 替换抓包文件并关闭原文件
+func (gate *Gate) setCapture(w *capture.Writer) {
+	old := gate.captureWriter()
+	gate.capture.Store(w)
+	if old != nil {
+		if err := old.Close(); err != nil {
+			gate.logger.Warning(gate.Ctx, "Close capture file failed", logit.Error("error", err))
+		}
+	}
+}
+
+// captureWriter 当前的抓包文件，未开启时返回nil
+func (gate *Gate) captureWriter() *capture.Writer {
+	w, _ := gate.capture.Load().(*capture.Writer)
+	return w
+}
+
+// record 记录收发的消息，messageType为0时按内容判断消息类型
+func (gate *Gate) record(s Session, direction string, messageType int, data []byte) {
+	if w := gate.captureWriter(); w != nil {
+		gate.writeCapture(w, s, capture.NewRecord(s.SessionID(), s.Transport(), direction,
+			captureType(messageType, data), data))
+	}
+}
+
+// recordEvent 记录连接建立和断开
+func (gate *Gate) recordEvent(s Session, typ, payload string) {
+	if w := gate.captureWriter(); w != nil {
+		gate.writeCapture(w, s, capture.NewRecord(s.SessionID(), s.Transport(), "", typ, []byte(payload)))
+	}
+}
+
+// writeCapture 写入抓包，失败时只记录日志
+func (gate *Gate) writeCapture(w *capture.Writer, s Session, r capture.Record) {
+	if err := w.Write(r); err != nil {
+		gate.logger.Warning(s.Context(), "Write capture failed", logit.Error("error", err))
+	}
+}
+
+// captureType 消息的抓包类型，websocket使用帧类型，tcp按内容判断
+func captureType(messageType int, data []byte) string {
+	switch messageType {
+	case TEXT_MESSAGE:
+		return capture.TYPE_TEXT
+	case BINARY_MESSAGE:
+		return capture.TYPE_BINARY
+	}
+	return capture.MessageType(data)
+}
@@ -0,0 +1,134 @@
+// Author: Vcentor
+// Date: 2026/10/19 5:05 下午
+// desc: 请求分发及错误下发，websocket和tcp共用
+
+package gate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"socketserver/library/trace"
+	"socketserver/processer"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// handleMsg 解析并分发请求，需要断开连接时返回断开原因
+func (gate *Gate) handleMsg(s Session, data []byte) string {
+	msg, err := gate.Processer.Unmarshal(data)
+	if err != nil {
+		gate.logger.Warning(s.Context(), "Unmarshal message failed", logit.Error("error", err))
+		gate.metrics.requests.Inc(ACTION_UNKNOWN, strconv.Itoa(ERR_REQUEST_PARAMS))
+		gate.sessionError(s, err)
+		gate.writeResp(s, "", "", ERR_REQUEST_PARAMS, "Illegal request params", nil)
+		return CLOSE_PROTOCOL_ERROR
+	}
+	return gate.dispatch(s, msg, false)
+}
+
+// dispatch 分发请求，需要断开连接时返回断开原因，binary表示由二进制帧(PCM)转换的请求
+func (gate *Gate) dispatch(s Session, msg processer.Processer, binary bool) string {
+	// 请求上下文携带会话和请求字段，处理期间的日志自动带上
+	ctx := logit.ForkContext(s.Context())
+	// 端上传入追踪上下文时作为父span，handler通过Session.Context()向上游传递
+	if sc, err := trace.ParseTraceparent(msg.Trace); err == nil {
+		ctx = trace.WithRemote(ctx, sc)
+	}
+	ctx, span := trace.Start(ctx, "gate.Route")
+	defer span.End()
+	span.SetAttr("action", msg.Action)
+	span.SetAttr("requestId", msg.RequestID)
+	span.SetAttr("sessionId", s.SessionID())
+	span.SetAttr("transport", s.Transport())
+	logit.AddAllLevel(ctx, logit.String("requestId", msg.RequestID), logit.String("action", msg.Action),
+		logit.String("traceId", span.SpanContext().TraceID))
+	msg.Ctx = ctx
+	done := s.withRequest(ctx)
+	defer done()
+
+	// 优雅退出时等待处理中的请求完成
+	start := time.Now()
+	finish := func(action string, code int) {
+		gate.metrics.requestDone(action, code, start)
+		span.SetAttr("code", code)
+	}
+	atomic.AddInt64(&gate.inflight, 1)
+	err := gate.route(msg, s)
+	atomic.AddInt64(&gate.inflight, -1)
+	span.SetError(err)
+	switch {
+	case err == nil:
+		finish(msg.Action, SUCCESS)
+		return ""
+	case errors.Is(err, processer.ErrUnauthenticated):
+		finish(msg.Action, ERR_UNAUTHENTICATED)
+		gate.logger.Notice(ctx, "Unauthenticated request")
+		gate.writeResp(s, msg.RequestID, msg.Action, ERR_UNAUTHENTICATED, "Unauthenticated", nil)
+		return ""
+	case errors.Is(err, processer.ErrForbidden):
+		finish(msg.Action, ERR_FORBIDDEN)
+		gate.logger.Notice(ctx, "Forbidden request")
+		gate.writeResp(s, msg.RequestID, msg.Action, ERR_FORBIDDEN, "Forbidden", nil)
+		return ""
+	case errors.Is(err, processer.ErrThrottled):
+		finish(msg.Action, ERR_THROTTLED)
+		disconnect := gate.limiter().violate(s)
+		gate.logger.Warning(ctx, "Throttled request", logit.Error("error", err), logit.Bool("disconnect", disconnect))
+		// 二进制帧发送频率高，限流期间不逐帧回复，避免放大下行流量
+		if !binary || throttledNotice(s) {
+			gate.writeResp(s, msg.RequestID, msg.Action, ERR_THROTTLED, "Too many requests", nil)
+		}
+		if disconnect {
+			return CLOSE_THROTTLED
+		}
+		return ""
+	default:
+		finish(ACTION_UNKNOWN, ERR_PARSE_ROUTE)
+		gate.logger.Warning(ctx, "Route failed", logit.Error("error", err))
+		gate.sessionError(s, err)
+		gate.writeResp(s, msg.RequestID, "UNKOWN", ERR_PARSE_ROUTE, "Illegal action!", nil)
+		return CLOSE_PROTOCOL_ERROR
+	}
+}
+
+// route 未注册的action直接返回错误，否则依次执行网关中间件和处理器路由
+// 中间件和AUTH action只对本网关生效，同一处理器可以被多个网关共用
+func (gate *Gate) route(msg processer.Processer, s Session) error {
+	auth := gate.authenticator != nil && msg.Action == gate.AuthConf.Action
+	if !auth && !gate.Processer.HasRoute(msg.Action) {
+		return fmt.Errorf("%w, requestId=%s, action=%s", processer.ErrRouteNotFound, msg.RequestID, msg.Action)
+	}
+	var next processer.HandlerFunc = func(p processer.Processer, agent interface{}) error {
+		if auth {
+			gate.handleAuth(p.RequestID, p.Body, agent)
+			return nil
+		}
+		return gate.Processer.Route(p, agent)
+	}
+	for i := len(gate.chain) - 1; i >= 0; i-- {
+		next = gate.chain[i](next)
+	}
+	return next(msg, s)
+}
+
+// isPublic action是否无需鉴权，包括本网关和处理器标记的公开action
+func (gate *Gate) isPublic(action string) bool {
+	return gate.public[action] || gate.Processer.IsPublic(action)
+}
+
+// writeResp 下发json数据
+func (gate *Gate) writeResp(s Session, requestID, action string, code int, message string, body interface{}) {
+	var resp = JsonResponse{
+		RequestId: requestID,
+		Action:    action,
+		Code:      code,
+		Message:   message,
+		Body:      body,
+	}
+	b, _ := json.Marshal(&resp)
+	_ = s.WriteMsg(b)
+}
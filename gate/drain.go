@@ -0,0 +1,166 @@
+// Author: Vcentor
+// Date: 2026/10/21 10:20 上午
+// desc: 优雅退出，停止接入后通知客户端重连，等待处理中的请求和写队列完成后再关闭连接
+
+package gate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// ACTION_SERVER_SHUTDOWN 服务下线通知
+const ACTION_SERVER_SHUTDOWN = "SERVER_SHUTDOWN"
+
+// drainPollInterval 检查排空状态的间隔
+const drainPollInterval = 50 * time.Millisecond
+
+// DrainConfOption 优雅退出配置选项
+type DrainConfOption struct {
+	ReconnectDelay time.Duration `toml:"reconnect_delay" validate:"min=0"` // 建议客户端重连前等待时间，单位s
+	ReconnectAddr  string        `toml:"reconnect_addr"`                   // 建议客户端重连地址，为空时使用原地址
+}
+
+// ShutdownNotice 服务下线通知内容
+type ShutdownNotice struct {
+	ReconnectDelay int64  `json:"reconnectDelay"` // 单位ms
+	ReconnectAddr  string `json:"reconnectAddr,omitempty"`
+	Message        string `json:"message"`
+}
+
+// Draining 是否处于排空状态
+func (gate *Gate) Draining() bool {
+	return atomic.LoadInt32(&gate.draining) == 1
+}
+
+// Shutdown 优雅退出：停止接入，通知所有会话，等待处理中的请求和写队列完成，超时后强制关闭
+// ctx没有截止时间时使用shutdown_timeout，排空超时或退出回调失败时返回错误，重复调用返回nil
+func (gate *Gate) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&gate.draining, 0, 1) {
+		return nil
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := gate.ShutdownTimeout * time.Second
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// 停止接收新连接，健康检查挂在websocket服务上时继续监听，排空期间/readyz返回503
+	// 平滑重启时必须停止accept，新连接和单独监听的http服务都交给新进程
+	if gate.wsserver != nil && gate.wsserver.Handler != nil && gate.handoff == nil {
+		gate.wsserver.RejectUpgrade()
+	} else if gate.wsserver != nil {
+		if err := gate.wsserver.StopAccept(ctx); err != nil {
+			gate.logger.Warning(gate.Ctx, "Websocket server stop accept failed", logit.Error("error", err))
+		}
+	}
+	if gate.tcpserver != nil {
+		gate.tcpserver.StopAccept()
+	}
+	if gate.handoff != nil {
+		gate.stopHTTPServers()
+	}
+
+	sessions := gate.Sessions.Sessions()
+	gate.logger.Notice(gate.Ctx, "Gate draining", logit.Int("sessions", len(sessions)),
+		logit.Int64("inflight", atomic.LoadInt64(&gate.inflight)))
+	notice, _ := json.Marshal(&JsonResponse{
+		Action:  ACTION_SERVER_SHUTDOWN,
+		Code:    SUCCESS,
+		Message: SUCCESS_MSG,
+		Body: ShutdownNotice{
+			ReconnectDelay: int64(gate.DrainConf.ReconnectDelay * time.Second / time.Millisecond),
+			ReconnectAddr:  gate.DrainConf.ReconnectAddr,
+			Message:        "server is shutting down, please reconnect",
+		},
+	})
+	// 写队列满时等待而不是按慢连接断开，每个会话单独等待，不互相拖慢
+	var notified sync.WaitGroup
+	for _, s := range sessions {
+		notified.Add(1)
+		go func(s Session) {
+			defer notified.Done()
+			_ = s.WriteMsgContext(ctx, notice)
+		}(s)
+	}
+	notified.Wait()
+
+	var errs []string
+	if gate.waitDrained(ctx) {
+		gate.logger.Notice(gate.Ctx, "Gate drained")
+	} else {
+		left := gate.Sessions.Len()
+		gate.logger.Warning(gate.Ctx, "Gate drain timeout, force close",
+			logit.Int64("inflight", atomic.LoadInt64(&gate.inflight)), logit.Int("sessions", left))
+		errs = append(errs, fmt.Sprintf("drain timeout, force close %d sessions", left))
+	}
+
+	// 强制关闭剩余连接，排空期间的离线推送已落盘后再把离线存储交给新进程
+	gate.stop()
+	gate.releaseHandoff()
+	for _, fn := range gate.onShutdown {
+		if err := fn(ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// stop 关闭服务、剩余连接和离线存储，停止后台任务
+func (gate *Gate) stop() {
+	if gate.wsserver != nil {
+		gate.wsserver.Close()
+	}
+	if gate.tcpserver != nil {
+		gate.tcpserver.Close()
+	}
+	gate.stopHTTPServers()
+	// 先取消后台任务，平滑重启的新进程不再等待交接，再关闭离线存储
+	if gate.cancel != nil {
+		gate.cancel()
+	}
+	gate.closeOfflineStore()
+	gate.setCapture(nil)
+}
+
+// waitDrained 等待处理中的请求和所有会话的写队列完成，超时返回false
+func (gate *Gate) waitDrained(ctx context.Context) bool {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for !gate.drained() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// drained 是否已排空
+func (gate *Gate) drained() bool {
+	if atomic.LoadInt64(&gate.inflight) > 0 {
+		return false
+	}
+	for _, s := range gate.Sessions.Sessions() {
+		if s.PendingWrites() > 0 {
+			return false
+		}
+	}
+	return true
+}
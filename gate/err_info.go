@@ -13,6 +13,14 @@ type JsonResponse struct {
 }
 
 const (
-	ERR_PARSE_ROUTE    = 50000 // 解析路由失败
-	ERR_REQUEST_PARAMS = 50001 // 非法的请求参数
+	SUCCESS_MSG = "ok"
+)
+
+const (
+	SUCCESS             = 0     // 请求成功
+	ERR_PARSE_ROUTE     = 50000 // 解析路由失败
+	ERR_REQUEST_PARAMS  = 50001 // 非法的请求参数
+	ERR_UNAUTHENTICATED = 50002 // 未鉴权或鉴权失败
+	ERR_FORBIDDEN       = 50003 // 无权调用该action
+	ERR_THROTTLED       = 50004 // 请求过于频繁
 )
@@ -5,65 +5,331 @@ package gate
 
 import (
 	"context"
-	"socketserver/env"
-	"socketserver/network"
-	"socketserver/processer"
-	"github.com/BurntSushi/toml"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
-	"path"
+	"socketserver/auth"
+	"socketserver/env"
+	"socketserver/library/config"
+	"socketserver/library/metrics"
+	"socketserver/library/offline"
+	"socketserver/library/trace"
+	"socketserver/library/utils"
+	"socketserver/library/wslog"
+	"socketserver/network"
+	"socketserver/processer"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
 )
 
-var Gateway = new(Gate)
+// Config server.toml配置
+type Config struct {
+	ShutdownTimeout time.Duration       `toml:"shutdown_timeout" default:"5" validate:"min=1"`
+	ReloadInterval  time.Duration       `toml:"reload_interval" validate:"min=0"`
+	LogConf         wslog.Config        `toml:"log_conf"`
+	WSConf          WSConfOption        `toml:"ws_conf"`
+	TCPConf         TPCConfOption       `toml:"tcp_conf"`
+	OfflineConf     OfflineConfOption   `toml:"offline_conf"`
+	AuthConf        auth.Config         `toml:"auth_conf"`
+	AuthzConf       AuthzConfOption     `toml:"authz_conf"`
+	RateLimitConf   RateLimitConfOption `toml:"rate_limit_conf"`
+	AccessConf      AccessConfOption    `toml:"access_conf"`
+	ProxyConf       ProxyConfOption     `toml:"proxy_conf"`
+	DrainConf       DrainConfOption     `toml:"drain_conf"`
+	MetricsConf     MetricsConfOption   `toml:"metrics_conf"`
+	HealthConf      HealthConfOption    `toml:"health_conf"`
+	AdminConf       AdminConfOption     `toml:"admin_conf"`
+	TraceConf       trace.Config        `toml:"trace_conf"`
+	CaptureConf     CaptureConfOption   `toml:"capture_conf"`
+}
+
+// NewConfig 所有配置项为默认值的配置，不读取配置文件时使用
+func NewConfig() (*Config, error) {
+	conf := new(Config)
+	if err := config.Defaults(conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
 
-// Gate 网关信息
+// checkListen 至少启动一个服务，使用已创建的listener时不需要配置监听地址
+func (conf *Config) checkListen() error {
+	if conf.WSConf.ListenAddr == "" && conf.TCPConf.ListenAddr == "" {
+		return errors.New("at least one of ws_conf.listen_addr and tcp_conf.listen_addr is required")
+	}
+	return nil
+}
+
+// Gate 网关信息，通过New创建，同一进程中可以运行多个实例
 type Gate struct {
-	Ctx             context.Context
-	ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
-	WSConf          WSConfOption  `toml:"ws_conf"`
-	TCPConf         TPCConfOption `toml:"tcp_conf"`
+	Config
+	Ctx       context.Context
+	Processer processer.ProcesserOpt
+	Sessions  *SessionPool
+
+	confFile    string  // 配置文件，为空时不支持热加载
+	conf        *Config // WithConfig指定的配置
+	logger      logit.Logger
+	middlewares []processer.Middleware
+	chain       []processer.Middleware // 网关中间件，在处理器路由前执行，不修改共用的处理器
+	public      map[string]bool        // 本网关无需鉴权的action
+	customAuth  auth.Authenticator
+	wsListener  net.Listener
+	tcpListener net.Listener
+	onStart     []func(ctx context.Context) error
+	onShutdown  []func(ctx context.Context) error
+	hooks       []Hooks
+	cancel      context.CancelFunc
+	errs        chan error
+	started     int32
+
+	offlineStore  *offline.Store
+	offlineReady  chan struct{} // 平滑重启的新进程打开离线存储后关闭，为nil时不需要等待
+	pushMutex     sync.RWMutex  // 补发离线消息与推送互斥
+	authenticator *auth.Reloadable
+	authorizer    *auth.Authorizer
+	rateLimit     atomic.Value // *rateLimiter
+	ipFilter      *network.IPFilter
+	trusted       []*net.IPNet
+	wsserver      *network.WSServer
+	tcpserver     *network.TCPServer
+	handoff       *os.File // 平滑重启交接管道的写端
+	upgradeFd     int      // 平滑重启启动时交接管道读端的文件描述符，为0时不是平滑重启启动
+	upgradePgid   int      // 平滑重启启动的新进程组，supervise托管的进程交接后转发信号给该进程组
+	draining      int32    // 排空状态，不再接收新连接
+	inflight      int64    // 处理中的请求数
+	registry      *metrics.Registry
+	metrics       *gateMetrics
+	httpServers   map[string]*http.Server // 单独监听的指标、健康检查和管理接口，按配置的地址索引
+	checkers      []Checker
+	checkOnce     sync.Once
+	readyChecks   []Checker // 就绪检查项，第一次检查时创建
+	failMutex     sync.Mutex
+	failure       error        // 启动后监听失败的错误
+	capture       atomic.Value // *capture.Writer，未开启抓包时为nil
+
+	reloadMutex sync.Mutex
+	applied     *Config // 当前生效的配置，热加载时比较变化
+	reloaders   []reloader
 }
 
 // WSOption websocket服务配置选项
 type WSConfOption struct {
-	Processer   processer.ProcesserOpt
 	IDC         string        `toml:"idc"`
-	ListenAddr  string        `toml:"listen_addr"`
-	MaxConnMum  int           `toml:"max_conn_num"`
-	WriteMsgCap int           `toml:"write_msg_cap"`
-	HTTPTimeout time.Duration `toml:"http_timeout"`
+	ListenAddr  string        `toml:"listen_addr" validate:"addr"` // 为空时不启动websocket服务
+	MaxConnMum  int           `toml:"max_conn_num" default:"100" validate:"min=1"`
+	WriteMsgCap int           `toml:"write_msg_cap" default:"100" validate:"min=1"`
+	HTTPTimeout time.Duration `toml:"http_timeout" default:"10" validate:"min=1"`
 	CerFile     string        `toml:"cer_file"`
 	KeyFile     string        `toml:"key_file"`
 }
 
+// Validate 证书和私钥需要同时配置
+func (conf *WSConfOption) Validate() error {
+	if (conf.CerFile == "") != (conf.KeyFile == "") {
+		return errors.New("cer_file and key_file must be set together")
+	}
+	return nil
+}
+
+// AccessConfOption 接入控制配置选项，websocket和tcp服务共用，单ip连接数按两个服务合计
+type AccessConfOption struct {
+	MaxConnPerIP int      `toml:"max_conn_per_ip" validate:"min=0"`
+	Allow        []string `toml:"allow"`
+	Deny         []string `toml:"deny"`
+	AcceptRate   float64  `toml:"accept_rate" validate:"min=0"`
+	AcceptBurst  int      `toml:"accept_burst" validate:"min=0"`
+}
+
+// Validate 校验黑白名单格式
+func (conf *AccessConfOption) Validate() error {
+	_, err := network.NewIPFilter(conf.filterOption())
+	return err
+}
+
+// filterOption 转换为接入控制配置
+func (conf AccessConfOption) filterOption() network.IPFilterOption {
+	return network.IPFilterOption{
+		MaxConnPerIP: conf.MaxConnPerIP,
+		Allow:        conf.Allow,
+		Deny:         conf.Deny,
+		AcceptRate:   conf.AcceptRate,
+		AcceptBurst:  conf.AcceptBurst,
+	}
+}
+
+// ProxyConfOption 代理配置选项，部署在负载均衡之后时获取真实客户端地址
+type ProxyConfOption struct {
+	TrustedCIDRs     []string      `toml:"trusted_cidrs"`                               // 可信代理网段，只解析来自这些地址的PROXY头和转发header
+	HeaderTimeout    time.Duration `toml:"header_timeout" default:"5" validate:"min=1"` // 读取PROXY头超时时间，单位s
+	TCPProxyProtocol bool          `toml:"tcp_proxy_protocol"`                          // tcp服务开启PROXY protocol v1/v2
+	WSProxyProtocol  bool          `toml:"ws_proxy_protocol"`                           // websocket服务开启PROXY protocol v1/v2
+	WSForwardHeader  bool          `toml:"ws_forward_header"`                           // websocket服务信任X-Forwarded-For和X-Real-IP
+}
+
+// Validate 校验可信代理网段格式
+func (conf *ProxyConfOption) Validate() error {
+	_, err := network.ParseCIDRs(conf.TrustedCIDRs)
+	return err
+}
+
 type TPCConfOption struct {
-	ListenAddr string `toml:"listen_addr"`
-	MaxConnNum int    `toml:"max_conn_num"`
-	ChanCap    int    `toml:"chan_cap"`
+	ListenAddr string `toml:"listen_addr" validate:"addr"` // 为空时不启动tcp服务
+	MaxConnNum int    `toml:"max_conn_num" default:"100" validate:"min=1"`
+	ChanCap    int    `toml:"chan_cap" default:"100" validate:"min=1"`
 
-	LenMsgLen    int    `toml:"len_msg_len"`
-	MaxMsgLen    uint32 `toml:"max_msg_len"`
-	MinMsgLen    uint32 `toml:"min_msg_len"`
+	LenMsgLen    int    `toml:"len_msg_len" default:"2" validate:"oneof=1 2 4"`
+	MaxMsgLen    uint32 `toml:"max_msg_len" default:"4096" validate:"min=1"`
+	MinMsgLen    uint32 `toml:"min_msg_len" default:"1" validate:"min=1"`
 	LittleEndian bool   `toml:"little_endian"`
 }
 
-// Init 初始化Gate
-func Init(ctx context.Context, processer processer.ProcesserOpt) {
-	serverConf := path.Join(env.ConfPath(), "server.toml")
-	if _, err := toml.DecodeFile(serverConf, Gateway); err != nil {
-		panic(err)
+// Parser 按配置的长度字段和字节序创建消息解析器，客户端与服务端使用相同格式
+func (conf TPCConfOption) Parser() *network.TCPParser {
+	p := network.NewTCPParser()
+	p.WithMsgLen(conf.LenMsgLen, conf.MinMsgLen, conf.MaxMsgLen)
+	p.WithEndian(conf.LittleEndian)
+	return p
+}
+
+// Validate 数据长度范围需要在长度字段能表示的范围内
+func (conf *TPCConfOption) Validate() error {
+	if conf.MinMsgLen > conf.MaxMsgLen {
+		return fmt.Errorf("min_msg_len %d is greater than max_msg_len %d", conf.MinMsgLen, conf.MaxMsgLen)
+	}
+	if max := uint64(1)<<(8*uint(conf.LenMsgLen)) - 1; uint64(conf.MaxMsgLen) > max {
+		return fmt.Errorf("max_msg_len %d exceeds %d for len_msg_len %d", conf.MaxMsgLen, max, conf.LenMsgLen)
 	}
-	Gateway.Ctx = ctx
-	Gateway.WSConf.Processer = processer
+	return nil
 }
 
-// Run 启动服务
-func (gate *Gate) Run() {
-	var wsserver *network.WSServer
+// New 创建网关，未指定配置时读取server.toml，所有配置和依赖校验通过后返回
+func New(opts ...Option) (*Gate, error) {
+	gate := &Gate{
+		Ctx:      context.Background(),
+		Sessions: NewSessionPool(),
+		errs:     make(chan error, 1),
+		public:   make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(gate)
+	}
+
+	if gate.conf != nil {
+		gate.Config = *gate.conf
+		gate.confFile = ""
+	} else {
+		if gate.confFile == "" {
+			file, err := env.ServerConfFile()
+			if err != nil {
+				return nil, err
+			}
+			gate.confFile = file
+		}
+		if err := config.Load(gate.confFile, config.ENV_PREFIX, &gate.Config); err != nil {
+			return nil, err
+		}
+	}
+	if gate.wsListener != nil && gate.WSConf.ListenAddr == "" {
+		gate.WSConf.ListenAddr = gate.wsListener.Addr().String()
+	}
+	if gate.tcpListener != nil && gate.TCPConf.ListenAddr == "" {
+		gate.TCPConf.ListenAddr = gate.tcpListener.Addr().String()
+	}
+	if gate.conf != nil {
+		if err := config.Validate("config", &gate.Config); err != nil {
+			return nil, err
+		}
+	}
+	if err := gate.checkListen(); err != nil {
+		return nil, err
+	}
+	if err := gate.checkOffline(); err != nil {
+		return nil, err
+	}
+	if err := gate.checkHTTP(); err != nil {
+		return nil, err
+	}
+	// 另存一份原始配置，热加载时比较变化
+	applied := gate.Config
+	gate.applied = &applied
+
+	if gate.Processer == nil {
+		gate.Processer = processer.NewJSONProcesser("requestId", "action", "body")
+	}
+	if gate.logger == nil {
+		gate.logger = wslog.Logger
+	}
+	if gate.logger == nil {
+		gate.logger = wslog.NewLevelLogger(logit.NopLogger)
+	}
+	if err := wslog.SetLoggerLevel(gate.logger, gate.LogConf.Level); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if gate.ipFilter, err = network.NewIPFilter(gate.AccessConf.filterOption()); err != nil {
+		return nil, err
+	}
+	if gate.trusted, err = network.ParseCIDRs(gate.ProxyConf.TrustedCIDRs); err != nil {
+		return nil, err
+	}
+	if err := gate.initRateLimit(); err != nil {
+		return nil, err
+	}
+	if err := gate.initAuth(); err != nil {
+		return nil, err
+	}
+	if err := gate.initAuthz(); err != nil {
+		return nil, err
+	}
+	gate.initMetrics()
+	gate.chain = append(gate.chain, gate.middlewares...)
+	return gate, nil
+}
+
+// Logger 网关使用的logger
+func (gate *Gate) Logger() logit.Logger {
+	return gate.logger
+}
+
+// Start 启动服务，不阻塞，启动失败时返回错误并释放已占用的资源
+// 启动后监听失败的错误通过Err获取
+func (gate *Gate) Start(ctx context.Context) (err error) {
+	if !atomic.CompareAndSwapInt32(&gate.started, 0, 1) {
+		return errors.New("gate is already started")
+	}
+	gate.Ctx, gate.cancel = context.WithCancel(ctx)
+	defer func() {
+		if err != nil {
+			gate.stop()
+		}
+	}()
+
+	muxes := gate.httpMuxes()
+	failChan, tcpFailChan := make(chan error, 1), make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case err := <-failChan:
+				gate.fail(fmt.Errorf("websocket server: %w", err))
+			case err := <-tcpFailChan:
+				gate.fail(fmt.Errorf("tcp server: %w", err))
+			case <-gate.Ctx.Done():
+				return
+			}
+		}
+	}()
 	if gate.WSConf.ListenAddr != "" {
-		wsserver = &network.WSServer{
+		gate.wsserver = &network.WSServer{
 			Ctx:         gate.Ctx,
 			Addr:        gate.WSConf.ListenAddr,
 			MaxConnNum:  gate.WSConf.MaxConnMum,
@@ -71,7 +337,17 @@ func (gate *Gate) Run() {
 			HTTPTimeout: gate.WSConf.HTTPTimeout * time.Second,
 			CerFile:     gate.WSConf.CerFile,
 			KeyFile:     gate.WSConf.KeyFile,
-			FailChan:    make(chan error),
+			FailChan:    failChan,
+			IPFilter:    gate.ipFilter,
+			Listener:    gate.wsListener,
+			Logger:      gate.logger,
+			Handler:     wsHTTPHandler(muxes),
+			OnReject:    gate.rejectFunc(TRANSPORT_WS),
+
+			ProxyProtocol:      gate.ProxyConf.WSProxyProtocol,
+			ForwardedHeader:    gate.ProxyConf.WSForwardHeader,
+			TrustedProxies:     gate.trusted,
+			ProxyHeaderTimeout: gate.ProxyConf.HeaderTimeout * time.Second,
 			NewAgent: func(conn *network.WSConn) network.Agent {
 				return &WSAgent{
 					Conn: conn,
@@ -81,9 +357,8 @@ func (gate *Gate) Run() {
 		}
 	}
 
-	var tcpserver *network.TCPServer
 	if gate.TCPConf.ListenAddr != "" {
-		tcpserver = &network.TCPServer{
+		gate.tcpserver = &network.TCPServer{
 			Ctx:          gate.Ctx,
 			ListenAddr:   gate.TCPConf.ListenAddr,
 			MaxConnNum:   gate.TCPConf.MaxConnNum,
@@ -92,6 +367,15 @@ func (gate *Gate) Run() {
 			MaxMsgLen:    gate.TCPConf.MaxMsgLen,
 			MinMsgLen:    gate.TCPConf.MinMsgLen,
 			LittleEndian: gate.TCPConf.LittleEndian,
+			IPFilter:     gate.ipFilter,
+			Listener:     gate.tcpListener,
+			Logger:       gate.logger,
+			OnReject:     gate.rejectFunc(TRANSPORT_TCP),
+			FailChan:     tcpFailChan,
+
+			ProxyProtocol:      gate.ProxyConf.TCPProxyProtocol,
+			TrustedProxies:     gate.trusted,
+			ProxyHeaderTimeout: gate.ProxyConf.HeaderTimeout * time.Second,
 			NewAgent: func(conn *network.TCPConn) network.Agent {
 				return &TCPAgent{
 					Conn: conn,
@@ -101,31 +385,124 @@ func (gate *Gate) Run() {
 		}
 	}
 
-	if wsserver != nil {
-		wsserver.Start()
+	if gate.upgradeFd, err = claimUpgradeFd(); err != nil {
+		return fmt.Errorf("invalid %s: %w", ENV_UPGRADE_FD, err)
+	}
+	// 平滑重启的新进程先开始accept，等旧进程排空并交出离线存储后再打开
+	if !gate.upgrading() {
+		if err := gate.openOfflineStore(); err != nil {
+			return err
+		}
+	}
+	w, err := openCapture(gate.CaptureConf)
+	if err != nil {
+		return err
+	}
+	gate.setCapture(w)
+
+	if gate.wsserver != nil {
+		if err := gate.wsserver.Start(); err != nil {
+			// tcp服务还未启动，不需要关闭
+			gate.wsserver, gate.tcpserver = nil, nil
+			return fmt.Errorf("start websocket server: %w", err)
+		}
+	}
+	if gate.tcpserver != nil {
+		if err := gate.tcpserver.Start(); err != nil {
+			gate.tcpserver = nil
+			return fmt.Errorf("start tcp server: %w", err)
+		}
+	}
+	if err := gate.startHTTPServers(muxes); err != nil {
+		return err
+	}
+	if gate.upgrading() {
+		if err := gate.awaitHandoff(); err != nil {
+			return err
+		}
+	}
+
+	if gate.ReloadInterval > 0 && gate.confFile != "" {
+		go utils.WatchFile(gate.Ctx, gate.confFile, gate.ReloadInterval*time.Second, gate.reload)
+	}
+	if gate.authorizer != nil && gate.AuthzConf.ReloadInterval > 0 {
+		go utils.WatchFile(gate.Ctx, gate.authorizer.File(), gate.AuthzConf.ReloadInterval*time.Second, gate.reloadAuthz)
+	}
+
+	for _, fn := range gate.onStart {
+		if err := fn(gate.Ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Err 服务启动后监听失败时写入错误
+func (gate *Gate) Err() <-chan error {
+	return gate.errs
+}
+
+// WSAddr websocket服务实际监听地址，未启动时返回nil
+func (gate *Gate) WSAddr() net.Addr {
+	if gate.wsserver == nil {
+		return nil
+	}
+	return gate.wsserver.LocalAddr()
+}
+
+// TCPAddr tcp服务实际监听地址，未启动时返回nil
+func (gate *Gate) TCPAddr() net.Addr {
+	if gate.tcpserver == nil {
+		return nil
 	}
+	return gate.tcpserver.LocalAddr()
+}
 
-	if tcpserver != nil {
-		tcpserver.Start()
+// Run 启动服务并处理信号，独立进程运行时使用，收到SIGINT或SIGTERM后优雅退出
+// SIGHUP热加载配置，SIGUSR2平滑重启
+func (gate *Gate) Run(ctx context.Context) error {
+	if err := gate.Start(ctx); err != nil {
+		return err
 	}
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
-	select {
-	case sig := <-c:
-		log.Printf("Recieve signal %v\n", sig)
-		// 关闭连接服务
-		wsserver.Close()
-		log.Println("Websocket server is closing...")
-
-		tcpserver.Close()
-		log.Println("TCP server is closing...")
-
-		// 等待5s后关闭所有请求
-		ctx, cancel := context.WithTimeout(gate.Ctx, gate.ShutdownTimeout*time.Second)
-		defer cancel()
-		wsserver.HTTPServer.Shutdown(ctx)
-	case err := <-wsserver.FailChan:
-		log.Fatal("websocket start failed, error[" + err.Error() + "]")
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGUSR2, syscall.SIGHUP)
+	defer signal.Stop(c)
+	var upgradeExit <-chan error
+	for {
+		select {
+		case sig := <-c:
+			if sig == syscall.SIGHUP {
+				log.Printf("Recieve signal %v, reloading...\n", sig)
+				gate.reload()
+				continue
+			}
+			if sig == syscall.SIGUSR2 {
+				log.Printf("Recieve signal %v, upgrading...\n", sig)
+				exit, err := gate.upgrade()
+				if err != nil {
+					log.Println("Upgrade failed, error[" + err.Error() + "]")
+					continue
+				}
+				upgradeExit = exit
+				continue
+			}
+			log.Printf("Recieve signal %v, draining...\n", sig)
+			err := gate.Shutdown(context.Background())
+			log.Println("Gate is closed")
+			// 平滑重启后托管的进程不退出，等新进程组退出
+			if gate.upgradePgid > 0 {
+				if serr := gate.standby(); serr != nil {
+					return serr
+				}
+			}
+			return err
+		case err := <-upgradeExit:
+			upgradeExit = nil
+			gate.abortUpgrade(err)
+		case err := <-gate.errs:
+			_ = gate.Shutdown(context.Background())
+			return fmt.Errorf("server failed: %w", err)
+		}
 	}
 }
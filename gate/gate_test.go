@@ -0,0 +1,1168 @@
+// Author: Vcentor
+// Date: 2026/10/23 5:20 下午
+// desc: 网关测试，覆盖多实例、鉴权、健康检查、指标、管理接口、优雅退出、平滑重启、离线消息和热加载
+
+package gate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"socketserver/auth"
+	"socketserver/env"
+	"socketserver/library/capture"
+	"socketserver/library/offline"
+	"socketserver/library/trace"
+	"socketserver/network"
+	"socketserver/processer"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// testConfig 默认配置
+func testConfig(t *testing.T) *Config {
+	t.Helper()
+	conf, err := NewConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func TestGate_MultiInstance(t *testing.T) {
+	var gates []*Gate
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := processer.NewJSONProcesser("requestId", "action", "body")
+		g, err := New(WithConfig(testConfig(t)), WithProcesser(p), WithWSListener(ln))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := i
+		p.RegisterRouter("PING", func(requestID string, body []byte, agent interface{}) {
+			g.writeResp(agent.(Session), requestID, "PING", SUCCESS, SUCCESS_MSG, id)
+		})
+		if err := g.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		gates = append(gates, g)
+	}
+
+	for i, g := range gates {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+g.WSAddr().String()+"/digitalhuman-ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"requestId":"1","action":"PING","body":{}}`)); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp JsonResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.RequestId != "1" || resp.Body != float64(i) {
+			t.Errorf("gate %d response = %s", i, data)
+		}
+		conn.Close()
+	}
+
+	for _, g := range gates {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := g.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+		cancel()
+	}
+}
+
+func TestGate_SharedProcesser(t *testing.T) {
+	// 两个网关共用处理器，只有第一个开启鉴权，鉴权中间件不影响另一个网关
+	p := processer.NewJSONProcesser("requestId", "action", "body")
+	p.RegisterRouter("PING", func(requestID string, body []byte, agent interface{}) {
+		a := agent.(*WSAgent)
+		a.Gate.writeResp(a, requestID, "PING", SUCCESS, SUCCESS_MSG, nil)
+	})
+	var gates []*Gate
+	for i, want := range []int{ERR_UNAUTHENTICATED, SUCCESS} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := testConfig(t)
+		conf.AuthConf.Enable = i == 0
+		conf.AuthConf.APIKeys = []auth.APIKey{{Key: "k1", ID: "u1"}}
+		g, err := New(WithConfig(conf), WithProcesser(p), WithWSListener(ln))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		gates = append(gates, g)
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+g.WSAddr().String()+"/digitalhuman-ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"requestId":"1","action":"PING","body":{}}`)); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp JsonResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != want {
+			t.Errorf("gate %d response = %s, want code %d", i, data, want)
+		}
+		conn.Close()
+	}
+	if p.HasRoute(DEFAULT_AUTH_ACTION) || p.IsPublic(DEFAULT_AUTH_ACTION) {
+		t.Error("auth action registered to shared processer")
+	}
+
+	for _, g := range gates {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := g.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+		cancel()
+	}
+}
+
+func TestNew_NoConfDir(t *testing.T) {
+	// 测试目录下没有conf目录，默认路径找不到配置文件时返回错误，不panic
+	for _, name := range []string{env.ENV_ROOT_DIR, env.ENV_CONF_DIR, env.ENV_CONFIG_FILE} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	if _, err := New(); err == nil {
+		t.Error("New() without conf dir should fail")
+	}
+}
+
+func TestNew_ConfigError(t *testing.T) {
+	conf := testConfig(t)
+	if _, err := New(WithConfig(conf)); err == nil {
+		t.Error("New() without listen addr should fail")
+	}
+	conf.WSConf.ListenAddr = "127.0.0.1:0"
+	conf.RateLimitConf.Policy = "drop"
+	if _, err := New(WithConfig(conf)); err == nil {
+		t.Error("New() with invalid policy should fail")
+	}
+}
+
+func TestGate_Hooks(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan string, 10)
+	g, err := New(WithConfig(testConfig(t)), WithWSListener(ln), WithHooks(Hooks{
+		OnConnect: func(s Session) {
+			events <- "connect"
+		},
+		OnDisconnect: func(s Session, reason string) {
+			events <- "disconnect:" + reason
+		},
+		OnError: func(s Session, err error) {
+			events <- "error"
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	url := "ws://" + g.WSAddr().String() + "/digitalhuman-ws"
+
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-events:
+				if got != w {
+					t.Fatalf("event = %s, want %s", got, w)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("wait for event %s timeout", w)
+			}
+		}
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	expect("connect", "error", "disconnect:protocol_error")
+	conn.Close()
+
+	conn, _, err = websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect("connect")
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	expect("disconnect:client_close")
+	conn.Close()
+
+	conn, _, err = websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	expect("connect")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = g.Shutdown(ctx)
+	expect("disconnect:server_shutdown")
+}
+
+func TestGate_TCPDisconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sids := make(chan string, 1)
+	g, err := New(WithConfig(testConfig(t)), WithTCPListener(ln), WithHooks(Hooks{
+		OnDisconnect: func(s Session, reason string) {
+			sids <- s.SessionID()
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Shutdown(context.Background())
+
+	conn, err := net.Dial("tcp", g.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for g.Sessions.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn.Close()
+
+	// 断开后会话移出会话池，OnDisconnect能拿到session id
+	select {
+	case sid := <-sids:
+		if sid == "" {
+			t.Error("OnDisconnect session id is empty")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+	if n := g.Sessions.Len(); n != 0 {
+		t.Errorf("Sessions.Len() = %d, want 0", n)
+	}
+}
+
+func TestGate_Metrics(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := testConfig(t)
+	conf.MetricsConf.Enable = true
+	p := processer.NewJSONProcesser("requestId", "action", "body")
+	g, err := New(WithConfig(conf), WithProcesser(p), WithWSListener(ln))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.RegisterRouter("PING", func(requestID string, body []byte, agent interface{}) {
+		g.writeResp(agent.(Session), requestID, "PING", SUCCESS, SUCCESS_MSG, nil)
+	})
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Shutdown(context.Background())
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+g.WSAddr().String()+"/digitalhuman-ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"requestId":"1","action":"PING","body":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get("http://" + g.WSAddr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	for _, want := range []string{
+		`socketserver_connections{transport="ws"} 1`,
+		`socketserver_accepts_total{transport="ws"} 1`,
+		`socketserver_messages_in_total{transport="ws"} 1`,
+		`socketserver_messages_out_total{transport="ws"} 1`,
+		`socketserver_requests_total{action="PING",code="0"} 1`,
+		`socketserver_request_duration_seconds_count{action="PING"} 1`,
+		`socketserver_write_queue_depth{transport="ws"} 0`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+func TestGate_Admin(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := testConfig(t)
+	conf.AdminConf = AdminConfOption{
+		Enable:     true,
+		ListenAddr: "127.0.0.1:0",
+		APIKeys:    []auth.APIKey{{Key: "secret", ID: "oncall"}},
+	}
+	disconnected := make(chan string, 1)
+	g, err := New(WithConfig(conf), WithWSListener(ln), WithHooks(Hooks{
+		OnDisconnect: func(s Session, reason string) {
+			disconnected <- reason
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Shutdown(context.Background())
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+g.WSAddr().String()+"/digitalhuman-ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for g.Sessions.Len() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	base := "http://" + g.httpServers[conf.AdminConf.ListenAddr].Addr
+	call := func(method, path, token, body string) (int, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(method, base+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, data
+	}
+
+	if code, _ := call("GET", "/admin/sessions", "wrong", ""); code != http.StatusUnauthorized {
+		t.Errorf("wrong token status = %d", code)
+	}
+	code, data := call("GET", "/admin/sessions", "secret", "")
+	var infos []SessionInfo
+	if err := json.Unmarshal(data, &infos); code != http.StatusOK || err != nil || len(infos) != 1 {
+		t.Fatalf("list sessions = %d %s", code, data)
+	}
+	sid := infos[0].SessionID
+	if infos[0].Transport != TRANSPORT_WS || infos[0].Stats.ConnectedAt.IsZero() {
+		t.Errorf("session info = %s", data)
+	}
+	if code, _ := call("GET", "/admin/sessions/"+sid, "secret", ""); code != http.StatusOK {
+		t.Errorf("get session status = %d", code)
+	}
+	if code, _ := call("GET", "/admin/sessions/none", "secret", ""); code != http.StatusNotFound {
+		t.Errorf("get unknown session status = %d", code)
+	}
+
+	code, data = call("POST", "/admin/broadcast", "secret", `{"message":"maintenance"}`)
+	if code != http.StatusOK || !strings.Contains(string(data), `"sent":1`) {
+		t.Errorf("broadcast = %d %s", code, data)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var resp JsonResponse
+	if err := conn.ReadJSON(&resp); err != nil || resp.Action != ACTION_NOTICE || resp.Message != "maintenance" {
+		t.Errorf("notice = %+v, %v", resp, err)
+	}
+
+	if code, data := call("POST", "/admin/sessions/"+sid+"/kick", "secret", `{"reason":"abuse"}`); code != http.StatusOK {
+		t.Errorf("kick = %d %s", code, data)
+	}
+	if err := conn.ReadJSON(&resp); err != nil || resp.Action != ACTION_KICKED || resp.Message != "abuse" {
+		t.Errorf("kick notice = %+v, %v", resp, err)
+	}
+	select {
+	case reason := <-disconnected:
+		if reason != CLOSE_KICKED {
+			t.Errorf("disconnect reason = %s", reason)
+		}
+	case <-time.After(time.Second):
+		t.Error("wait for disconnect timeout")
+	}
+}
+
+func TestGate_Ready(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstreamAddr := "tcp://" + upstream.Addr().String()
+	upstream.Close()
+
+	conf := testConfig(t)
+	conf.HealthConf.Enable = true
+	conf.HealthConf.ListenAddr = "127.0.0.1:0"
+	conf.TCPConf.ListenAddr = "127.0.0.1:0"
+	conf.HealthConf.FailureThreshold = 2
+	var upstreamURL = func() string { return "" }
+	g, err := New(WithConfig(conf), WithChecker(URLChecker("asr", func() string { return upstreamURL() })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + g.httpServers[conf.HealthConf.ListenAddr].Addr
+
+	check := func(path string, wantCode int, wantFail ...string) {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var report HealthReport
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != wantCode {
+			t.Errorf("%s status = %d, want %d, report = %+v", path, resp.StatusCode, wantCode, report)
+		}
+		var failed []string
+		for _, c := range report.Checks {
+			if c.Status == HEALTH_FAIL {
+				failed = append(failed, c.Name)
+			}
+		}
+		if strings.Join(failed, ",") != strings.Join(wantFail, ",") {
+			t.Errorf("%s failed checks = %v, want %v", path, failed, wantFail)
+		}
+	}
+
+	// 模拟缓存过期
+	expire := func() {
+		for _, c := range g.readyCheckers() {
+			if c, ok := c.(*cachedChecker); ok {
+				c.checked = time.Time{}
+			}
+		}
+	}
+
+	check("/healthz", http.StatusOK)
+	check("/readyz", http.StatusOK)
+	upstreamURL = func() string { return upstreamAddr }
+	// 缓存有效期内不重新检查，连续失败未达到阈值时不报告失败
+	check("/readyz", http.StatusOK)
+	expire()
+	check("/readyz", http.StatusOK)
+	expire()
+	check("/readyz", http.StatusServiceUnavailable, "asr")
+	upstreamURL = func() string { return "" }
+	expire()
+	g.fail(errors.New("accept failed"))
+	check("/readyz", http.StatusServiceUnavailable, "listener")
+
+	// 排空期间仍可访问单独监听的健康检查端口
+	atomic.StoreInt32(&g.draining, 1)
+	check("/readyz", http.StatusServiceUnavailable, "draining", "listener")
+	atomic.StoreInt32(&g.draining, 0)
+	_ = g.Shutdown(context.Background())
+}
+
+func TestGate_RequestContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := processer.NewJSONProcesser("requestId", "action", "body")
+	fields := make(chan map[string]string, 1)
+	p.RegisterRouter("PING", func(requestID string, body []byte, agent interface{}) {
+		ctx := agent.(Session).Context()
+		var m = make(map[string]string)
+		for _, k := range []string{"sessionId", "transport", "remoteAddr", "requestId", "action"} {
+			if f := logit.FindField(ctx, k); f != nil {
+				m[k], _ = f.Value().(string)
+			}
+		}
+		fields <- m
+	})
+	g, err := New(WithConfig(testConfig(t)), WithProcesser(p), WithWSListener(ln))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Shutdown(context.Background())
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+g.WSAddr().String()+"/digitalhuman-ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"requestId":"r1","action":"PING","body":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-fields:
+		if m["requestId"] != "r1" || m["action"] != "PING" || m["transport"] != TRANSPORT_WS ||
+			m["sessionId"] == "" || m["remoteAddr"] != conn.LocalAddr().String() {
+			t.Errorf("request context fields = %v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait for request timeout")
+	}
+}
+
+func TestGate_Trace(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := make(chan trace.SpanData, 1)
+	trace.SetExporter(trace.ExporterFunc(func(span trace.SpanData) { spans <- span }))
+	defer trace.SetExporter(nil)
+
+	p := processer.NewJSONProcesser("requestId", "action", "body")
+	handled := make(chan trace.SpanContext, 1)
+	p.RegisterRouter("PING", func(requestID string, body []byte, agent interface{}) {
+		handled <- trace.FromContext(agent.(Session).Context())
+	})
+	g, err := New(WithConfig(testConfig(t)), WithProcesser(p), WithWSListener(ln))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Shutdown(context.Background())
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+g.WSAddr().String()+"/digitalhuman-ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	msg := `{"requestId":"r1","action":"PING","body":{},"traceparent":"` + traceparent + `"}`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	var sc trace.SpanContext
+	select {
+	case sc = <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("wait for request timeout")
+	}
+	select {
+	case span := <-spans:
+		if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentID != "00f067aa0ba902b7" {
+			t.Errorf("span trace = %s/%s, want parent from traceparent", span.TraceID, span.ParentID)
+		}
+		if span.SpanID != sc.SpanID || span.TraceID != sc.TraceID {
+			t.Errorf("handler context = %+v, want span %s", sc, span.SpanID)
+		}
+		if span.Attributes["action"] != "PING" || span.Attributes["code"] != SUCCESS || span.Attributes["sessionId"] == "" {
+			t.Errorf("span attributes = %v", span.Attributes)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait for span timeout")
+	}
+}
+
+func TestGate_CaptureReplay(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := testConfig(t)
+	conf.CaptureConf = CaptureConfOption{Enable: true, Path: filepath.Join(t.TempDir(), "capture.jsonl")}
+	p := processer.NewJSONProcesser("requestId", "action", "body")
+	g, err := New(WithConfig(conf), WithProcesser(p), WithWSListener(ln))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.RegisterRouter("ECHO", func(requestID string, body []byte, agent interface{}) {
+		g.writeResp(agent.(Session), requestID, "ECHO", SUCCESS, SUCCESS_MSG, json.RawMessage(body))
+	})
+	// 二进制消息的requestId为会话id，回放时不同
+	p.RegisterRouter("PROCESS_PCM", func(requestID string, body []byte, agent interface{}) {
+		g.writeResp(agent.(Session), requestID, "PROCESS_PCM", SUCCESS, SUCCESS_MSG, len(body))
+	})
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Shutdown(context.Background())
+	wsAddr := "ws://" + g.WSAddr().String() + network.WS_PATH
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsAddr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"requestId":"r1","action":"ECHO","body":{"n":1}}`))
+	_ = conn.WriteMessage(websocket.BinaryMessage, []byte{0xff, 0x00, 0x01})
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 0; i < 2; i++ {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.Close()
+
+	records, err := capture.ReadFile(conf.CaptureConf.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range records {
+		got = append(got, r.Direction+" "+r.Type)
+		if r.Type == capture.TYPE_BINARY && r.Payload != "/wAB" {
+			t.Errorf("binary payload = %s, want base64", r.Payload)
+		}
+	}
+	want := []string{" open", "in text", "out text", "in binary", "out text"}
+	if len(got) < len(want) || strings.Join(got[:len(want)], ",") != strings.Join(want, ",") {
+		t.Fatalf("records = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name   string
+		ignore []string
+		diffs  int
+	}{
+		{name: "ignore requestId", ignore: []string{"requestId"}},
+		{name: "exact", diffs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := capture.Replay(context.Background(), records, capture.ReplayOption{
+				WS:     network.WSDialOption{Addr: wsAddr},
+				Wait:   time.Second,
+				Ignore: tt.ignore,
+			})
+			if result.Sent != 2 || result.Received != 2 || len(result.Diffs) != tt.diffs || len(result.Errors) > 0 {
+				var buf strings.Builder
+				result.Report(&buf)
+				t.Errorf("Replay() = %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestGate_PCMThrottle(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		closed bool
+	}{
+		// 限流回复不逐帧下发
+		{name: "reject", policy: RATE_LIMIT_POLICY_REJECT},
+		// 持续超限的PCM发送方被断开
+		{name: "disconnect", policy: RATE_LIMIT_POLICY_DISCONNECT, closed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			conf := testConfig(t)
+			conf.RateLimitConf = RateLimitConfOption{
+				Enable:          true,
+				Global:          LimitOption{Rate: 0.1, Burst: 1},
+				Policy:          tt.policy,
+				MaxViolations:   3,
+				ViolationWindow: 10,
+			}
+			p := processer.NewJSONProcesser("requestId", "action", "body")
+			g, err := New(WithConfig(conf), WithProcesser(p), WithWSListener(ln))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.RegisterRouter("PROCESS_PCM", func(requestID string, body []byte, agent interface{}) {
+				g.writeResp(agent.(Session), requestID, "PROCESS_PCM", SUCCESS, SUCCESS_MSG, nil)
+			})
+			if err := g.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer g.Shutdown(context.Background())
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws://"+g.WSAddr().String()+network.WS_PATH, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			for i := 0; i < 10; i++ {
+				if err := conn.WriteMessage(websocket.BinaryMessage, []byte{0x01, 0x02}); err != nil {
+					break
+				}
+			}
+
+			codes := make(map[int]int)
+			_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					var ne net.Error
+					if timeout := errors.As(err, &ne) && ne.Timeout(); timeout == tt.closed {
+						t.Fatalf("ReadMessage() error = %v, want closed %v", err, tt.closed)
+					}
+					break
+				}
+				var resp JsonResponse
+				if err := json.Unmarshal(data, &resp); err != nil {
+					t.Fatal(err)
+				}
+				codes[resp.Code]++
+			}
+			if !tt.closed && (codes[SUCCESS] != 1 || codes[ERR_THROTTLED] != 1) {
+				t.Errorf("response codes = %v, want 1 success and 1 throttled", codes)
+			}
+		})
+	}
+}
+
+func TestGate_Shutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		release bool // 超时前是否放行处理中的请求
+		wantErr bool
+	}{
+		{name: "drained", timeout: 2 * time.Second, release: true},
+		{name: "deadline", timeout: 200 * time.Millisecond, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			conf := testConfig(t)
+			conf.HealthConf.Enable = true
+			conf.DrainConf = DrainConfOption{ReconnectDelay: 1, ReconnectAddr: "ws://standby"}
+			p := processer.NewJSONProcesser("requestId", "action", "body")
+			g, err := New(WithConfig(conf), WithProcesser(p), WithWSListener(ln))
+			if err != nil {
+				t.Fatal(err)
+			}
+			started, release := make(chan struct{}), make(chan struct{})
+			defer close(release)
+			p.RegisterRouter("SLOW", func(requestID string, body []byte, agent interface{}) {
+				close(started)
+				<-release
+				g.writeResp(agent.(Session), requestID, "SLOW", SUCCESS, SUCCESS_MSG, nil)
+			})
+			if err := g.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			base := g.WSAddr().String()
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws://"+base+network.WS_PATH, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"requestId":"r1","action":"SLOW","body":{}}`))
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- g.Shutdown(ctx) }()
+
+			// 先下发下线通知
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+			var resp JsonResponse
+			if err := conn.ReadJSON(&resp); err != nil || resp.Action != ACTION_SERVER_SHUTDOWN {
+				t.Fatalf("notice = %+v, %v", resp, err)
+			}
+			if body, _ := json.Marshal(resp.Body); !strings.Contains(string(body), `"reconnectAddr":"ws://standby"`) {
+				t.Errorf("notice body = %s", body)
+			}
+
+			// 排空期间挂在websocket服务上的/readyz返回503，新的websocket握手被拒绝
+			res, err := http.Get("http://" + base + "/readyz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("/readyz status = %d, want 503", res.StatusCode)
+			}
+			if _, res, err := websocket.DefaultDialer.Dial("ws://"+base+network.WS_PATH, nil); err == nil ||
+				res == nil || res.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("dial during drain error = %v", err)
+			}
+
+			// 处理中的请求未完成时不退出
+			select {
+			case err := <-done:
+				t.Fatalf("Shutdown() returned before request finished: %v", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+			if tt.release {
+				release <- struct{}{}
+			}
+			select {
+			case err := <-done:
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Shutdown() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			case <-time.After(tt.timeout + time.Second):
+				t.Fatal("Shutdown() did not return after deadline")
+			}
+			if tt.release {
+				// 排空后才关闭连接，处理中请求的响应已写出
+				if err := conn.ReadJSON(&resp); err != nil || resp.RequestId != "r1" {
+					t.Errorf("response = %+v, %v", resp, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGate_UpgradeHandoff(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := testConfig(t)
+	conf.OfflineConf.Enable = true
+	conf.OfflineConf.Dir = t.TempDir()
+	p := processer.NewJSONProcesser("requestId", "action", "body")
+	g, err := New(WithConfig(conf), WithProcesser(p), WithWSListener(ln))
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	p.RegisterRouter("SLOW", func(requestID string, body []byte, agent interface{}) {
+		close(started)
+		<-release
+	})
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟平滑重启中的旧进程
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	g.handoff = w
+	released := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, r)
+		close(released)
+	}()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+g.WSAddr().String()+network.WS_PATH, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"requestId":"r1","action":"SLOW","body":{}}`))
+	<-started
+	done := make(chan error, 1)
+	go func() { done <- g.Shutdown(context.Background()) }()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 排空期间离线推送仍然落盘，排空结束前不交出离线存储
+	if err := g.Push("u1", []byte("hello")); err != nil {
+		t.Errorf("Push() during drain error = %v", err)
+	}
+	select {
+	case <-released:
+		t.Fatal("handoff released before drain finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("handoff not released after drain")
+	}
+	store, err := offline.Open(offline.Options{Dir: conf.OfflineConf.Dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if n := store.Pending("u1"); n != 1 {
+		t.Errorf("Pending() = %d, want 1", n)
+	}
+}
+
+func TestGate_AwaitHandoff(t *testing.T) {
+	conf := testConfig(t)
+	conf.WSConf.ListenAddr = "127.0.0.1:0"
+	conf.OfflineConf.Enable = true
+	conf.OfflineConf.Dir = t.TempDir()
+	g, err := New(WithConfig(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟平滑重启的新进程，旧进程交出离线存储前推送等待
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.offlineReady = make(chan struct{})
+	go g.openAfterHandoff(r)
+	pushed := make(chan error, 1)
+	go func() { pushed <- g.Push("u1", []byte("hello")) }()
+	select {
+	case err := <-pushed:
+		t.Fatalf("Push() returned before handoff: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	_ = w.Close()
+	select {
+	case err := <-pushed:
+		if err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Push() blocked after handoff")
+	}
+	if n := g.readyOfflineStore().Pending("u1"); n != 1 {
+		t.Errorf("Pending() = %d, want 1", n)
+	}
+	g.closeOfflineStore()
+}
+
+func TestGate_OfflineDeliver(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := testConfig(t)
+	conf.WSConf.WriteMsgCap = 4
+	conf.OfflineConf.Enable = true
+	conf.OfflineConf.Dir = t.TempDir()
+	conf.OfflineConf.MaxMsgNum = 3
+	conf.AuthConf.Enable = true
+	conf.AuthConf.APIKeys = []auth.APIKey{{Key: "k1", ID: "u1"}}
+	g, err := New(WithConfig(conf), WithWSListener(ln))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Shutdown(context.Background())
+
+	// 上线前的离线消息，以及上线补发期间持续的推送
+	const total = 30
+	for i := 1; i <= 3; i++ {
+		_ = g.Push("u1", []byte(strconv.Itoa(i)))
+	}
+	go func() {
+		for i := 4; i <= total; i++ {
+			_ = g.Push("u1", []byte(strconv.Itoa(i)))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+g.WSAddr().String()+network.WS_PATH+"?token=k1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 补发的消息在实时推送之前按序到达，推送期间离线存储淘汰的消息除外
+	last := 0
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for last < total {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() after %d error = %v", last, err)
+		}
+		n, err := strconv.Atoi(string(data))
+		if err != nil {
+			continue
+		}
+		if n <= last {
+			t.Fatalf("message %d after %d", n, last)
+		}
+		last = n
+	}
+	if n := g.offlineStore.Pending("u1"); n != 0 {
+		t.Errorf("Pending() = %d, want 0", n)
+	}
+
+	// 写队列放不下补发的消息时拒绝启动
+	conf.OfflineConf.MaxMsgNum = conf.WSConf.WriteMsgCap
+	if _, err := New(WithConfig(conf), WithWSListener(ln)); err == nil {
+		t.Error("New() with max_msg_num >= write_msg_cap should fail")
+	}
+}
+
+func TestGate_ReloadApplied(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "server.toml")
+	write := func(maxConn, timeout int) {
+		t.Helper()
+		data := "[ws_conf]\nlisten_addr = \"" + ln.Addr().String() + "\"\nmax_conn_num = " + strconv.Itoa(maxConn) +
+			"\nhttp_timeout = " + strconv.Itoa(timeout) + "\n"
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(100, 10)
+	g, err := New(WithConfigFile(file), WithWSListener(ln))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Shutdown(context.Background())
+
+	// 需要重启的配置项不记入已生效的配置，再次热加载时仍然提示
+	write(5, 20)
+	if err := g.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if g.applied.WSConf.MaxConnMum != 5 || g.WSConf.MaxConnMum != 5 {
+		t.Errorf("max_conn_num applied = %d, config = %d, want 5", g.applied.WSConf.MaxConnMum, g.WSConf.MaxConnMum)
+	}
+	if g.applied.WSConf.HTTPTimeout != 10 || g.WSConf.HTTPTimeout != 10 {
+		t.Errorf("http_timeout applied = %d, config = %d, want 10", g.applied.WSConf.HTTPTimeout, g.WSConf.HTTPTimeout)
+	}
+	if got := diffConf("", reflect.ValueOf(g.applied).Elem(), reflect.ValueOf(&g.Config).Elem()); len(got) != 0 {
+		t.Errorf("applied differs from config: %v", got)
+	}
+}
+
+func TestGate_ReloadAuthz(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	file, rules := filepath.Join(dir, "server.toml"), filepath.Join(dir, "authz.toml")
+	data := "[ws_conf]\nlisten_addr = \"" + ln.Addr().String() + "\"\n[authz_conf]\nenable = true\nrule_file = \"" + rules + "\"\n"
+	if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(rules, []byte("[rules]\nPING = [\"admin\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := New(WithConfigFile(file), WithWSListener(ln))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.authorizer.Allow("PING", nil) {
+		t.Fatal("Allow(PING) before reload = true")
+	}
+
+	// 规则文件非法时整体热加载失败，保留原有规则
+	if err := ioutil.WriteFile(rules, []byte("[rules\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Reload(); err == nil {
+		t.Error("Reload() with invalid rules should fail")
+	}
+	if g.authorizer.Allow("PING", nil) {
+		t.Error("Allow(PING) after failed reload = true")
+	}
+	if err := ioutil.WriteFile(rules, []byte("[rules]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !g.authorizer.Allow("PING", nil) {
+		t.Error("Allow(PING) after reload = false")
+	}
+}
+
+func TestGate_Reloadable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := testConfig(t)
+	conf.RateLimitConf.Enable = true
+	g, err := New(WithConfig(conf), WithWSListener(ln))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Shutdown(context.Background())
+
+	// 启动时未开启的功能需要重启生效
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"log_conf.level", true},
+		{"ws_conf.max_conn_num", true},
+		{"ws_conf.listen_addr", false},
+		{"ws_conf.cer_file", false},
+		{"tcp_conf.chan_cap", false},
+		{"rate_limit_conf.global.rate", true},
+		{"auth_conf.api_keys", false},
+	}
+	for _, tt := range tests {
+		if got := g.reloadable(tt.key); got != tt.want {
+			t.Errorf("reloadable(%s) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
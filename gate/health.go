@@ -0,0 +1,297 @@
+// Author: Vcentor
+// Date: 2026/10/25 3:30 下午
+// desc: 健康检查，/healthz只表示进程存活，/readyz在排空、监听失败或上游不可用时返回503
+// 就绪检查项通过Checker注册，返回json格式的每项检查结果
+// 注册的检查项和上游检查按check_interval缓存结果，连续失败failure_threshold次后才报告失败
+
+package gate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 检查结果
+const (
+	HEALTH_OK      = "ok"
+	HEALTH_FAIL    = "fail"
+	HEALTH_SKIPPED = "skipped"
+)
+
+// ErrCheckSkipped 检查项未配置，不影响就绪状态
+var ErrCheckSkipped = errors.New("not configured")
+
+// HealthConfOption 健康检查配置选项
+type HealthConfOption struct {
+	Enable       bool             `toml:"enable"`
+	LivePath     string           `toml:"live_path" default:"/healthz"`
+	ReadyPath    string           `toml:"ready_path" default:"/readyz"`
+	ListenAddr   string           `toml:"listen_addr" validate:"addr"`                // 为空时挂在websocket服务上
+	CheckTimeout time.Duration    `toml:"check_timeout" default:"2" validate:"min=1"` // 单项检查超时时间，单位s
+	Upstreams    []UpstreamOption `toml:"upstreams"`
+
+	CheckInterval    time.Duration `toml:"check_interval" default:"10" validate:"min=1"`   // 检查结果缓存时间，单位s
+	FailureThreshold int           `toml:"failure_threshold" default:"3" validate:"min=1"` // 连续失败多少次后报告失败
+	BusinessChecks   bool          `toml:"business_checks"`                                // 检查业务配置的上游地址，默认不检查
+}
+
+// Validate 校验检查路径和上游服务
+func (conf *HealthConfOption) Validate() error {
+	for _, p := range []string{conf.LivePath, conf.ReadyPath} {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("path %q must start with /", p)
+		}
+	}
+	for _, u := range conf.Upstreams {
+		if u.Name == "" {
+			return errors.New("upstream name is required")
+		}
+		if _, err := url.Parse(u.URL); err != nil {
+			return fmt.Errorf("upstream %s: %w", u.Name, err)
+		}
+	}
+	return nil
+}
+
+// UpstreamOption 上游服务，http(s)地址发送HEAD请求，ws(s)或tcp地址建立tcp连接
+type UpstreamOption struct {
+	Name string `toml:"name"`
+	URL  string `toml:"url"`
+}
+
+// Checker 就绪检查项，返回ErrCheckSkipped时不影响就绪状态
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// checkFunc 函数形式的检查项
+type checkFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (c *checkFunc) Name() string {
+	return c.name
+}
+
+func (c *checkFunc) Check(ctx context.Context) error {
+	return c.fn(ctx)
+}
+
+// CheckFunc 把函数包装为检查项
+func CheckFunc(name string, fn func(ctx context.Context) error) Checker {
+	return &checkFunc{name: name, fn: fn}
+}
+
+// URLChecker 检查上游地址是否可达，地址通过函数获取，配置热加载后使用新地址，为空时跳过
+func URLChecker(name string, rawURL func() string) Checker {
+	return CheckFunc(name, func(ctx context.Context) error {
+		return checkURL(ctx, rawURL())
+	})
+}
+
+// checkURL http(s)地址返回5xx时不可用，其他协议只检查tcp连接
+func checkURL(ctx context.Context, rawURL string) error {
+	if rawURL == "" {
+		return ErrCheckSkipped
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	case "ws", "wss", "tcp":
+		host := u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "wss" {
+				port = "443"
+			}
+			host = net.JoinHostPort(u.Hostname(), port)
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	return fmt.Errorf("unsupported scheme %q", u.Scheme)
+}
+
+// cachedChecker 缓存检查结果，避免每次探测都请求上游，连续失败达到阈值前沿用上次的结果
+type cachedChecker struct {
+	Checker
+	interval  time.Duration
+	threshold int
+	mutex     sync.Mutex
+	checked   time.Time
+	failures  int
+	err       error
+}
+
+func (c *cachedChecker) Check(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.checked.IsZero() && time.Since(c.checked) < c.interval {
+		return c.err
+	}
+	err := c.Checker.Check(ctx)
+	c.checked = time.Now()
+	if err == nil || errors.Is(err, ErrCheckSkipped) {
+		c.failures, c.err = 0, err
+		return c.err
+	}
+	if c.failures++; c.failures >= c.threshold {
+		c.err = err
+	}
+	return c.err
+}
+
+// AddChecker 注册就绪检查项，需要在Start之前调用
+func (gate *Gate) AddChecker(checkers ...Checker) {
+	gate.checkers = append(gate.checkers, checkers...)
+}
+
+// WithChecker 就绪检查项
+func WithChecker(checkers ...Checker) Option {
+	return func(gate *Gate) {
+		gate.AddChecker(checkers...)
+	}
+}
+
+// fail 记录启动后监听失败的错误，并通过Err通知调用方
+func (gate *Gate) fail(err error) {
+	gate.failMutex.Lock()
+	if gate.failure == nil {
+		gate.failure = err
+	}
+	gate.failMutex.Unlock()
+	select {
+	case gate.errs <- err:
+	default:
+	}
+}
+
+// readyCheckers 内置检查项和注册的检查项，第一次检查时创建，之后沿用缓存的结果
+func (gate *Gate) readyCheckers() []Checker {
+	gate.checkOnce.Do(func() {
+		gate.readyChecks = gate.newReadyCheckers()
+	})
+	return gate.readyChecks
+}
+
+// newReadyCheckers 内置检查项不缓存，上游和注册的检查项按配置缓存结果
+func (gate *Gate) newReadyCheckers() []Checker {
+	checkers := []Checker{
+		CheckFunc("draining", func(context.Context) error {
+			if gate.Draining() {
+				return errors.New("gate is draining")
+			}
+			return nil
+		}),
+		CheckFunc("listener", func(context.Context) error {
+			gate.failMutex.Lock()
+			defer gate.failMutex.Unlock()
+			return gate.failure
+		}),
+	}
+	var external []Checker
+	for _, u := range gate.HealthConf.Upstreams {
+		rawURL := u.URL
+		external = append(external, URLChecker(u.Name, func() string { return rawURL }))
+	}
+	for _, c := range append(external, gate.checkers...) {
+		checkers = append(checkers, &cachedChecker{
+			Checker:   c,
+			interval:  gate.HealthConf.CheckInterval * time.Second,
+			threshold: gate.HealthConf.FailureThreshold,
+		})
+	}
+	return checkers
+}
+
+// CheckResult 单项检查结果
+type CheckResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration int64  `json:"durationMs"`
+}
+
+// HealthReport 健康检查结果
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Ready 执行所有就绪检查，检查项并发执行，单项超时为check_timeout
+func (gate *Gate) Ready(ctx context.Context) HealthReport {
+	checkers := gate.readyCheckers()
+	results := make([]CheckResult, len(checkers))
+	var wg sync.WaitGroup
+	for i, c := range checkers {
+		wg.Add(1)
+		go func(i int, c Checker) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, gate.HealthConf.CheckTimeout*time.Second)
+			defer cancel()
+			start := time.Now()
+			err := c.Check(ctx)
+			res := CheckResult{Name: c.Name(), Status: HEALTH_OK, Duration: time.Since(start).Milliseconds()}
+			switch {
+			case errors.Is(err, ErrCheckSkipped):
+				res.Status = HEALTH_SKIPPED
+			case err != nil:
+				res.Status, res.Error = HEALTH_FAIL, err.Error()
+			}
+			results[i] = res
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HEALTH_OK, Checks: results}
+	for _, res := range results {
+		if res.Status == HEALTH_FAIL {
+			report.Status = HEALTH_FAIL
+		}
+	}
+	return report
+}
+
+// serveLive 进程存活即返回200
+func (gate *Gate) serveLive(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, HealthReport{Status: HEALTH_OK})
+}
+
+// serveReady 所有检查通过返回200，否则返回503
+func (gate *Gate) serveReady(w http.ResponseWriter, r *http.Request) {
+	report := gate.Ready(r.Context())
+	status := http.StatusOK
+	if report.Status != HEALTH_OK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,103 @@
+// Author: Vcentor
+// Date: 2026/10/24 11:00 上午
+// desc: 会话生命周期回调，业务方在连接建立、鉴权通过、断开和出错时执行清理、统计等逻辑
+// 回调在连接的协程中同步执行，耗时操作需要自行异步处理
+
+package gate
+
+import (
+	"socketserver/auth"
+	"socketserver/library/capture"
+	"socketserver/network"
+	"sync/atomic"
+	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// 网关断开连接的原因，传输层的原因见network.CLOSE_*
+const (
+	CLOSE_PROTOCOL_ERROR  = "protocol_error"  // 请求格式错误或路由失败
+	CLOSE_THROTTLED       = "throttled"       // 超限次数过多
+	CLOSE_UNAUTHENTICATED = "unauthenticated" // 握手鉴权失败
+	CLOSE_KICKED          = "kicked"          // 被管理接口踢掉
+)
+
+// Hooks 会话生命周期回调，未设置的回调不执行
+type Hooks struct {
+	OnConnect       func(s Session)                    // 连接建立，加入会话池之后
+	OnAuthenticated func(s Session, p *auth.Principal) // 鉴权通过
+	OnDisconnect    func(s Session, reason string)     // 连接断开，移出会话池之后，每个会话只调用一次
+	OnError         func(s Session, err error)         // 请求解析、路由或读写失败
+}
+
+// AddHooks 注册会话生命周期回调，需要在Start之前调用，多次注册时按注册顺序执行
+func (gate *Gate) AddHooks(hooks Hooks) {
+	gate.hooks = append(gate.hooks, hooks)
+}
+
+// WithHooks 会话生命周期回调
+func WithHooks(hooks Hooks) Option {
+	return func(gate *Gate) {
+		gate.AddHooks(hooks)
+	}
+}
+
+// runHook 执行回调，回调panic时记录日志，不影响连接处理
+func (gate *Gate) runHook(name string, s Session, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			gate.logger.Error(s.Context(), "Session hook panic", logit.String("hook", name),
+				logit.AutoField("panic", r))
+		}
+	}()
+	fn()
+}
+
+// connected 连接建立
+func (gate *Gate) connected(s Session) {
+	ctx := logit.NewContext(gate.Ctx)
+	logit.AddAllLevel(ctx, logit.String("sessionId", s.SessionID()), logit.String("transport", s.Transport()),
+		logit.String("remoteAddr", s.RemoteAddr().String()))
+	s.setContext(ctx)
+	atomic.StoreInt64(&s.stats().connectedAt, time.Now().UnixNano())
+	gate.metrics.sessionConnected(s)
+	gate.recordEvent(s, capture.TYPE_OPEN, s.RemoteAddr().String())
+	for _, h := range gate.hooks {
+		if h.OnConnect != nil {
+			gate.runHook("OnConnect", s, func() { h.OnConnect(s) })
+		}
+	}
+}
+
+// authenticated 鉴权通过
+func (gate *Gate) authenticated(s Session, p *auth.Principal) {
+	for _, h := range gate.hooks {
+		if h.OnAuthenticated != nil {
+			gate.runHook("OnAuthenticated", s, func() { h.OnAuthenticated(s, p) })
+		}
+	}
+}
+
+// sessionError 会话出错
+func (gate *Gate) sessionError(s Session, err error) {
+	for _, h := range gate.hooks {
+		if h.OnError != nil {
+			gate.runHook("OnError", s, func() { h.OnError(s, err) })
+		}
+	}
+}
+
+// disconnected 连接断开，读写失败时先调用OnError
+func (gate *Gate) disconnected(s Session, reason string, err error) {
+	if err != nil && (reason == network.CLOSE_READ_ERROR || reason == network.CLOSE_WRITE_ERROR) {
+		gate.sessionError(s, err)
+	}
+	gate.metrics.sessionDisconnected(s, reason)
+	gate.recordEvent(s, capture.TYPE_CLOSE, reason)
+	for _, h := range gate.hooks {
+		if h.OnDisconnect != nil {
+			gate.runHook("OnDisconnect", s, func() { h.OnDisconnect(s, reason) })
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Author: Vcentor
+// Date: 2026/10/25 3:00 下午
+// desc: 指标、健康检查和管理接口的http路由，按监听地址分组，空地址挂在websocket服务上
+
+package gate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"socketserver/network"
+	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// httpRoute 额外的http路由
+type httpRoute struct {
+	addr    string
+	pattern string
+	handler http.Handler
+}
+
+// httpRoutes 开启的http路由
+func (gate *Gate) httpRoutes() []httpRoute {
+	var routes []httpRoute
+	if gate.MetricsConf.Enable {
+		routes = append(routes, httpRoute{gate.MetricsConf.ListenAddr, gate.MetricsConf.Path, gate.registry})
+	}
+	if gate.HealthConf.Enable {
+		routes = append(routes,
+			httpRoute{gate.HealthConf.ListenAddr, gate.HealthConf.LivePath, http.HandlerFunc(gate.serveLive)},
+			httpRoute{gate.HealthConf.ListenAddr, gate.HealthConf.ReadyPath, http.HandlerFunc(gate.serveReady)})
+	}
+	if gate.AdminConf.Enable {
+		routes = append(routes, httpRoute{gate.AdminConf.ListenAddr, adminPrefix, gate.adminHandler()})
+	}
+	return routes
+}
+
+// checkHTTP 挂在websocket服务上时需要启动websocket服务，同一地址的路径不能重复
+func (conf *Config) checkHTTP() error {
+	type key struct{ addr, path string }
+	var seen = make(map[key]string)
+	for _, r := range []struct {
+		name   string
+		enable bool
+		addr   string
+		paths  []string
+	}{
+		{"metrics_conf", conf.MetricsConf.Enable, conf.MetricsConf.ListenAddr, []string{conf.MetricsConf.Path}},
+		{"health_conf", conf.HealthConf.Enable, conf.HealthConf.ListenAddr, []string{conf.HealthConf.LivePath, conf.HealthConf.ReadyPath}},
+		{"admin_conf", conf.AdminConf.Enable, conf.AdminConf.ListenAddr, []string{adminPrefix}},
+	} {
+		if !r.enable {
+			continue
+		}
+		if r.addr == "" && conf.WSConf.ListenAddr == "" {
+			return errors.New(r.name + ".listen_addr is required when websocket server is disabled")
+		}
+		for _, p := range r.paths {
+			if other, ok := seen[key{r.addr, p}]; ok {
+				return fmt.Errorf("%s path %s conflicts with %s", r.name, p, other)
+			}
+			seen[key{r.addr, p}] = r.name
+		}
+	}
+	return nil
+}
+
+// httpMuxes 按监听地址生成路由
+func (gate *Gate) httpMuxes() map[string]*http.ServeMux {
+	var muxes = make(map[string]*http.ServeMux)
+	for _, r := range gate.httpRoutes() {
+		mux, ok := muxes[r.addr]
+		if !ok {
+			mux = http.NewServeMux()
+			muxes[r.addr] = mux
+		}
+		mux.Handle(r.pattern, r.handler)
+	}
+	return muxes
+}
+
+// wsHTTPHandler 挂在websocket服务上的路由，没有时返回nil
+func wsHTTPHandler(muxes map[string]*http.ServeMux) http.Handler {
+	if mux, ok := muxes[""]; ok {
+		return mux
+	}
+	return nil
+}
+
+// startHTTPServers 启动单独监听的http服务
+func (gate *Gate) startHTTPServers(muxes map[string]*http.ServeMux) error {
+	gate.httpServers = make(map[string]*http.Server)
+	for addr, mux := range muxes {
+		if addr == "" {
+			continue
+		}
+		ln, err := network.Listen(addr)
+		if err != nil {
+			return fmt.Errorf("start http server %s: %w", addr, err)
+		}
+		server := &http.Server{
+			Addr:         ln.Addr().String(),
+			Handler:      mux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		gate.httpServers[addr] = server
+		go func(server *http.Server) {
+			if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+				gate.fail(fmt.Errorf("http server %s: %w", server.Addr, err))
+			}
+		}(server)
+		gate.logger.Notice(gate.Ctx, "HTTP server started", logit.String("addr", server.Addr))
+	}
+	return nil
+}
+
+// stopHTTPServers 关闭单独监听的http服务
+func (gate *Gate) stopHTTPServers() {
+	for _, server := range gate.httpServers {
+		_ = server.Close()
+	}
+}
@@ -0,0 +1,156 @@
+// Author: Vcentor
+// Date: 2026/10/24 5:00 下午
+// desc: 网关指标，连接数、拒绝原因、消息收发、写队列和请求耗时，以Prometheus文本格式输出
+// 可以挂在websocket服务的http路径上，也可以单独监听管理端口
+
+package gate
+
+import (
+	"fmt"
+	"socketserver/library/capture"
+	"socketserver/library/metrics"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// METRICS_NAMESPACE 指标名前缀
+const METRICS_NAMESPACE = "socketserver_"
+
+// ACTION_UNKNOWN 路由失败时的action标签，避免非法action导致标签无限增长
+const ACTION_UNKNOWN = "UNKNOWN"
+
+// MetricsConfOption 指标配置选项
+type MetricsConfOption struct {
+	Enable     bool   `toml:"enable"`
+	Path       string `toml:"path" default:"/metrics"`
+	ListenAddr string `toml:"listen_addr" validate:"addr"` // 为空时挂在websocket服务上，与健康检查或管理接口地址相同时共用端口
+}
+
+// Validate 校验指标路径
+func (conf *MetricsConfOption) Validate() error {
+	if !strings.HasPrefix(conf.Path, "/") {
+		return fmt.Errorf("path %q must start with /", conf.Path)
+	}
+	return nil
+}
+
+// gateMetrics 网关指标
+type gateMetrics struct {
+	connections     *metrics.Gauge
+	accepts         *metrics.Counter
+	rejects         *metrics.Counter
+	disconnects     *metrics.Counter
+	messagesIn      *metrics.Counter
+	messagesOut     *metrics.Counter
+	bytesIn         *metrics.Counter
+	bytesOut        *metrics.Counter
+	dropped         *metrics.Counter
+	writeQueueDepth *metrics.Gauge
+	requests        *metrics.Counter
+	requestDuration *metrics.Histogram
+}
+
+// initMetrics 注册网关指标
+func (gate *Gate) initMetrics() {
+	r := metrics.NewRegistry()
+	gate.registry = r
+	gate.metrics = &gateMetrics{
+		connections: r.NewGauge(METRICS_NAMESPACE+"connections",
+			"Active connections.", "transport"),
+		accepts: r.NewCounter(METRICS_NAMESPACE+"accepts_total",
+			"Accepted connections.", "transport"),
+		rejects: r.NewCounter(METRICS_NAMESPACE+"rejects_total",
+			"Rejected connections by reason.", "transport", "reason"),
+		disconnects: r.NewCounter(METRICS_NAMESPACE+"disconnects_total",
+			"Closed connections by reason.", "transport", "reason"),
+		messagesIn: r.NewCounter(METRICS_NAMESPACE+"messages_in_total",
+			"Inbound messages.", "transport"),
+		messagesOut: r.NewCounter(METRICS_NAMESPACE+"messages_out_total",
+			"Outbound messages.", "transport"),
+		bytesIn: r.NewCounter(METRICS_NAMESPACE+"bytes_in_total",
+			"Inbound message bytes.", "transport"),
+		bytesOut: r.NewCounter(METRICS_NAMESPACE+"bytes_out_total",
+			"Outbound message bytes.", "transport"),
+		dropped: r.NewCounter(METRICS_NAMESPACE+"dropped_messages_total",
+			"Outbound messages dropped because the connection is closed or too slow.", "transport"),
+		writeQueueDepth: r.NewGauge(METRICS_NAMESPACE+"write_queue_depth",
+			"Messages waiting to be written.", "transport"),
+		requests: r.NewCounter(METRICS_NAMESPACE+"requests_total",
+			"Dispatched requests by action and gate code.", "action", "code"),
+		requestDuration: r.NewHistogram(METRICS_NAMESPACE+"request_duration_seconds",
+			"Request handling latency.", metrics.DefBuckets, "action"),
+	}
+	// 写队列深度在采集时汇总
+	r.OnCollect(func() {
+		var depth = map[string]int{TRANSPORT_WS: 0, TRANSPORT_TCP: 0}
+		for _, s := range gate.Sessions.Sessions() {
+			depth[s.Transport()] += s.PendingWrites()
+		}
+		for transport, n := range depth {
+			gate.metrics.writeQueueDepth.Set(float64(n), transport)
+		}
+	})
+}
+
+// Metrics 网关指标注册表，业务方可以注册自定义指标
+func (gate *Gate) Metrics() *metrics.Registry {
+	return gate.registry
+}
+
+// rejectFunc 拒绝连接时计数
+func (gate *Gate) rejectFunc(transport string) func(reason string) {
+	return func(reason string) {
+		gate.metrics.rejects.Inc(transport, reason)
+	}
+}
+
+// sessionConnected 连接建立计数
+func (m *gateMetrics) sessionConnected(s Session) {
+	m.accepts.Inc(s.Transport())
+	m.connections.Inc(s.Transport())
+}
+
+// sessionDisconnected 连接断开计数
+func (m *gateMetrics) sessionDisconnected(s Session, reason string) {
+	m.connections.Dec(s.Transport())
+	m.disconnects.Inc(s.Transport(), reason)
+}
+
+// received 收到消息计数并抓包，messageType为websocket帧类型，tcp为0
+func (gate *Gate) received(s Session, messageType int, data []byte) {
+	n := len(data)
+	st := s.stats()
+	atomic.AddInt64(&st.messagesIn, 1)
+	atomic.AddInt64(&st.bytesIn, int64(n))
+	gate.metrics.messagesIn.Inc(s.Transport())
+	gate.metrics.bytesIn.Add(float64(n), s.Transport())
+	gate.record(s, capture.DIR_IN, messageType, data)
+}
+
+// sent 发送消息计数并抓包，发送失败时计为丢弃，websocket只发送文本消息
+func (gate *Gate) sent(s Session, b []byte, err error) {
+	n := len(b)
+	st := s.stats()
+	if err != nil {
+		atomic.AddInt64(&st.dropped, 1)
+		gate.metrics.dropped.Inc(s.Transport())
+		return
+	}
+	messageType := 0
+	if s.Transport() == TRANSPORT_WS {
+		messageType = TEXT_MESSAGE
+	}
+	gate.record(s, capture.DIR_OUT, messageType, b)
+	atomic.AddInt64(&st.messagesOut, 1)
+	atomic.AddInt64(&st.bytesOut, int64(n))
+	gate.metrics.messagesOut.Inc(s.Transport())
+	gate.metrics.bytesOut.Add(float64(n), s.Transport())
+}
+
+// requestDone 请求计数和耗时
+func (m *gateMetrics) requestDone(action string, code int, start time.Time) {
+	m.requests.Inc(action, strconv.Itoa(code))
+	m.requestDuration.Observe(time.Since(start).Seconds(), action)
+}
@@ -0,0 +1,183 @@
+// Author: Vcentor
+// Date: 2026/10/19 11:20 上午
+// desc: 用户消息推送，用户离线时存入离线存储，上线后补发
+
+package gate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"socketserver/env"
+	"socketserver/library/offline"
+	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// OFFLINE_WRITE_TIMEOUT 补发单条离线消息的超时时间，超时后剩余消息留到下次上线补发
+const OFFLINE_WRITE_TIMEOUT = 5 * time.Second
+
+// OfflineConfOption 离线消息配置选项
+type OfflineConfOption struct {
+	Enable          bool          `toml:"enable"`
+	Dir             string        `toml:"dir"` // 存储目录，为空时使用data目录下的offline，同一进程运行多个网关时需要分别指定
+	TTL             time.Duration `toml:"ttl" validate:"min=0"`
+	MaxMsgNum       int           `toml:"max_msg_num" default:"50" validate:"min=0"`
+	MaxMsgBytes     int           `toml:"max_msg_bytes" default:"1048576" validate:"min=0"`
+	CompactInterval time.Duration `toml:"compact_interval" default:"600" validate:"min=0"`
+	Sync            bool          `toml:"sync"`
+}
+
+// dir 存储目录
+func (conf OfflineConfOption) dir() (string, error) {
+	if conf.Dir != "" {
+		return conf.Dir, nil
+	}
+	dir, err := env.DataPath()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "offline"), nil
+}
+
+// checkOffline 开启离线消息时，补发的消息数加上鉴权响应需要放得下写队列
+func (conf *Config) checkOffline() error {
+	if !conf.OfflineConf.Enable {
+		return nil
+	}
+	if conf.OfflineConf.MaxMsgNum <= 0 {
+		return errors.New("offline_conf.max_msg_num is required when offline_conf.enable is true")
+	}
+	if conf.WSConf.ListenAddr != "" && conf.OfflineConf.MaxMsgNum >= conf.WSConf.WriteMsgCap {
+		return fmt.Errorf("offline_conf.max_msg_num %d must be less than ws_conf.write_msg_cap %d",
+			conf.OfflineConf.MaxMsgNum, conf.WSConf.WriteMsgCap)
+	}
+	if conf.TCPConf.ListenAddr != "" && conf.OfflineConf.MaxMsgNum >= conf.TCPConf.ChanCap {
+		return fmt.Errorf("offline_conf.max_msg_num %d must be less than tcp_conf.chan_cap %d",
+			conf.OfflineConf.MaxMsgNum, conf.TCPConf.ChanCap)
+	}
+	return nil
+}
+
+// openOfflineStore 打开离线存储
+func (gate *Gate) openOfflineStore() error {
+	if !gate.OfflineConf.Enable {
+		return nil
+	}
+	dir, err := gate.OfflineConf.dir()
+	if err != nil {
+		return err
+	}
+	store, err := offline.Open(offline.Options{
+		Dir:             dir,
+		TTL:             gate.OfflineConf.TTL * time.Second,
+		MaxMsgNum:       gate.OfflineConf.MaxMsgNum,
+		MaxBytes:        gate.OfflineConf.MaxMsgBytes,
+		CompactInterval: gate.OfflineConf.CompactInterval * time.Second,
+		Sync:            gate.OfflineConf.Sync,
+	})
+	if err != nil {
+		return err
+	}
+	gate.offlineStore = store
+	return nil
+}
+
+// readyOfflineStore 离线存储，平滑重启的新进程等旧进程交出离线存储后返回，未开启或打开失败时返回nil
+func (gate *Gate) readyOfflineStore() *offline.Store {
+	if gate.offlineReady != nil {
+		<-gate.offlineReady
+	}
+	return gate.offlineStore
+}
+
+// closeOfflineStore 关闭离线存储
+func (gate *Gate) closeOfflineStore() {
+	if gate.readyOfflineStore() == nil {
+		return
+	}
+	if err := gate.offlineStore.Close(); err != nil {
+		gate.logger.Warning(gate.Ctx, "Close offline store failed", logit.Error("error", err))
+	}
+}
+
+// Push 向用户推送消息，用户不在线或离线消息还在补发时存入离线存储
+// 平滑重启的新进程在旧进程交出离线存储前，存入离线存储的推送会等待
+func (gate *Gate) Push(uid string, b []byte) error {
+	// 与Login绑定会话互斥，补发完成前的消息都进入离线存储，保证按序到达
+	gate.pushMutex.RLock()
+	defer gate.pushMutex.RUnlock()
+	var delivered bool
+	for _, s := range gate.Sessions.UserSessions(uid) {
+		if err := s.WriteMsg(b); err == nil {
+			delivered = true
+		}
+	}
+	if delivered {
+		return nil
+	}
+	store := gate.readyOfflineStore()
+	if store == nil {
+		return errors.New("user " + uid + " is offline")
+	}
+	return store.Put(uid, b)
+}
+
+// Login 用户鉴权成功后补发离线消息，补发完成后再绑定会话接收实时推送
+// 补发时写队列满会等待，消息写入连接后才从离线存储删除
+func (gate *Gate) Login(uid string, s Session) {
+	store := gate.readyOfflineStore()
+	if store == nil {
+		gate.Sessions.Bind(uid, s)
+		return
+	}
+	send := func(b []byte) error {
+		ctx, cancel := context.WithTimeout(gate.Ctx, OFFLINE_WRITE_TIMEOUT)
+		defer cancel()
+		return s.WriteMsgContext(ctx, b)
+	}
+	var (
+		total    int
+		err      error
+		deadline = time.Now().Add(OFFLINE_WRITE_TIMEOUT)
+	)
+	for {
+		var n int
+		n, err = store.Deliver(uid, send)
+		total += n
+		if err != nil {
+			break
+		}
+		// 补发期间新推送的消息也进入了离线存储，全部补发完才绑定
+		gate.pushMutex.Lock()
+		if store.Pending(uid) == 0 {
+			gate.Sessions.Bind(uid, s)
+			gate.pushMutex.Unlock()
+			break
+		}
+		gate.pushMutex.Unlock()
+		if n > 0 {
+			deadline = time.Now().Add(OFFLINE_WRITE_TIMEOUT)
+			continue
+		}
+		// 同一用户的其他会话正在补发，等待其完成
+		if time.Now().After(deadline) {
+			err = errors.New("wait for another session delivering timeout")
+			break
+		}
+		time.Sleep(drainPollInterval)
+	}
+	if err != nil {
+		// 补发失败时剩余消息留在离线存储，会话仍然接收实时推送
+		gate.Sessions.Bind(uid, s)
+		gate.logger.Warning(s.Context(), "Deliver offline message failed",
+			logit.String("uid", uid), logit.Int("delivered", total), logit.Error("error", err))
+		return
+	}
+	if total > 0 {
+		gate.logger.Notice(s.Context(), "Deliver offline message",
+			logit.String("uid", uid), logit.Int("delivered", total))
+	}
+}
@@ -0,0 +1,87 @@
+// Author: Vcentor
+// Date: 2026/10/23 3:10 下午
+// desc: 网关构建选项，作为库嵌入其他服务时使用
+
+package gate
+
+import (
+	"context"
+	"net"
+	"socketserver/auth"
+	"socketserver/processer"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// Option 网关构建选项
+type Option func(gate *Gate)
+
+// WithProcesser 消息处理器，默认为requestId、action、body字段的JSON处理器
+func WithProcesser(p processer.ProcesserOpt) Option {
+	return func(gate *Gate) {
+		gate.Processer = p
+	}
+}
+
+// WithConfigFile 配置文件路径，默认为env.ServerConfFile()，支持热加载
+func WithConfigFile(file string) Option {
+	return func(gate *Gate) {
+		gate.confFile = file
+	}
+}
+
+// WithConfig 直接使用配置，不读取配置文件，不支持热加载，conf可以通过NewConfig创建
+func WithConfig(conf *Config) Option {
+	return func(gate *Gate) {
+		gate.conf = conf
+	}
+}
+
+// WithWSListener websocket服务使用已创建的listener，ws_conf.listen_addr为空时使用listener地址
+func WithWSListener(ln net.Listener) Option {
+	return func(gate *Gate) {
+		gate.wsListener = ln
+	}
+}
+
+// WithTCPListener tcp服务使用已创建的listener，tcp_conf.listen_addr为空时使用listener地址
+func WithTCPListener(ln net.Listener) Option {
+	return func(gate *Gate) {
+		gate.tcpListener = ln
+	}
+}
+
+// WithLogger 网关和连接的日志，默认为wslog.Logger，log_conf.level只对wslog.NewLevelLogger包装的logger生效
+func WithLogger(logger logit.Logger) Option {
+	return func(gate *Gate) {
+		gate.logger = logger
+	}
+}
+
+// WithAuthenticator 自定义鉴权，忽略auth_conf中的凭证配置，热加载时不替换
+func WithAuthenticator(a auth.Authenticator) Option {
+	return func(gate *Gate) {
+		gate.customAuth = a
+	}
+}
+
+// WithMiddleware 业务中间件，在限流、鉴权和授权之后执行
+func WithMiddleware(middlewares ...processer.Middleware) Option {
+	return func(gate *Gate) {
+		gate.middlewares = append(gate.middlewares, middlewares...)
+	}
+}
+
+// WithOnStart 服务启动后调用，返回错误时Start失败并关闭服务
+func WithOnStart(fn func(ctx context.Context) error) Option {
+	return func(gate *Gate) {
+		gate.onStart = append(gate.onStart, fn)
+	}
+}
+
+// WithOnShutdown 优雅退出关闭所有连接后调用，错误由Shutdown返回
+func WithOnShutdown(fn func(ctx context.Context) error) Option {
+	return func(gate *Gate) {
+		gate.onShutdown = append(gate.onShutdown, fn)
+	}
+}
@@ -0,0 +1,206 @@
+// Author: Vcentor
+// Date: 2026/10/20 11:00 上午
+// desc: 请求限流，按会话、action和身份限流，超限后拒绝请求或断开连接
+
+package gate
+
+import (
+	"errors"
+	"fmt"
+	"socketserver/library/ratelimit"
+	"socketserver/processer"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 限流策略
+const (
+	RATE_LIMIT_POLICY_REJECT     = "reject"     // 返回限流错误码
+	RATE_LIMIT_POLICY_DISCONNECT = "disconnect" // 窗口内多次超限后断开连接
+)
+
+// 限流维度
+const (
+	RATE_LIMIT_SCOPE_GLOBAL    = "global"
+	RATE_LIMIT_SCOPE_ACTION    = "action"
+	RATE_LIMIT_SCOPE_PRINCIPAL = "principal"
+)
+
+// 会话属性中保存限流状态的key
+const (
+	attrRateLimitGlobal     = "ratelimit.global"
+	attrRateLimitAction     = "ratelimit.action."
+	attrRateLimitViolations = "ratelimit.violations"
+	attrRateLimitNotice     = "ratelimit.notice"
+)
+
+// THROTTLED_NOTICE_INTERVAL 二进制帧被限流时回复ERR_THROTTLED的最小间隔
+const THROTTLED_NOTICE_INTERVAL = time.Second
+
+// LimitOption 限流参数
+type LimitOption struct {
+	Rate  float64 `toml:"rate" validate:"min=0"`  // 每秒请求数，0不限流
+	Burst int     `toml:"burst" validate:"min=0"` // 允许的突发请求数，0时等于rate
+}
+
+// RateLimitConfOption 限流配置选项
+type RateLimitConfOption struct {
+	Enable          bool                   `toml:"enable"`
+	Global          LimitOption            `toml:"global"`                                                     // 每个会话所有action共享
+	Actions         map[string]LimitOption `toml:"actions"`                                                    // 每个会话单个action
+	Principal       LimitOption            `toml:"principal"`                                                  // 同一身份的所有会话共享
+	Policy          string                 `toml:"policy" default:"reject" validate:"oneof=reject disconnect"` // reject或disconnect
+	MaxViolations   int                    `toml:"max_violations" default:"10" validate:"min=1"`               // disconnect策略下窗口内允许的超限次数
+	ViolationWindow time.Duration          `toml:"violation_window" default:"10" validate:"min=1"`             // 超限次数统计窗口，单位s
+}
+
+// rateLimiter 网关限流器，热加载时整体替换
+type rateLimiter struct {
+	conf       RateLimitConfOption
+	principals *ratelimit.Keyed
+	hits       *sync.Map // scope -> *int64，替换时沿用
+}
+
+// violations 会话超限记录
+type violations struct {
+	mutex sync.Mutex
+	start time.Time
+	count int
+}
+
+// initRateLimit 初始化限流，限流中间件需要在鉴权之前执行
+func (gate *Gate) initRateLimit() error {
+	if !gate.RateLimitConf.Enable {
+		return nil
+	}
+	l, err := newRateLimiter(gate.RateLimitConf, nil)
+	if err != nil {
+		return err
+	}
+	gate.RateLimitConf = l.conf
+	gate.rateLimit.Store(l)
+	gate.chain = append(gate.chain, gate.rateLimitMiddleware)
+	return nil
+}
+
+// newRateLimiter 校验配置并实例化限流器，old不为空时沿用统计数据和未变化的身份限流状态
+func newRateLimiter(conf RateLimitConfOption, old *rateLimiter) (*rateLimiter, error) {
+	switch conf.Policy {
+	case "":
+		conf.Policy = RATE_LIMIT_POLICY_REJECT
+	case RATE_LIMIT_POLICY_REJECT, RATE_LIMIT_POLICY_DISCONNECT:
+	default:
+		return nil, errors.New("invalid rate limit policy: " + conf.Policy)
+	}
+	if conf.MaxViolations <= 0 {
+		conf.MaxViolations = 10
+	}
+	if conf.ViolationWindow <= 0 {
+		conf.ViolationWindow = 10
+	}
+	l := &rateLimiter{conf: conf, hits: new(sync.Map)}
+	if old != nil {
+		l.hits = old.hits
+		if old.conf.Principal == conf.Principal {
+			l.principals = old.principals
+		}
+	}
+	if conf.Principal.Rate > 0 && l.principals == nil {
+		l.principals = ratelimit.NewKeyed(conf.Principal.Rate, conf.Principal.Burst)
+	}
+	return l, nil
+}
+
+// limiter 当前限流器，未开启限流时返回nil
+func (gate *Gate) limiter() *rateLimiter {
+	l, _ := gate.rateLimit.Load().(*rateLimiter)
+	return l
+}
+
+// rateLimitMiddleware 超限时返回ErrThrottled
+func (gate *Gate) rateLimitMiddleware(next processer.HandlerFunc) processer.HandlerFunc {
+	return func(p processer.Processer, agent interface{}) error {
+		s, ok := agent.(Session)
+		if !ok {
+			return next(p, agent)
+		}
+		if scope := gate.limiter().check(s, p.Action); scope != "" {
+			return fmt.Errorf("%w by %s limit", processer.ErrThrottled, scope)
+		}
+		return next(p, agent)
+	}
+}
+
+// check 依次检查会话、action和身份限流，返回超限的维度
+func (l *rateLimiter) check(s Session, action string) string {
+	if l.conf.Global.Rate > 0 && !sessionBucket(s, attrRateLimitGlobal, l.conf.Global).Allow() {
+		return l.hit(RATE_LIMIT_SCOPE_GLOBAL)
+	}
+	if opt, ok := l.conf.Actions[action]; ok && opt.Rate > 0 &&
+		!sessionBucket(s, attrRateLimitAction+action, opt).Allow() {
+		return l.hit(RATE_LIMIT_SCOPE_ACTION)
+	}
+	if l.principals != nil {
+		if p := s.Principal(); p != nil && !l.principals.Allow(p.ID) {
+			return l.hit(RATE_LIMIT_SCOPE_PRINCIPAL)
+		}
+	}
+	return ""
+}
+
+// hit 记录超限次数
+func (l *rateLimiter) hit(scope string) string {
+	v, _ := l.hits.LoadOrStore(scope, new(int64))
+	atomic.AddInt64(v.(*int64), 1)
+	return scope
+}
+
+// Hits 各维度累计超限次数
+func (l *rateLimiter) Hits() map[string]int64 {
+	var res = make(map[string]int64)
+	l.hits.Range(func(k, v interface{}) bool {
+		res[k.(string)] = atomic.LoadInt64(v.(*int64))
+		return true
+	})
+	return res
+}
+
+// violate 记录会话超限，返回是否需要断开连接
+func (l *rateLimiter) violate(s Session) bool {
+	if l.conf.Policy != RATE_LIMIT_POLICY_DISCONNECT {
+		return false
+	}
+	v, _ := s.Attrs().LoadOrStore(attrRateLimitViolations, &violations{})
+	vs := v.(*violations)
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(vs.start) > l.conf.ViolationWindow*time.Second {
+		vs.start = now
+		vs.count = 0
+	}
+	vs.count++
+	return vs.count > l.conf.MaxViolations
+}
+
+// throttledNotice 二进制帧被限流时是否需要回复，THROTTLED_NOTICE_INTERVAL内只回复一次
+func throttledNotice(s Session) bool {
+	if _, ok := s.Attrs().Get(attrRateLimitNotice); ok {
+		return false
+	}
+	s.Attrs().SetTTL(attrRateLimitNotice, true, THROTTLED_NOTICE_INTERVAL)
+	return true
+}
+
+// sessionBucket 获取会话上的令牌桶，连接断开时随会话属性释放
+// 热加载修改了限流参数时，已有的令牌桶同步更新
+func sessionBucket(s Session, key string, opt LimitOption) *ratelimit.Bucket {
+	if v, ok := s.Attrs().Get(key); ok {
+		b := v.(*ratelimit.Bucket)
+		b.SetLimit(opt.Rate, opt.Burst)
+		return b
+	}
+	v, _ := s.Attrs().LoadOrStore(key, ratelimit.NewBucket(opt.Rate, opt.Burst))
+	return v.(*ratelimit.Bucket)
+}
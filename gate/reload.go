@@ -0,0 +1,334 @@
+// Author: Vcentor
+// Date: 2026/10/22 10:15 上午
+// desc: 配置热加载，收到SIGHUP或server.toml变化时重新读取配置和授权规则
+// 全部校验通过后才应用运行时可修改的配置，其他配置修改后需要重启生效
+
+package gate
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"reflect"
+	"socketserver/auth"
+	"socketserver/env"
+	"socketserver/library/config"
+	"socketserver/library/wslog"
+	"strings"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// reloadableKeys 运行时可修改的配置项，按前缀匹配
+var reloadableKeys = []string{
+	"ws_conf.max_conn_num",
+	"ws_conf.write_msg_cap",
+	"ws_conf.cer_file",
+	"ws_conf.key_file",
+	"tcp_conf.max_conn_num",
+	"tcp_conf.chan_cap",
+	"rate_limit_conf.global",
+	"rate_limit_conf.actions",
+	"rate_limit_conf.principal",
+	"rate_limit_conf.policy",
+	"rate_limit_conf.max_violations",
+	"rate_limit_conf.violation_window",
+	"access_conf",
+	"auth_conf.api_keys",
+	"auth_conf.hmac_secret",
+	"auth_conf.jwt",
+	"log_conf.level",
+	"capture_conf",
+}
+
+// reloader 业务配置热加载函数
+type reloader struct {
+	name string
+	fn   func() error
+}
+
+// OnReload 注册业务配置热加载函数，server.toml热加载后依次调用
+// fn需要先校验新配置，校验失败时返回错误并保留原有配置
+func (gate *Gate) OnReload(name string, fn func() error) {
+	gate.reloadMutex.Lock()
+	defer gate.reloadMutex.Unlock()
+	gate.reloaders = append(gate.reloaders, reloader{name: name, fn: fn})
+}
+
+// LoadConfig 读取并校验配置文件，应用默认值和环境变量覆盖
+func LoadConfig(file string) (*Config, error) {
+	conf := new(Config)
+	if err := config.Load(file, config.ENV_PREFIX, conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// CheckConf 校验server.toml及其引用的密钥、证书和规则文件，不修改运行状态
+func CheckConf() error {
+	file, err := env.ServerConfFile()
+	if err != nil {
+		return err
+	}
+	conf, err := LoadConfig(file)
+	if err != nil {
+		return err
+	}
+	if err := conf.checkListen(); err != nil {
+		return fmt.Errorf("server.toml: %w", err)
+	}
+	if err := conf.checkHTTP(); err != nil {
+		return fmt.Errorf("server.toml: %w", err)
+	}
+	if err := conf.checkOffline(); err != nil {
+		return fmt.Errorf("server.toml: %w", err)
+	}
+	if conf.AuthConf.Enable {
+		if _, err := auth.New(conf.AuthConf); err != nil {
+			return fmt.Errorf("server.toml: auth_conf: %w", err)
+		}
+	}
+	if conf.AuthzConf.Enable {
+		ruleFile, err := conf.AuthzConf.ruleFile()
+		if err != nil {
+			return fmt.Errorf("server.toml: authz_conf.rule_file: %w", err)
+		}
+		if _, err := auth.LoadPolicy(ruleFile); err != nil {
+			return fmt.Errorf("server.toml: authz_conf.rule_file: %w", err)
+		}
+	}
+	if conf.WSConf.CerFile != "" {
+		if _, err := tls.LoadX509KeyPair(conf.WSConf.CerFile, conf.WSConf.KeyFile); err != nil {
+			return fmt.Errorf("server.toml: ws_conf.cer_file: %w", err)
+		}
+	}
+	return nil
+}
+
+// reload 热加载并记录结果，供信号和文件监听调用
+func (gate *Gate) reload() {
+	if err := gate.Reload(); err != nil {
+		gate.logger.Warning(gate.Ctx, "Reload config failed, keep running config", logit.Error("error", err))
+	}
+}
+
+// Reload 重新读取server.toml并调用业务配置热加载函数
+// server.toml中任一配置非法时返回错误，不修改运行状态
+func (gate *Gate) Reload() error {
+	gate.reloadMutex.Lock()
+	defer gate.reloadMutex.Unlock()
+
+	if gate.confFile == "" {
+		return errors.New("reload is not supported without config file")
+	}
+	next, err := LoadConfig(gate.confFile)
+	if err != nil {
+		return err
+	}
+	// 使用已创建的listener时监听地址不变
+	if gate.wsListener != nil {
+		next.WSConf.ListenAddr = gate.applied.WSConf.ListenAddr
+	}
+	if gate.tcpListener != nil {
+		next.TCPConf.ListenAddr = gate.applied.TCPConf.ListenAddr
+	}
+	var applied, restart []string
+	for _, key := range diffConf("", reflect.ValueOf(gate.applied).Elem(), reflect.ValueOf(next).Elem()) {
+		if gate.reloadable(key) {
+			applied = append(applied, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+
+	// 先全部校验并准备好新状态，最后统一替换
+	apply, err := gate.prepareReload(next)
+	if err != nil {
+		return err
+	}
+	for _, fn := range apply {
+		fn()
+	}
+	// 只记录已生效的配置项，需要重启的配置项仍按原值比较，下次热加载时继续提示
+	keys := make(map[string]bool, len(applied))
+	for _, key := range applied {
+		keys[key] = true
+	}
+	current := *gate.applied
+	copyConf("", reflect.ValueOf(&current).Elem(), reflect.ValueOf(next).Elem(), keys)
+	copyConf("", reflect.ValueOf(&gate.Config).Elem(), reflect.ValueOf(next).Elem(), keys)
+	gate.applied = &current
+	if len(applied) > 0 || len(restart) > 0 {
+		gate.logger.Notice(gate.Ctx, "Reload config success", logit.String("applied", strings.Join(applied, ",")),
+			logit.String("needRestart", strings.Join(restart, ",")))
+	} else {
+		gate.logger.Notice(gate.Ctx, "Reload config success, nothing changed")
+	}
+
+	for _, r := range gate.reloaders {
+		if err := r.fn(); err != nil {
+			gate.logger.Warning(gate.Ctx, "Reload business config failed, keep running config",
+				logit.String("name", r.name), logit.Error("error", err))
+			continue
+		}
+		gate.logger.Notice(gate.Ctx, "Reload business config success", logit.String("name", r.name))
+	}
+	return nil
+}
+
+// prepareReload 校验新配置并生成替换函数，任一配置非法时返回错误
+// 只在启动时开启的功能支持热加载参数，开关本身需要重启生效
+func (gate *Gate) prepareReload(next *Config) ([]func(), error) {
+	var apply []func()
+
+	// 配置格式已经在加载时校验，SetLevel和Update不会失败
+	apply = append(apply, func() {
+		_ = wslog.SetLoggerLevel(gate.logger, next.LogConf.Level)
+	})
+	apply = append(apply, func() {
+		_ = gate.ipFilter.Update(next.AccessConf.filterOption())
+	})
+
+	if old := gate.limiter(); old != nil {
+		l, err := newRateLimiter(next.RateLimitConf, old)
+		if err != nil {
+			return nil, err
+		}
+		apply = append(apply, func() {
+			gate.rateLimit.Store(l)
+		})
+	}
+
+	if gate.authenticator != nil && gate.customAuth == nil {
+		a, err := auth.New(next.AuthConf)
+		if err != nil {
+			return nil, err
+		}
+		apply = append(apply, func() {
+			gate.authenticator.Store(a)
+		})
+	}
+
+	// 授权规则文件随SIGHUP一起重新加载，规则文件路径修改后需要重启生效
+	if gate.authorizer != nil {
+		policy, err := auth.LoadPolicy(gate.authorizer.File())
+		if err != nil {
+			return nil, fmt.Errorf("authz_conf.rule_file: %w", err)
+		}
+		apply = append(apply, func() {
+			gate.authorizer.Store(policy)
+		})
+	}
+
+	if gate.wsserver != nil {
+		if gate.wsserver.TLSEnabled() {
+			cert, err := tls.LoadX509KeyPair(next.WSConf.CerFile, next.WSConf.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			apply = append(apply, func() {
+				gate.wsserver.SetCertificate(&cert)
+			})
+		}
+		apply = append(apply, func() {
+			gate.wsserver.SetLimits(next.WSConf.MaxConnMum, next.WSConf.WriteMsgCap)
+		})
+	}
+
+	if gate.tcpserver != nil {
+		apply = append(apply, func() {
+			gate.tcpserver.SetLimits(next.TCPConf.MaxConnNum, next.TCPConf.ChanCap)
+		})
+	}
+
+	// 抓包文件最后打开，之前的校验失败时不需要关闭
+	if next.CaptureConf != gate.applied.CaptureConf {
+		w, err := openCapture(next.CaptureConf)
+		if err != nil {
+			return nil, err
+		}
+		apply = append(apply, func() {
+			gate.setCapture(w)
+		})
+	}
+	return apply, nil
+}
+
+// reloadable 配置项在当前运行状态下是否热加载生效，与prepareReload的判断保持一致
+// 启动时未开启的功能不会应用新参数，需要重启生效
+func (gate *Gate) reloadable(key string) bool {
+	if !isReloadable(key) {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(key, "rate_limit_conf."):
+		return gate.limiter() != nil
+	case strings.HasPrefix(key, "auth_conf."):
+		return gate.authenticator != nil && gate.customAuth == nil
+	case key == "ws_conf.cer_file" || key == "ws_conf.key_file":
+		return gate.wsserver != nil && gate.wsserver.TLSEnabled()
+	case strings.HasPrefix(key, "ws_conf."):
+		return gate.wsserver != nil
+	case strings.HasPrefix(key, "tcp_conf."):
+		return gate.tcpserver != nil
+	}
+	return true
+}
+
+// isReloadable 配置项是否支持热加载
+func isReloadable(key string) bool {
+	for _, k := range reloadableKeys {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// copyConf 把src中keys包含的配置项复制到dst，配置项名称与diffConf一致
+func copyConf(prefix string, dst, src reflect.Value, keys map[string]bool) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		if dst.Field(i).Kind() == reflect.Struct {
+			copyConf(key, dst.Field(i), src.Field(i), keys)
+			continue
+		}
+		if keys[key] {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// diffConf 比较两份配置，返回发生变化的配置项，只比较有toml标签的字段
+// 嵌套的配置块逐项比较，其他类型整体比较，只记录配置项名称不记录值，避免密钥写入日志
+func diffConf(prefix string, old, next reflect.Value) []string {
+	var changed []string
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		o, n := old.Field(i), next.Field(i)
+		if o.Kind() == reflect.Struct {
+			changed = append(changed, diffConf(key, o, n)...)
+			continue
+		}
+		if !reflect.DeepEqual(o.Interface(), n.Interface()) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
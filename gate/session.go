@@ -0,0 +1,219 @@
+// Author: Vcentor
+// Date: 2026/10/19 11:02 上午
+// desc: 网关会话管理，维护session与用户的对应关系
+
+package gate
+
+import (
+	"context"
+	"net"
+	"socketserver/auth"
+	"socketserver/network"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 传输协议
+const (
+	TRANSPORT_WS  = "ws"
+	TRANSPORT_TCP = "tcp"
+)
+
+// Session 网关会话，WSAgent和TCPAgent均实现
+type Session interface {
+	SessionID() string
+	Transport() string
+	RemoteAddr() net.Addr
+	Attrs() *network.Attrs
+	Principal() *auth.Principal
+	WriteMsg(b []byte) error
+	WriteMsgContext(ctx context.Context, b []byte) error
+	PendingWrites() int
+	Stats() SessionStats
+	Context() context.Context
+	Close()
+	CloseWithReason(reason string)
+
+	setPrincipal(p *auth.Principal)
+	stats() *sessionStats
+	setContext(ctx context.Context)
+	withRequest(ctx context.Context) func()
+}
+
+// sessionContext 会话日志上下文，嵌入到WSAgent和TCPAgent中
+type sessionContext struct {
+	ctxMutex sync.RWMutex
+	ctx      context.Context // 会话上下文，携带sessionId、transport、remoteAddr
+	reqCtx   context.Context // 处理中的请求上下文，另外携带requestId、action
+}
+
+// Context 日志上下文，处理请求期间为请求上下文，业务handler使用它打日志时自动带上会话和请求字段
+func (s *sessionContext) Context() context.Context {
+	s.ctxMutex.RLock()
+	defer s.ctxMutex.RUnlock()
+	if s.reqCtx != nil {
+		return s.reqCtx
+	}
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+// setContext 设置会话上下文
+func (s *sessionContext) setContext(ctx context.Context) {
+	s.ctxMutex.Lock()
+	s.ctx = ctx
+	s.ctxMutex.Unlock()
+}
+
+// withRequest 设置请求上下文，返回的函数在请求处理完成后调用
+func (s *sessionContext) withRequest(ctx context.Context) func() {
+	s.ctxMutex.Lock()
+	s.reqCtx = ctx
+	s.ctxMutex.Unlock()
+	return func() {
+		s.ctxMutex.Lock()
+		s.reqCtx = nil
+		s.ctxMutex.Unlock()
+	}
+}
+
+// SessionStats 会话收发统计
+type SessionStats struct {
+	ConnectedAt time.Time `json:"connectedAt"`
+	MessagesIn  int64     `json:"messagesIn"`
+	MessagesOut int64     `json:"messagesOut"`
+	BytesIn     int64     `json:"bytesIn"`
+	BytesOut    int64     `json:"bytesOut"`
+	Dropped     int64     `json:"dropped"`
+}
+
+// sessionStats 会话收发统计，嵌入到WSAgent和TCPAgent中
+type sessionStats struct {
+	connectedAt int64 // unix纳秒
+	messagesIn  int64
+	messagesOut int64
+	bytesIn     int64
+	bytesOut    int64
+	dropped     int64
+}
+
+func (s *sessionStats) stats() *sessionStats {
+	return s
+}
+
+// Stats 会话收发统计
+func (s *sessionStats) Stats() SessionStats {
+	return SessionStats{
+		ConnectedAt: time.Unix(0, atomic.LoadInt64(&s.connectedAt)),
+		MessagesIn:  atomic.LoadInt64(&s.messagesIn),
+		MessagesOut: atomic.LoadInt64(&s.messagesOut),
+		BytesIn:     atomic.LoadInt64(&s.bytesIn),
+		BytesOut:    atomic.LoadInt64(&s.bytesOut),
+		Dropped:     atomic.LoadInt64(&s.dropped),
+	}
+}
+
+// SessionPool 会话池
+type SessionPool struct {
+	sync.RWMutex
+	sessions map[string]Session
+	users    map[string]map[string]Session // uid -> sid -> session
+	uids     map[string]string             // sid -> uid
+}
+
+// NewSessionPool 实例化会话池
+func NewSessionPool() *SessionPool {
+	return &SessionPool{
+		sessions: make(map[string]Session),
+		users:    make(map[string]map[string]Session),
+		uids:     make(map[string]string),
+	}
+}
+
+// Add 加入会话
+func (pool *SessionPool) Add(s Session) {
+	pool.Lock()
+	defer pool.Unlock()
+	pool.sessions[s.SessionID()] = s
+}
+
+// Del 删除会话及用户绑定关系
+func (pool *SessionPool) Del(s Session) {
+	pool.Lock()
+	defer pool.Unlock()
+	sid := s.SessionID()
+	delete(pool.sessions, sid)
+	pool.unbind(sid)
+}
+
+// Bind 绑定会话与用户
+func (pool *SessionPool) Bind(uid string, s Session) {
+	pool.Lock()
+	defer pool.Unlock()
+	sid := s.SessionID()
+	pool.unbind(sid)
+	if _, ok := pool.users[uid]; !ok {
+		pool.users[uid] = make(map[string]Session)
+	}
+	pool.users[uid][sid] = s
+	pool.uids[sid] = uid
+}
+
+// unbind 解除绑定，调用方需持有锁
+func (pool *SessionPool) unbind(sid string) {
+	uid, ok := pool.uids[sid]
+	if !ok {
+		return
+	}
+	delete(pool.uids, sid)
+	delete(pool.users[uid], sid)
+	if len(pool.users[uid]) == 0 {
+		delete(pool.users, uid)
+	}
+}
+
+// Get 通过session id获取会话
+func (pool *SessionPool) Get(sid string) Session {
+	pool.RLock()
+	defer pool.RUnlock()
+	return pool.sessions[sid]
+}
+
+// UserSessions 获取用户所有在线会话
+func (pool *SessionPool) UserSessions(uid string) []Session {
+	pool.RLock()
+	defer pool.RUnlock()
+	var sessions = make([]Session, 0, len(pool.users[uid]))
+	for _, s := range pool.users[uid] {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// UID 获取会话绑定的用户
+func (pool *SessionPool) UID(sid string) string {
+	pool.RLock()
+	defer pool.RUnlock()
+	return pool.uids[sid]
+}
+
+// Sessions 获取所有会话
+func (pool *SessionPool) Sessions() []Session {
+	pool.RLock()
+	defer pool.RUnlock()
+	var sessions = make([]Session, 0, len(pool.sessions))
+	for _, s := range pool.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// Len 会话数
+func (pool *SessionPool) Len() int {
+	pool.RLock()
+	defer pool.RUnlock()
+	return len(pool.sessions)
+}
@@ -5,38 +5,104 @@
 package gate
 
 import (
-	"socketserver/library/wslog"
-	"socketserver/network"
-	"fmt"
+	"context"
 	"icode.baidu.com/baidu/gdp/logit"
 	"io"
+	"net"
+	"socketserver/network"
 )
 
-var _ network.Agent = (*TCPAgent)(nil)
+var (
+	_ network.Agent = (*TCPAgent)(nil)
+	_ Session       = (*TCPAgent)(nil)
+)
 
 type TCPAgent struct {
+	sessionAuth
+	sessionStats
+	sessionContext
 	Conn *network.TCPConn
 	Gate *Gate
 }
 
 func (a *TCPAgent) ReadMsg() {
+	a.Gate.Sessions.Add(a)
+	a.Gate.connected(a)
 	for {
 		data, err := a.Conn.ReadMsg()
 		if err != nil {
 			if err == io.EOF {
-				wslog.Logger.Notice(a.Gate.Ctx, "TCPServer connect closed", logit.Error("error", err))
+				a.Gate.logger.Notice(a.Context(), "TCPServer connect closed")
+				a.Conn.CloseWithReason(network.CLOSE_CLIENT, nil)
 			} else {
-				wslog.Logger.Fatal(a.Gate.Ctx, "TCPServer read message  error", logit.Error("error", err))
+				a.Gate.logger.Warning(a.Context(), "TCPServer read message error", logit.Error("error", err))
+				a.Conn.CloseWithReason(network.CLOSE_READ_ERROR, err)
 			}
 
 			goto CLOSE
 		}
 
-		wslog.Logger.Debug(a.Gate.Ctx, "read message", logit.String("info", string(data)))
-
-		fmt.Println(a.Conn.WriteMsg(data))
-		fmt.Println(a.Conn.GetSessionPool())
+		a.Gate.received(a, 0, data)
+		a.Gate.logger.Debug(a.Context(), "read message", logit.String("info", string(data)))
+		if reason := a.Gate.handleMsg(a, data); reason != "" {
+			a.CloseWithReason(reason)
+			goto CLOSE
+		}
 	}
 CLOSE:
+	a.Close()
+	reason, err := a.Conn.CloseReason()
+	a.Gate.disconnected(a, reason, err)
+}
+
+// Attrs 会话属性，key最好以action命名，充分解耦
+func (a *TCPAgent) Attrs() *network.Attrs {
+	return a.Conn.Attrs()
+}
+
+// SessionID 会话id
+func (a *TCPAgent) SessionID() string {
+	return a.Conn.GetSessionID()
+}
+
+// Transport 传输协议
+func (a *TCPAgent) Transport() string {
+	return TRANSPORT_TCP
+}
+
+// RemoteAddr 远程地址
+func (a *TCPAgent) RemoteAddr() net.Addr {
+	return a.Conn.RemoteAddr()
+}
+
+// WriteMsg 按协议发送数据
+func (a *TCPAgent) WriteMsg(b []byte) error {
+	err := a.Conn.WriteMsg(b)
+	a.Gate.sent(a, b, err)
+	return err
+}
+
+// WriteMsgContext 发送数据，写队列满时等待而不是断开连接，写入连接后返回
+// 用于离线补发、下线通知等服务端主动批量下发的场景
+func (a *TCPAgent) WriteMsgContext(ctx context.Context, b []byte) error {
+	err := a.Conn.WriteMsgContext(ctx, b)
+	a.Gate.sent(a, b, err)
+	return err
+}
+
+// PendingWrites 待发送的消息数
+func (a *TCPAgent) PendingWrites() int {
+	return a.Conn.PendingWrites()
+}
+
+// Close 关闭连接并移出会话池
+func (a *TCPAgent) Close() {
 	a.Conn.Close()
+	a.Gate.Sessions.Del(a)
+}
+
+// CloseWithReason 关闭连接并记录原因，OnDisconnect回调中获取该原因
+func (a *TCPAgent) CloseWithReason(reason string) {
+	a.Conn.CloseWithReason(reason, nil)
+	a.Gate.Sessions.Del(a)
 }
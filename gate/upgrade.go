@@ -0,0 +1,197 @@
+// Author: Vcentor
+// Date: 2026/10/21 4:05 下午
+// desc: 平滑重启，收到SIGUSR2后启动新进程并传递listener，新进程开始accept后旧进程进入排空状态
+// 交接流程：
+// 1. 旧进程复制websocket、tcp和单独监听的http服务的文件描述符，连同交接管道的读端传给新进程
+// 2. 新进程在继承的listener上开始accept，然后向旧进程发送SIGTERM
+// 3. 旧进程停止accept和http服务，进入排空状态，排空期间的离线推送仍写入离线存储
+// 4. 旧进程排空结束后关闭离线存储和交接管道
+// 5. 新进程打开离线存储，此前新会话的离线补发和存入离线存储的推送等待交接完成
+// 由supervise等按pid托管的进程排空后不退出，转发信号给新进程组，新进程组全部退出后再退出，
+// 使用control.sh upgrade向托管的进程发送SIGUSR2，之后的平滑重启同样由它转发
+
+package gate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"socketserver/network"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// ENV_UPGRADE_FD 交接管道读端的文件描述符，只在平滑重启的子进程中存在
+const ENV_UPGRADE_FD = "SOCKETSERVER_UPGRADE_FD"
+
+// upgradeTimeout 新进程等待旧进程交接的最长时间，另加旧进程的排空时间
+const upgradeTimeout = 30 * time.Second
+
+var upgradeMutex sync.Mutex
+
+// claimUpgradeFd 取出交接管道的文件描述符并清除环境变量，同一进程只有第一个启动的网关参与交接
+func claimUpgradeFd() (int, error) {
+	upgradeMutex.Lock()
+	defer upgradeMutex.Unlock()
+	v := os.Getenv(ENV_UPGRADE_FD)
+	if v == "" {
+		return 0, nil
+	}
+	_ = os.Unsetenv(ENV_UPGRADE_FD)
+	return strconv.Atoi(v)
+}
+
+// upgrading 是否由平滑重启启动并参与交接
+func (gate *Gate) upgrading() bool {
+	return gate.upgradeFd > 0
+}
+
+// upgrade 启动新进程并传递listener，新进程就绪后会向本进程发送SIGTERM
+// 返回的channel在新进程退出时写入退出原因
+func (gate *Gate) upgrade() (<-chan error, error) {
+	if gate.handoff != nil {
+		return nil, errors.New("upgrade is in progress")
+	}
+	bin, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// 子进程的ExtraFiles从3开始编号，交接管道排在第一个
+	// 单独监听的指标、健康检查和管理接口也要传递，旧进程排空期间仍占用这些端口，新进程无法重新监听
+	files, fds, err := network.ListenerFiles(4)
+	if err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	cmd := exec.Command(bin, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append([]*os.File{r}, files...)
+	cmd.Env = append(os.Environ(), network.ENV_LISTEN_FDS+"="+fds, ENV_UPGRADE_FD+"=3")
+	// 第一次平滑重启时新进程单独成组，之后的新进程继承该进程组，托管的进程按组转发信号
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: !gate.upgrading()}
+	if err := cmd.Start(); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	gate.handoff = w
+	if !gate.upgrading() {
+		gate.upgradePgid = cmd.Process.Pid
+	}
+	gate.logger.Notice(gate.Ctx, "Upgrade process started", logit.Int("pid", cmd.Process.Pid),
+		logit.String("listeners", fds))
+	exit := make(chan error, 1)
+	go func() {
+		exit <- cmd.Wait()
+	}()
+	return exit, nil
+}
+
+// abortUpgrade 新进程在交接前退出，继续由本进程提供服务，允许再次重启
+func (gate *Gate) abortUpgrade(err error) {
+	gate.logger.Warning(gate.Ctx, "Upgrade process exited before handoff", logit.Error("error", err))
+	_ = gate.handoff.Close()
+	gate.handoff = nil
+	gate.upgradePgid = 0
+}
+
+// releaseHandoff 旧进程排空并关闭离线存储后通知新进程
+func (gate *Gate) releaseHandoff() {
+	if gate.handoff == nil {
+		return
+	}
+	_ = gate.handoff.Close()
+	gate.logger.Notice(gate.Ctx, "Upgrade handoff released")
+}
+
+// awaitHandoff 新进程开始accept后通知旧进程退出，后台等待旧进程交出离线存储
+func (gate *Gate) awaitHandoff() error {
+	r := os.NewFile(uintptr(gate.upgradeFd), "handoff")
+	if err := syscall.Kill(os.Getppid(), syscall.SIGTERM); err != nil {
+		_ = r.Close()
+		return err
+	}
+	if !gate.OfflineConf.Enable {
+		_ = r.Close()
+		return nil
+	}
+	gate.offlineReady = make(chan struct{})
+	go gate.openAfterHandoff(r)
+	return nil
+}
+
+// openAfterHandoff 旧进程关闭交接管道后打开离线存储，超时或打开失败时服务失败退出
+func (gate *Gate) openAfterHandoff(r io.ReadCloser) {
+	defer close(gate.offlineReady)
+	defer r.Close()
+	// 旧进程关闭写端或异常退出时读到EOF
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(ioutil.Discard, r)
+		done <- err
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(upgradeTimeout + gate.ShutdownTimeout*time.Second):
+		err = errors.New("wait for handoff timeout")
+	case <-gate.Ctx.Done():
+		return
+	}
+	if err == nil {
+		err = gate.openOfflineStore()
+	}
+	if err != nil {
+		gate.fail(fmt.Errorf("upgrade handoff: %w", err))
+		return
+	}
+	gate.logger.Notice(gate.Ctx, "Upgrade handoff finished")
+}
+
+// standby 托管的进程排空后保持运行，进程管理器按pid判断服务仍然存活
+// 收到的信号转发给新进程组，新进程组全部退出后返回，收到退出信号前退出时返回错误以便被重新拉起
+func (gate *Gate) standby() error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGUSR2, syscall.SIGHUP)
+	defer signal.Stop(c)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	gate.logger.Notice(gate.Ctx, "Upgrade standby", logit.Int("pgid", gate.upgradePgid))
+	var stopping bool
+	for {
+		select {
+		case sig := <-c:
+			if sig == os.Interrupt || sig == syscall.SIGTERM {
+				stopping = true
+			}
+			_ = syscall.Kill(-gate.upgradePgid, sig.(syscall.Signal))
+		case <-ticker.C:
+			if err := syscall.Kill(-gate.upgradePgid, 0); err != syscall.ESRCH {
+				continue
+			}
+			if stopping {
+				return nil
+			}
+			return errors.New("upgraded processes exited")
+		}
+	}
+}
@@ -4,11 +4,11 @@
 package gate
 
 import (
-	"socketserver/library/wslog"
-	"socketserver/network"
+	"context"
 	"encoding/base64"
-	"encoding/json"
 	"icode.baidu.com/baidu/gdp/logit"
+	"net"
+	"socketserver/network"
 )
 
 // websocket读数据的类型
@@ -17,30 +17,37 @@ const (
 	BINARY_MESSAGE = 2
 )
 
-// GlobalData 保存端上全局数据
-type GlobalData struct {
-	DataType string // 区分同一链接的不同公共数据，最好以action命名，充分解耦
-	Data     []byte
-}
-
-var _ network.Agent = (*WSAgent)(nil)
+var (
+	_ network.Agent = (*WSAgent)(nil)
+	_ Session       = (*WSAgent)(nil)
+)
 
 // WSAgent 网关接口代理
 type WSAgent struct {
-	Conn       *network.WSConn
-	Gate       *Gate
-	AsrConn    *network.WSClient
-	GlobalData *GlobalData
+	sessionAuth
+	sessionStats
+	sessionContext
+	Conn    *network.WSConn
+	Gate    *Gate
+	AsrConn *network.WSClient
 }
 
 // ReadMsg 读信息
 func (a *WSAgent) ReadMsg() {
+	a.Gate.Sessions.Add(a)
+	a.Gate.connected(a)
+	if !a.Gate.handshakeAuth(a, a.Conn.Request()) {
+		a.CloseWithReason(CLOSE_UNAUTHENTICATED)
+		goto CLOSE
+	}
 	for {
 		data, messageType, err := a.Conn.ReadMsg()
 		if err != nil {
-			wslog.Logger.Notice(a.Gate.Ctx, "Read message failed", logit.Error("error", err))
+			a.Gate.logger.Notice(a.Context(), "Read message failed", logit.Error("error", err))
+			a.Conn.CloseWithReason(network.CLOSE_READ_ERROR, err)
 			goto CLOSE
 		}
+		a.Gate.received(a, messageType, data)
 		switch messageType {
 		case BINARY_MESSAGE:
 			requestId := a.Conn.GetSessionID()
@@ -49,42 +56,79 @@ func (a *WSAgent) ReadMsg() {
 				"requestId": "` + requestId + `",
 				"body": "` + base64.StdEncoding.EncodeToString(data) + `"
 			}`)
-			msg, err := a.Gate.WSConf.Processer.Unmarshal(d)
+			msg, err := a.Gate.Processer.Unmarshal(d)
 			if err != nil {
-				wslog.Logger.Fatal(a.Gate.Ctx, "Unmarshal binary message failed", logit.Error("error", err))
+				a.Gate.logger.Warning(a.Context(), "Unmarshal binary message failed", logit.Error("error", err))
 				// switch层面的break 不断开连接
 				break
 			}
-			a.Gate.WSConf.Processer.Route(msg, a)
-		case TEXT_MESSAGE:
-			wslog.Logger.Notice(a.Gate.Ctx, "text message data", logit.String("data", string(data)))
-			msg, err := a.Gate.WSConf.Processer.Unmarshal(data)
-			if err != nil {
-				wslog.Logger.Fatal(a.Gate.Ctx, "Unmarshal text message failed", logit.Error("error", err))
-				var resp = JsonResponse{
-					Code:    ERR_REQUEST_PARAMS,
-					Message: "Illegal request params",
-				}
-				b, _ := json.Marshal(&resp)
-				a.Conn.WriteMsg(b)
+			// 二进制数据路由失败不断开连接，disconnect策略下持续超限时断开
+			if reason := a.Gate.dispatch(a, msg, true); reason == CLOSE_THROTTLED {
+				a.CloseWithReason(reason)
 				goto CLOSE
 			}
-
-			if err := a.Gate.WSConf.Processer.Route(msg, a); err != nil {
-				wslog.Logger.Fatal(a.Gate.Ctx, "Route failed", logit.Error("error", err))
-				var resp = JsonResponse{
-					RequestId: msg.RequestID,
-					Action:    "UNKOWN",
-					Code:      ERR_PARSE_ROUTE,
-					Message:   "Illegal action!",
-					Body:      nil,
-				}
-				b, _ := json.Marshal(&resp)
-				a.Conn.WriteMsg(b)
+		case TEXT_MESSAGE:
+			a.Gate.logger.Debug(a.Context(), "text message data", logit.String("data", string(data)))
+			if reason := a.Gate.handleMsg(a, data); reason != "" {
+				a.CloseWithReason(reason)
 				goto CLOSE
 			}
 		}
 	}
 CLOSE:
+	a.Close()
+	reason, err := a.Conn.CloseReason()
+	a.Gate.disconnected(a, reason, err)
+}
+
+// Attrs 会话属性，key最好以action命名，充分解耦
+func (a *WSAgent) Attrs() *network.Attrs {
+	return a.Conn.Attrs()
+}
+
+// SessionID 会话id
+func (a *WSAgent) SessionID() string {
+	return a.Conn.GetSessionID()
+}
+
+// Transport 传输协议
+func (a *WSAgent) Transport() string {
+	return TRANSPORT_WS
+}
+
+// RemoteAddr 远程地址
+func (a *WSAgent) RemoteAddr() net.Addr {
+	return a.Conn.RemoteAddr()
+}
+
+// WriteMsg 发送数据
+func (a *WSAgent) WriteMsg(b []byte) error {
+	err := a.Conn.WriteMsg(b)
+	a.Gate.sent(a, b, err)
+	return err
+}
+
+// WriteMsgContext 发送数据，写队列满时等待而不是断开连接，写入连接后返回
+// 用于离线补发、下线通知等服务端主动批量下发的场景
+func (a *WSAgent) WriteMsgContext(ctx context.Context, b []byte) error {
+	err := a.Conn.WriteMsgContext(ctx, b)
+	a.Gate.sent(a, b, err)
+	return err
+}
+
+// PendingWrites 待发送的消息数
+func (a *WSAgent) PendingWrites() int {
+	return a.Conn.PendingWrites()
+}
+
+// Close 关闭连接并移出会话池
+func (a *WSAgent) Close() {
 	a.Conn.Close()
+	a.Gate.Sessions.Del(a)
+}
+
+// CloseWithReason 关闭连接并记录原因，OnDisconnect回调中获取该原因
+func (a *WSAgent) CloseWithReason(reason string) {
+	a.Conn.CloseWithReason(reason, nil)
+	a.Gate.Sessions.Del(a)
 }
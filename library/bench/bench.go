@@ -0,0 +1,463 @@
+// Author: Vcentor
+// Date: 2026/10/27 10:00 上午
+// desc: 压测，建立N个websocket或tcp连接，按脚本以目标速率发送请求，按requestId匹配响应统计耗时
+// 结果包含耗时分位数、错误码、超时和断连数，可以输出json用于容量评估
+
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"socketserver/library/config"
+	"socketserver/network"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 传输协议
+const (
+	TRANSPORT_WS  = network.TRANSPORT_WS
+	TRANSPORT_TCP = network.TRANSPORT_TCP
+)
+
+// 默认压测参数
+const (
+	DEFAULT_CHUNK_SIZE = 3200 // 16k采样16bit单声道100ms的PCM数据
+	DEFAULT_TIMEOUT    = 5 * time.Second
+)
+
+// Step 脚本步骤，action和pcm二选一
+type Step struct {
+	Action    string `toml:"action"`     // 文本请求的action
+	Body      string `toml:"body"`       // 请求体json，为空时为{}
+	PCM       string `toml:"pcm"`        // 二进制PCM文件，按chunk_size分片发送，只支持websocket
+	ChunkSize int    `toml:"chunk_size"` // PCM分片大小，默认3200字节
+	Repeat    int    `toml:"repeat"`     // 重复次数，默认1次
+}
+
+// Script 压测脚本，每个连接按顺序循环执行
+type Script struct {
+	Steps []Step `toml:"steps"`
+}
+
+// LoadScript 读取toml格式的压测脚本
+func LoadScript(file string) (*Script, error) {
+	var s Script
+	if err := config.Load(file, "", &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Options 压测选项
+type Options struct {
+	Dial     network.DialOption // 传输协议和地址，websocket地址如 ws://127.0.0.1:8989/digitalhuman-ws，tcp地址如 127.0.0.1:8990
+	Conns    int                // 并发连接数
+	Rate     float64            // 所有连接合计每秒发送的消息数，0为不限速
+	Duration time.Duration      // 发送时长
+	Requests int                // 每个连接发送的消息数，0为不限制，与Duration先到者结束
+	Timeout  time.Duration      // 发送结束后等待响应的最长时间，超过后计为超时
+	Script   *Script
+}
+
+// message 脚本展开后的单条消息
+type message struct {
+	action string // 为空时是PCM分片
+	body   json.RawMessage
+	pcm    []byte
+}
+
+// compile 展开脚本，读取PCM文件并校验
+func (o *Options) compile() ([]message, error) {
+	if o.Script == nil || len(o.Script.Steps) == 0 {
+		return nil, errors.New("script has no steps")
+	}
+	var msgs []message
+	for i, step := range o.Script.Steps {
+		repeat := step.Repeat
+		if repeat <= 0 {
+			repeat = 1
+		}
+		switch {
+		case step.Action != "" && step.PCM != "":
+			return nil, fmt.Errorf("step %d: action and pcm are exclusive", i)
+		case step.Action != "":
+			body := json.RawMessage(`{}`)
+			if step.Body != "" {
+				if !json.Valid([]byte(step.Body)) {
+					return nil, fmt.Errorf("step %d: body is not valid json", i)
+				}
+				body = json.RawMessage(step.Body)
+			}
+			for n := 0; n < repeat; n++ {
+				msgs = append(msgs, message{action: step.Action, body: body})
+			}
+		case step.PCM != "":
+			if o.Dial.Transport != TRANSPORT_WS {
+				return nil, fmt.Errorf("step %d: pcm is only supported by websocket", i)
+			}
+			data, err := ioutil.ReadFile(step.PCM)
+			if err != nil {
+				return nil, fmt.Errorf("step %d: %w", i, err)
+			}
+			size := step.ChunkSize
+			if size <= 0 {
+				size = DEFAULT_CHUNK_SIZE
+			}
+			for n := 0; n < repeat; n++ {
+				for off := 0; off < len(data); off += size {
+					end := off + size
+					if end > len(data) {
+						end = len(data)
+					}
+					msgs = append(msgs, message{pcm: data[off:end]})
+				}
+			}
+		default:
+			return nil, fmt.Errorf("step %d: action or pcm is required", i)
+		}
+	}
+	return msgs, nil
+}
+
+// Latency 耗时分布，单位ms
+type Latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Summary 压测结果
+type Summary struct {
+	Transport     string           `json:"transport"`
+	Conns         int              `json:"conns"`
+	Connected     int              `json:"connected"`
+	ConnectErrors int              `json:"connectErrors"`
+	Elapsed       float64          `json:"elapsedSeconds"`
+	Sent          int64            `json:"sent"`
+	SentBytes     int64            `json:"sentBytes"`
+	SendErrors    int64            `json:"sendErrors"`
+	Responses     int64            `json:"responses"` // 按requestId匹配到请求的响应
+	Unmatched     int64            `json:"unmatched"` // 未匹配的消息，如PCM识别结果和推送
+	Timeouts      int64            `json:"timeouts"`
+	Disconnects   int64            `json:"disconnects"` // 压测结束前被服务端断开的连接
+	Codes         map[string]int64 `json:"codes"`       // 按错误码统计的响应数
+	Throughput    float64          `json:"throughput"`  // 每秒匹配的响应数
+	Latency       Latency          `json:"latencyMs"`
+}
+
+// Report 输出可读的压测结果
+func (s *Summary) Report(w io.Writer) {
+	fmt.Fprintf(w, "transport=%s conns=%d connected=%d connect_errors=%d elapsed=%.2fs\n",
+		s.Transport, s.Conns, s.Connected, s.ConnectErrors, s.Elapsed)
+	fmt.Fprintf(w, "sent=%d bytes=%d send_errors=%d responses=%d unmatched=%d timeouts=%d disconnects=%d\n",
+		s.Sent, s.SentBytes, s.SendErrors, s.Responses, s.Unmatched, s.Timeouts, s.Disconnects)
+	fmt.Fprintf(w, "throughput=%.1f/s latency(ms) min=%.2f mean=%.2f p50=%.2f p90=%.2f p95=%.2f p99=%.2f max=%.2f\n",
+		s.Throughput, s.Latency.Min, s.Latency.Mean, s.Latency.P50, s.Latency.P90, s.Latency.P95, s.Latency.P99, s.Latency.Max)
+	codes := make([]string, 0, len(s.Codes))
+	for code := range s.Codes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "code %s: %d\n", code, s.Codes[code])
+	}
+}
+
+// stats 压测过程中的统计
+type stats struct {
+	sent, sentBytes, sendErrors    int64
+	responses, unmatched, timeouts int64
+	disconnects                    int64
+	mutex                          sync.Mutex
+	codes                          map[string]int64
+	latencies                      []float64
+	connected, connectErrors       int
+	firstConnectErr                error
+}
+
+// response 网关下发的消息
+type response struct {
+	RequestID string `json:"requestId"`
+	Code      *int   `json:"code"`
+}
+
+// Run 执行压测，ctx取消时提前结束
+func Run(ctx context.Context, o Options) (*Summary, error) {
+	msgs, err := o.compile()
+	if err != nil {
+		return nil, err
+	}
+	if o.Conns <= 0 {
+		return nil, errors.New("conns must be positive")
+	}
+	if o.Duration <= 0 && o.Requests <= 0 {
+		return nil, errors.New("duration or requests is required")
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DEFAULT_TIMEOUT
+	}
+
+	st := &stats{codes: make(map[string]int64)}
+	p := newPacer(o.Rate)
+	sendCtx := ctx
+	if o.Duration > 0 {
+		var cancel context.CancelFunc
+		sendCtx, cancel = context.WithTimeout(ctx, o.Duration)
+		defer cancel()
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < o.Conns; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			runConn(ctx, sendCtx, id, o, msgs, p, st)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if st.connected == 0 && st.firstConnectErr != nil {
+		return nil, fmt.Errorf("all connections failed: %w", st.firstConnectErr)
+	}
+	return st.summary(o, elapsed), nil
+}
+
+// runConn 单个连接按脚本循环发送，发送结束后等待未完成的响应
+func runConn(ctx, sendCtx context.Context, id int, o Options, msgs []message, p *pacer, st *stats) {
+	c, err := network.Dial(ctx, o.Dial)
+	st.mutex.Lock()
+	if err != nil {
+		st.connectErrors++
+		if st.firstConnectErr == nil {
+			st.firstConnectErr = err
+		}
+	} else {
+		st.connected++
+	}
+	st.mutex.Unlock()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	var (
+		mutex   sync.Mutex
+		pending = make(map[string]time.Time)
+		closing int32
+		readEnd = make(chan struct{})
+		drained = make(chan struct{}, 1)
+	)
+	go func() {
+		defer close(readEnd)
+		for {
+			data, _, err := c.ReadMsg()
+			if err != nil {
+				if atomic.LoadInt32(&closing) == 0 {
+					atomic.AddInt64(&st.disconnects, 1)
+				}
+				return
+			}
+			var resp response
+			if json.Unmarshal(data, &resp) != nil {
+				atomic.AddInt64(&st.unmatched, 1)
+				continue
+			}
+			mutex.Lock()
+			sentAt, ok := pending[resp.RequestID]
+			delete(pending, resp.RequestID)
+			left := len(pending)
+			mutex.Unlock()
+			if resp.Code != nil {
+				st.mutex.Lock()
+				st.codes[strconv.Itoa(*resp.Code)]++
+				st.mutex.Unlock()
+			}
+			if !ok {
+				atomic.AddInt64(&st.unmatched, 1)
+				continue
+			}
+			atomic.AddInt64(&st.responses, 1)
+			st.mutex.Lock()
+			st.latencies = append(st.latencies, float64(time.Since(sentAt))/float64(time.Millisecond))
+			st.mutex.Unlock()
+			if left == 0 {
+				select {
+				case drained <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+SEND:
+	for seq := 0; o.Requests <= 0 || seq < o.Requests; seq++ {
+		if !p.wait(sendCtx) {
+			break
+		}
+		m := msgs[seq%len(msgs)]
+		var (
+			data   []byte
+			binary bool
+		)
+		var requestID string
+		if m.action != "" {
+			requestID = fmt.Sprintf("%d-%d", id, seq)
+			data, _ = json.Marshal(map[string]interface{}{"requestId": requestID, "action": m.action, "body": m.body})
+			mutex.Lock()
+			pending[requestID] = time.Now()
+			mutex.Unlock()
+		} else {
+			data, binary = m.pcm, true
+		}
+		if err := c.WriteMsg(data, binary); err != nil {
+			atomic.AddInt64(&st.sendErrors, 1)
+			mutex.Lock()
+			delete(pending, requestID)
+			mutex.Unlock()
+			break SEND
+		}
+		atomic.AddInt64(&st.sent, 1)
+		atomic.AddInt64(&st.sentBytes, int64(len(data)))
+		select {
+		case <-readEnd:
+			break SEND
+		default:
+		}
+	}
+
+	// 等待未完成的响应，超时或连接断开后剩余的请求计为超时
+	timer := time.NewTimer(o.Timeout)
+	defer timer.Stop()
+WAIT:
+	for {
+		mutex.Lock()
+		left := len(pending)
+		mutex.Unlock()
+		if left == 0 {
+			break
+		}
+		select {
+		case <-drained:
+		case <-readEnd:
+			break WAIT
+		case <-timer.C:
+			break WAIT
+		case <-ctx.Done():
+			break WAIT
+		}
+	}
+	atomic.StoreInt32(&closing, 1)
+	mutex.Lock()
+	atomic.AddInt64(&st.timeouts, int64(len(pending)))
+	pending = make(map[string]time.Time)
+	mutex.Unlock()
+}
+
+// summary 汇总统计
+func (st *stats) summary(o Options, elapsed time.Duration) *Summary {
+	s := &Summary{
+		Transport:     o.Dial.Transport,
+		Conns:         o.Conns,
+		Connected:     st.connected,
+		ConnectErrors: st.connectErrors,
+		Elapsed:       elapsed.Seconds(),
+		Sent:          st.sent,
+		SentBytes:     st.sentBytes,
+		SendErrors:    st.sendErrors,
+		Responses:     st.responses,
+		Unmatched:     st.unmatched,
+		Timeouts:      st.timeouts,
+		Disconnects:   st.disconnects,
+		Codes:         st.codes,
+		Latency:       latency(st.latencies),
+	}
+	if elapsed > 0 {
+		s.Throughput = float64(st.responses) / elapsed.Seconds()
+	}
+	return s
+}
+
+// latency 计算耗时分布
+func latency(values []float64) Latency {
+	if len(values) == 0 {
+		return Latency{}
+	}
+	sort.Float64s(values)
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return Latency{
+		Min:  values[0],
+		Mean: sum / float64(len(values)),
+		P50:  percentile(values, 50),
+		P90:  percentile(values, 90),
+		P95:  percentile(values, 95),
+		P99:  percentile(values, 99),
+		Max:  values[len(values)-1],
+	}
+}
+
+// percentile 已排序数据的分位数，取不小于p%数据的最小值
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// pacer 所有连接共享的发送节奏，按固定间隔分配发送时间
+type pacer struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newPacer rate为0时不限速
+func newPacer(rate float64) *pacer {
+	var interval time.Duration
+	if rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+	}
+	return &pacer{interval: interval}
+}
+
+// wait 等到分配的发送时间，ctx结束时返回false
+func (p *pacer) wait(ctx context.Context) bool {
+	if p.interval == 0 {
+		return ctx.Err() == nil
+	}
+	p.mutex.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	at := p.next
+	p.next = p.next.Add(p.interval)
+	p.mutex.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return ctx.Err() == nil
+	case <-ctx.Done():
+		return false
+	}
+}
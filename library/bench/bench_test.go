@@ -0,0 +1,156 @@
+// Author: Vcentor
+// Date: 2026/10/27 11:40 上午
+// desc: 压测工具的延迟统计和运行测试
+
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"socketserver/network"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestLatency(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   Latency
+	}{
+		{"empty", nil, Latency{}},
+		{"single", []float64{3}, Latency{Min: 3, Mean: 3, P50: 3, P90: 3, P95: 3, P99: 3, Max: 3}},
+		{"unsorted", []float64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5},
+			Latency{Min: 1, Mean: 5.5, P50: 5, P90: 9, P95: 10, P99: 10, Max: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latency(tt.values); got != tt.want {
+				t.Errorf("latency() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// echo 按requestId回复请求，action为FAIL时返回错误码
+func echo(data []byte) []byte {
+	var req struct {
+		RequestID string `json:"requestId"`
+		Action    string `json:"action"`
+	}
+	_ = json.Unmarshal(data, &req)
+	code := 0
+	if req.Action == "FAIL" {
+		code = 400
+	}
+	resp, _ := json.Marshal(map[string]interface{}{"requestId": req.RequestID, "action": req.Action, "code": code})
+	return resp
+}
+
+func TestRun(t *testing.T) {
+	var upgrader websocket.Upgrader
+	ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(websocket.TextMessage, echo(data)); err != nil {
+				return
+			}
+		}
+	}))
+	defer ws.Close()
+
+	parser := network.NewTCPParser()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				for {
+					data, err := parser.Decode(c)
+					if err != nil {
+						return
+					}
+					b, _ := parser.Encode(echo(data))
+					if _, err := c.Write(b); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	script := &Script{Steps: []Step{{Action: "PING", Repeat: 2}, {Action: "FAIL", Body: `{"a":1}`}}}
+	tests := []struct {
+		transport string
+		addr      string
+	}{
+		{TRANSPORT_WS, "ws" + strings.TrimPrefix(ws.URL, "http")},
+		{TRANSPORT_TCP, ln.Addr().String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.transport, func(t *testing.T) {
+			s, err := Run(context.Background(), Options{
+				Dial: network.DialOption{
+					Transport: tt.transport,
+					WS:        network.WSDialOption{Addr: tt.addr},
+					TCP:       network.TCPClientOption{Addr: tt.addr, Parser: parser},
+				},
+				Conns:    3,
+				Requests: 6,
+				Script:   script,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Connected != 3 || s.Sent != 18 || s.Responses != 18 || s.Timeouts != 0 || s.Disconnects != 0 {
+				t.Errorf("Run() = %+v", s)
+			}
+			if s.Codes["0"] != 12 || s.Codes["400"] != 6 {
+				t.Errorf("Codes = %v, want 12 success and 6 failures", s.Codes)
+			}
+		})
+	}
+}
+
+func TestRun_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		o    Options
+	}{
+		{"no script", Options{Dial: network.DialOption{Transport: TRANSPORT_WS}, Conns: 1, Requests: 1}},
+		{"bad body", Options{Dial: network.DialOption{Transport: TRANSPORT_WS}, Conns: 1, Requests: 1,
+			Script: &Script{Steps: []Step{{Action: "PING", Body: "{"}}}}},
+		{"pcm over tcp", Options{Dial: network.DialOption{Transport: TRANSPORT_TCP}, Conns: 1, Requests: 1,
+			Script: &Script{Steps: []Step{{PCM: "a.pcm"}}}}},
+		{"no limit", Options{Dial: network.DialOption{Transport: TRANSPORT_WS}, Conns: 1,
+			Script: &Script{Steps: []Step{{Action: "PING"}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Run(context.Background(), tt.o); err == nil {
+				t.Error("Run() error = nil")
+			}
+		})
+	}
+}
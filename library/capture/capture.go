@@ -0,0 +1,156 @@
+// Author: Vcentor
+// Date: 2026/10/26 3:00 下午
+// desc: 流量抓包，按会话记录收发的每条消息，每行一个json对象，二进制数据base64编码
+// 抓包文件包含原始数据，可能含有鉴权凭证，需要妥善保管
+
+package capture
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 消息方向，相对服务端
+const (
+	DIR_IN  = "in"
+	DIR_OUT = "out"
+)
+
+// 记录类型
+const (
+	TYPE_OPEN   = "open"   // 连接建立，payload为远程地址
+	TYPE_CLOSE  = "close"  // 连接断开，payload为断开原因
+	TYPE_TEXT   = "text"   // 文本消息，payload为原文
+	TYPE_BINARY = "binary" // 二进制消息，payload为base64
+)
+
+// Record 一条抓包记录
+type Record struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"sessionId"`
+	Transport string    `json:"transport"`
+	Direction string    `json:"direction,omitempty"`
+	Type      string    `json:"type"`
+	Payload   string    `json:"payload,omitempty"`
+}
+
+// NewRecord 创建当前时间的记录，二进制消息base64编码
+func NewRecord(sessionID, transport, direction, typ string, data []byte) Record {
+	var payload string
+	if typ == TYPE_BINARY {
+		payload = base64.StdEncoding.EncodeToString(data)
+	} else {
+		payload = string(data)
+	}
+	return Record{
+		Time:      time.Now(),
+		SessionID: sessionID,
+		Transport: transport,
+		Direction: direction,
+		Type:      typ,
+		Payload:   payload,
+	}
+}
+
+// MessageType 没有消息类型的协议(如tcp)按内容判断，合法utf8为文本
+func MessageType(data []byte) string {
+	if utf8.Valid(data) {
+		return TYPE_TEXT
+	}
+	return TYPE_BINARY
+}
+
+// IsMessage 是否为收发的消息
+func (r Record) IsMessage() bool {
+	return r.Type == TYPE_TEXT || r.Type == TYPE_BINARY
+}
+
+// Data 消息原始数据
+func (r Record) Data() ([]byte, error) {
+	if r.Type == TYPE_BINARY {
+		return base64.StdEncoding.DecodeString(r.Payload)
+	}
+	return []byte(r.Payload), nil
+}
+
+// Writer 并发安全的抓包写入
+type Writer struct {
+	mutex  sync.Mutex
+	w      io.Writer
+	enc    *json.Encoder
+	closed bool
+}
+
+// NewWriter 写入w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, enc: json.NewEncoder(w)}
+}
+
+// Create 追加写入文件，目录不存在时创建
+func Create(file string) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriter(f), nil
+}
+
+// Write 写入一条记录，关闭后直接丢弃
+func (w *Writer) Write(r Record) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return nil
+	}
+	return w.enc.Encode(r)
+}
+
+// Close 关闭文件，w实现了io.Closer时关闭w
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Read 读取抓包记录，按时间排序
+func Read(r io.Reader) ([]Record, error) {
+	var records []Record
+	dec := json.NewDecoder(r)
+	for {
+		var rec Record
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// ReadFile 读取抓包文件
+func ReadFile(file string) ([]Record, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
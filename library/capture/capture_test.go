@@ -0,0 +1,62 @@
+// Author: Vcentor
+// Date: 2026/10/26 6:10 下午
+// desc: 抓包文件读取和比较测试
+
+package capture
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRead(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	now := time.Now()
+	later := NewRecord("s1", "ws", DIR_OUT, TYPE_TEXT, []byte(`{"a":1}`))
+	later.Time = now.Add(time.Second)
+	earlier := NewRecord("s1", "ws", DIR_IN, TYPE_BINARY, []byte{0xff, 0x00})
+	earlier.Time = now
+	for _, r := range []Record{later, earlier} {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Direction != DIR_IN || records[1].Direction != DIR_OUT {
+		t.Fatalf("Read() = %+v, want sorted by time", records)
+	}
+	if data, err := records[0].Data(); err != nil || !bytes.Equal(data, []byte{0xff, 0x00}) {
+		t.Errorf("Data() = %v, %v", data, err)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   message
+		got    message
+		ignore []string
+		equal  bool
+	}{
+		{"same", message{TYPE_TEXT, []byte("pong")}, message{TYPE_TEXT, []byte("pong")}, nil, true},
+		{"type", message{TYPE_TEXT, []byte("pong")}, message{TYPE_BINARY, []byte("pong")}, nil, false},
+		{"key order", message{TYPE_TEXT, []byte(`{"a":1,"b":2}`)}, message{TYPE_TEXT, []byte(`{"b":2,"a":1}`)}, nil, true},
+		{"ignore nested", message{TYPE_TEXT, []byte(`{"a":1,"body":{"ts":1}}`)},
+			message{TYPE_TEXT, []byte(`{"a":1,"body":{"ts":2}}`)}, []string{"body.ts"}, true},
+		{"not ignored", message{TYPE_TEXT, []byte(`{"a":1,"body":{"ts":1}}`)},
+			message{TYPE_TEXT, []byte(`{"a":1,"body":{"ts":2}}`)}, []string{"ts"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := equal(tt.want, tt.got, tt.ignore); got != tt.equal {
+				t.Errorf("equal() = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+// Author: Vcentor
+// Date: 2026/10/26 3:40 下午
+// desc: 回放抓包，按会话重新建立连接发送收到的消息，并与记录的响应逐条比较
+// 每个会话的响应按顺序比较，json消息可以忽略时间戳等不固定的字段
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"socketserver/network"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认回放参数
+const (
+	DEFAULT_REPLAY_WAIT = 2 * time.Second
+	maxDiffPayload      = 512 // 差异中展示的消息最大长度
+)
+
+// ReplayOption 回放选项
+type ReplayOption struct {
+	WS     network.WSDialOption    // websocket地址如 ws://127.0.0.1:8989/digitalhuman-ws，以及握手请求头、Token和TLS配置
+	TCP    network.TCPClientOption // tcp地址如 127.0.0.1:8990，以及消息格式和TLS配置，消息格式为空时使用默认格式
+	Speed  float64                 // 1为按原始时间间隔发送，2为两倍速，0为不等待
+	Wait   time.Duration           // 发送完成后等待响应的最长时间，默认2s
+	Ignore []string                // 比较json响应时忽略的字段，点分路径，如 body.timestamp
+}
+
+// Diff 响应差异，Want或Got为空表示缺少或多出响应
+type Diff struct {
+	SessionID string `json:"sessionId"`
+	Index     int    `json:"index"`
+	Want      string `json:"want,omitempty"`
+	Got       string `json:"got,omitempty"`
+}
+
+// Result 回放结果
+type Result struct {
+	Sessions int
+	Sent     int
+	Expected int
+	Received int
+	Diffs    []Diff
+	Errors   []error
+}
+
+// OK 没有差异和错误
+func (r *Result) OK() bool {
+	return len(r.Diffs) == 0 && len(r.Errors) == 0
+}
+
+// Report 输出回放结果
+func (r *Result) Report(w io.Writer) {
+	for _, err := range r.Errors {
+		fmt.Fprintf(w, "ERROR %v\n", err)
+	}
+	for _, d := range r.Diffs {
+		fmt.Fprintf(w, "DIFF session=%s index=%d\n  want: %s\n  got:  %s\n", d.SessionID, d.Index, d.Want, d.Got)
+	}
+	fmt.Fprintf(w, "sessions=%d sent=%d expected=%d received=%d diffs=%d errors=%d\n",
+		r.Sessions, r.Sent, r.Expected, r.Received, len(r.Diffs), len(r.Errors))
+}
+
+// session 一个会话的记录
+type session struct {
+	id        string
+	transport string
+	records   []Record
+}
+
+// sortRecords 按时间排序，同一时间保持原有顺序
+func sortRecords(records []Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+}
+
+// sessions 按首条记录的顺序分组
+func sessions(records []Record) []*session {
+	var (
+		list  []*session
+		index = make(map[string]*session)
+	)
+	for _, r := range records {
+		s, ok := index[r.SessionID]
+		if !ok {
+			s = &session{id: r.SessionID, transport: r.Transport}
+			index[r.SessionID] = s
+			list = append(list, s)
+		}
+		s.records = append(s.records, r)
+	}
+	return list
+}
+
+// Replay 并发回放所有会话，会话间和会话内的发送时间按Speed缩放
+func Replay(ctx context.Context, records []Record, opt ReplayOption) *Result {
+	if opt.Wait <= 0 {
+		opt.Wait = DEFAULT_REPLAY_WAIT
+	}
+	var (
+		result = &Result{}
+		mutex  sync.Mutex
+		wg     sync.WaitGroup
+		start  = time.Now()
+	)
+	if len(records) == 0 {
+		return result
+	}
+	sortRecords(records)
+	base := records[0].Time
+	for _, s := range sessions(records) {
+		wg.Add(1)
+		go func(s *session) {
+			defer wg.Done()
+			r := replaySession(ctx, s, opt, base, start)
+			mutex.Lock()
+			result.Sessions++
+			result.Sent += r.Sent
+			result.Expected += r.Expected
+			result.Received += r.Received
+			result.Diffs = append(result.Diffs, r.Diffs...)
+			result.Errors = append(result.Errors, r.Errors...)
+			mutex.Unlock()
+		}(s)
+	}
+	wg.Wait()
+	// 会话并发执行，结果按会话和序号排序便于比较
+	sort.SliceStable(result.Diffs, func(i, j int) bool {
+		if result.Diffs[i].SessionID != result.Diffs[j].SessionID {
+			return result.Diffs[i].SessionID < result.Diffs[j].SessionID
+		}
+		return result.Diffs[i].Index < result.Diffs[j].Index
+	})
+	return result
+}
+
+// message 收发的消息
+type message struct {
+	typ  string
+	data []byte
+}
+
+// replaySession 回放单个会话
+func replaySession(ctx context.Context, s *session, opt ReplayOption, base, start time.Time) *Result {
+	var result = &Result{}
+	fail := func(err error) *Result {
+		result.Errors = append(result.Errors, fmt.Errorf("session %s: %w", s.id, err))
+		return result
+	}
+
+	var expected []message
+	for _, r := range s.records {
+		if r.IsMessage() && r.Direction == DIR_OUT {
+			data, err := r.Data()
+			if err != nil {
+				return fail(err)
+			}
+			expected = append(expected, message{typ: r.Type, data: data})
+		}
+	}
+	result.Expected = len(expected)
+
+	// 第一条记录的时间建立连接
+	if !wait(ctx, s.records[0].Time.Sub(base), opt.Speed, start) {
+		return fail(ctx.Err())
+	}
+	c, err := dial(ctx, s.transport, opt)
+	if err != nil {
+		return fail(err)
+	}
+	defer c.Close()
+
+	var (
+		mutex    sync.Mutex
+		received []message
+		notify   = make(chan struct{}, 1)
+		readErr  error
+	)
+	go func() {
+		for {
+			m, err := recv(c)
+			mutex.Lock()
+			if err != nil {
+				readErr = err
+			} else {
+				received = append(received, m)
+			}
+			mutex.Unlock()
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, r := range s.records {
+		if !r.IsMessage() || r.Direction != DIR_IN {
+			continue
+		}
+		data, err := r.Data()
+		if err != nil {
+			return fail(err)
+		}
+		if !wait(ctx, r.Time.Sub(base), opt.Speed, start) {
+			return fail(ctx.Err())
+		}
+		if err := c.WriteMsg(data, r.Type == TYPE_BINARY); err != nil {
+			return fail(err)
+		}
+		result.Sent++
+	}
+
+	// 收齐响应、连接断开或超过等待时间后比较
+	timer := time.NewTimer(opt.Wait)
+	defer timer.Stop()
+WAIT:
+	for {
+		mutex.Lock()
+		done := len(received) >= len(expected) || readErr != nil
+		mutex.Unlock()
+		if done {
+			break
+		}
+		select {
+		case <-notify:
+		case <-timer.C:
+			break WAIT
+		case <-ctx.Done():
+			break WAIT
+		}
+	}
+	c.Close()
+
+	mutex.Lock()
+	got := append([]message(nil), received...)
+	mutex.Unlock()
+	result.Received = len(got)
+	for i := 0; i < len(expected) || i < len(got); i++ {
+		var want, have *message
+		if i < len(expected) {
+			want = &expected[i]
+		}
+		if i < len(got) {
+			have = &got[i]
+		}
+		if want != nil && have != nil && equal(*want, *have, opt.Ignore) {
+			continue
+		}
+		result.Diffs = append(result.Diffs, Diff{SessionID: s.id, Index: i, Want: show(want), Got: show(have)})
+	}
+	return result
+}
+
+// wait 等待到offset按speed缩放后的时间，ctx取消时返回false
+func wait(ctx context.Context, offset time.Duration, speed float64, start time.Time) bool {
+	if speed > 0 {
+		d := time.Until(start.Add(time.Duration(float64(offset) / speed)))
+		if d > 0 {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+	return ctx.Err() == nil
+}
+
+// equal 比较消息，json消息忽略指定字段且不区分字段顺序
+func equal(want, got message, ignore []string) bool {
+	if want.typ != got.typ {
+		return false
+	}
+	if bytes.Equal(want.data, got.data) {
+		return true
+	}
+	w, err1 := normalize(want.data, ignore)
+	g, err2 := normalize(got.data, ignore)
+	return err1 == nil && err2 == nil && bytes.Equal(w, g)
+}
+
+// normalize 删除忽略的字段后重新序列化，map的key按字母排序
+func normalize(data []byte, ignore []string) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	for _, path := range ignore {
+		deletePath(v, strings.Split(path, "."))
+	}
+	return json.Marshal(v)
+}
+
+// deletePath 删除点分路径对应的字段
+func deletePath(v interface{}, path []string) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(path) == 0 {
+		return
+	}
+	if len(path) == 1 {
+		delete(m, path[0])
+		return
+	}
+	deletePath(m[path[0]], path[1:])
+}
+
+// show 展示消息，过长时截断
+func show(m *message) string {
+	if m == nil {
+		return ""
+	}
+	s := NewRecord("", "", "", m.typ, m.data).Payload
+	if len(s) > maxDiffPayload {
+		s = s[:maxDiffPayload] + "..."
+	}
+	return m.typ + " " + s
+}
+
+// dial 按传输协议建立连接
+func dial(ctx context.Context, transport string, opt ReplayOption) (network.ClientConn, error) {
+	switch transport {
+	case network.TRANSPORT_WS:
+		if opt.WS.Addr == "" {
+			return nil, errors.New("websocket address is required")
+		}
+	case network.TRANSPORT_TCP:
+		if opt.TCP.Addr == "" {
+			return nil, errors.New("tcp address is required")
+		}
+	}
+	return network.Dial(ctx, network.DialOption{Transport: transport, WS: opt.WS, TCP: opt.TCP})
+}
+
+// recv 读取一条消息，tcp消息类型按内容判断
+func recv(c network.ClientConn) (message, error) {
+	data, binary, err := c.ReadMsg()
+	if err != nil {
+		return message{}, err
+	}
+	if binary {
+		return message{typ: TYPE_BINARY, data: data}, nil
+	}
+	return message{typ: MessageType(data), data: data}, nil
+}
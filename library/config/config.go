@@ -0,0 +1,306 @@
+// Author: Vcentor
+// Date: 2026/10/22 3:10 下午
+// desc: 配置加载，依次应用声明的默认值、toml文件和环境变量，最后按标签校验
+// 默认值标签 default:"100"，配置文件中未出现该配置项时生效
+// 校验标签 validate:"required,min=1,max=100,oneof=a b,addr"
+// 环境变量名由前缀和toml路径生成，配置块名去掉_conf后缀，如ws_conf.listen_addr对应SOCKETSERVER_WS_LISTEN_ADDR
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ENV_PREFIX 环境变量前缀
+const ENV_PREFIX = "SOCKETSERVER"
+
+// Validator 字段校验通过后调用，用于跨字段校验
+type Validator interface {
+	Validate() error
+}
+
+// Errors 配置错误列表
+type Errors []error
+
+// Error 每行一个错误
+func (e Errors) Error() string {
+	var msgs = make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// FieldError 配置项错误
+type FieldError struct {
+	File string
+	Key  string
+	Msg  string
+}
+
+// Error 文件名: 配置项: 错误信息，跨字段校验的错误没有配置项
+func (e *FieldError) Error() string {
+	if e.Key == "" {
+		return e.File + ": " + e.Msg
+	}
+	return e.File + ": " + e.Key + ": " + e.Msg
+}
+
+// Load 读取toml配置文件到v，v必须是结构体指针
+// envPrefix为空时不读取环境变量
+func Load(file, envPrefix string, v interface{}) error {
+	name := filepath.Base(file)
+	md, err := toml.DecodeFile(file, v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	l := &loader{file: name, md: md}
+	for _, key := range md.Undecoded() {
+		l.fail(key.String(), "unknown config key")
+	}
+	rv := reflect.ValueOf(v).Elem()
+	l.defaults(rv, nil)
+	if envPrefix != "" {
+		l.env(rv, envPrefix)
+	}
+	l.validate(rv, nil)
+	if len(l.errs) > 0 {
+		return l.errs
+	}
+	return nil
+}
+
+// Defaults 为v的所有配置项设置默认值，用于不读取配置文件直接构建配置
+func Defaults(v interface{}) error {
+	l := &loader{file: "defaults"}
+	l.defaults(reflect.ValueOf(v).Elem(), nil)
+	if len(l.errs) > 0 {
+		return l.errs
+	}
+	return nil
+}
+
+// Validate 按validate标签和Validator校验v，name用于错误信息
+func Validate(name string, v interface{}) error {
+	l := &loader{file: name}
+	l.validate(reflect.ValueOf(v).Elem(), nil)
+	if len(l.errs) > 0 {
+		return l.errs
+	}
+	return nil
+}
+
+// loader 加载过程中收集错误，一次返回所有错误
+type loader struct {
+	file string
+	md   toml.MetaData
+	errs Errors
+}
+
+// fail 记录错误
+func (l *loader) fail(key, format string, args ...interface{}) {
+	l.errs = append(l.errs, &FieldError{File: l.file, Key: key, Msg: fmt.Sprintf(format, args...)})
+}
+
+// fields 遍历有toml标签的字段
+func fields(rv reflect.Value, fn func(tag string, field reflect.StructField, fv reflect.Value)) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+		if tag == "" || tag == "-" || t.Field(i).PkgPath != "" {
+			continue
+		}
+		fn(tag, t.Field(i), rv.Field(i))
+	}
+}
+
+// defaults 配置文件中未出现的配置项使用默认值
+func (l *loader) defaults(rv reflect.Value, path []string) {
+	fields(rv, func(tag string, field reflect.StructField, fv reflect.Value) {
+		key := append(append([]string{}, path...), tag)
+		if fv.Kind() == reflect.Struct {
+			l.defaults(fv, key)
+			return
+		}
+		def, ok := field.Tag.Lookup("default")
+		if !ok || l.md.IsDefined(key...) {
+			return
+		}
+		if err := setValue(fv, def); err != nil {
+			l.fail(strings.Join(key, "."), "invalid default value %q: %v", def, err)
+		}
+	})
+}
+
+// env 环境变量覆盖配置文件
+func (l *loader) env(rv reflect.Value, prefix string) {
+	fields(rv, func(tag string, field reflect.StructField, fv reflect.Value) {
+		name := prefix + "_" + strings.ToUpper(strings.TrimSuffix(tag, "_conf"))
+		if fv.Kind() == reflect.Struct {
+			l.env(fv, name)
+			return
+		}
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := setValue(fv, s); err != nil {
+			l.fail(name, "invalid value %q: %v", s, err)
+		}
+	})
+}
+
+// validate 按validate标签校验，再调用Validator
+func (l *loader) validate(rv reflect.Value, path []string) {
+	fields(rv, func(tag string, field reflect.StructField, fv reflect.Value) {
+		key := append(append([]string{}, path...), tag)
+		if fv.Kind() == reflect.Struct {
+			l.validate(fv, key)
+			return
+		}
+		rules, ok := field.Tag.Lookup("validate")
+		if !ok {
+			return
+		}
+		for _, rule := range strings.Split(rules, ",") {
+			if msg := check(fv, rule); msg != "" {
+				l.fail(strings.Join(key, "."), "%s", msg)
+				break
+			}
+		}
+	})
+	if rv.CanAddr() {
+		if v, ok := rv.Addr().Interface().(Validator); ok {
+			if err := v.Validate(); err != nil {
+				l.fail(strings.Join(path, "."), "%v", err)
+			}
+		}
+	}
+}
+
+// check 校验单条规则，通过时返回空字符串
+func check(fv reflect.Value, rule string) string {
+	name, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+	switch name {
+	case "required":
+		if fv.IsZero() {
+			return "is required"
+		}
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return "invalid rule " + rule
+		}
+		n, ok := number(fv)
+		if !ok {
+			return "rule " + rule + " only supports numbers"
+		}
+		if name == "min" && n < limit {
+			return fmt.Sprintf("must be >= %s, got %v", arg, fv.Interface())
+		}
+		if name == "max" && n > limit {
+			return fmt.Sprintf("must be <= %s, got %v", arg, fv.Interface())
+		}
+	case "oneof":
+		got := fmt.Sprint(fv.Interface())
+		for _, want := range strings.Fields(arg) {
+			if got == want {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s], got %q", arg, got)
+	case "addr":
+		if fv.Kind() != reflect.String || fv.String() == "" {
+			return ""
+		}
+		if err := checkAddr(fv.String()); err != nil {
+			return err.Error()
+		}
+	default:
+		return "unknown rule " + rule
+	}
+	return ""
+}
+
+// checkAddr 校验host:port格式的地址
+func checkAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// number 数值类型转换为float64
+func number(fv reflect.Value) (float64, bool) {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), true
+	}
+	return 0, false
+}
+
+// setValue 把字符串转换为字段类型并赋值，切片按逗号分隔
+func setValue(fv reflect.Value, s string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		if s != "" {
+			items = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
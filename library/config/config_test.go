@@ -0,0 +1,127 @@
+// Author: Vcentor
+// Date: 2026/10/22 4:20 下午
+// desc: 配置加载、默认值、环境变量覆盖和校验测试
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testServerConf struct {
+	Timeout int        `toml:"timeout" default:"5" validate:"min=1"`
+	WS      testWSConf `toml:"ws_conf"`
+}
+
+type testWSConf struct {
+	ListenAddr string   `toml:"listen_addr" validate:"required,addr"`
+	Policy     string   `toml:"policy" default:"reject" validate:"oneof=reject disconnect"`
+	Allow      []string `toml:"allow"`
+	Rate       float64  `toml:"rate" validate:"min=0,max=100"`
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		want    testServerConf
+		wantErr []string
+	}{
+		{
+			name:    "defaults",
+			content: "[ws_conf]\nlisten_addr = \":80\"\n",
+			want:    testServerConf{Timeout: 5, WS: testWSConf{ListenAddr: ":80", Policy: "reject"}},
+		},
+		{
+			name:    "explicit-zero-is-validated",
+			content: "timeout = 0\n[ws_conf]\nlisten_addr = \":80\"\n",
+			wantErr: []string{"test.toml: timeout: must be >= 1, got 0"},
+		},
+		{
+			name:    "env-override",
+			content: "[ws_conf]\nlisten_addr = \":80\"\n",
+			env: map[string]string{
+				"TEST_WS_LISTEN_ADDR": "127.0.0.1:81",
+				"TEST_WS_ALLOW":       "10.0.0.0/8, 127.0.0.1",
+				"TEST_WS_RATE":        "1.5",
+			},
+			want: testServerConf{Timeout: 5, WS: testWSConf{ListenAddr: "127.0.0.1:81", Policy: "reject",
+				Allow: []string{"10.0.0.0/8", "127.0.0.1"}, Rate: 1.5}},
+		},
+		{
+			name:    "all-errors",
+			content: "unknown = 1\n[ws_conf]\nlisten_addr = \"bad\"\npolicy = \"drop\"\nrate = 200.0\n",
+			env:     map[string]string{"TEST_TIMEOUT": "x"},
+			wantErr: []string{
+				"test.toml: unknown: unknown config key",
+				"test.toml: TEST_TIMEOUT: invalid value",
+				"test.toml: ws_conf.listen_addr: address bad: missing port in address",
+				"test.toml: ws_conf.policy: must be one of [reject disconnect], got \"drop\"",
+				"test.toml: ws_conf.rate: must be <= 100, got 200",
+			},
+		},
+	}
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.toml")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ioutil.WriteFile(file, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+			var got testServerConf
+			err := Load(file, "TEST", &got)
+			if len(tt.wantErr) > 0 {
+				errs, ok := err.(Errors)
+				if !ok || len(errs) != len(tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %d errors", err, len(tt.wantErr))
+				}
+				for i, want := range tt.wantErr {
+					if !strings.HasPrefix(errs[i].Error(), want) {
+						t.Errorf("Load() error[%d] = %v, want %s", i, errs[i], want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got.Timeout != tt.want.Timeout || got.WS.ListenAddr != tt.want.WS.ListenAddr ||
+				got.WS.Policy != tt.want.WS.Policy || got.WS.Rate != tt.want.WS.Rate ||
+				strings.Join(got.WS.Allow, ",") != strings.Join(tt.want.WS.Allow, ",") {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultsValidate(t *testing.T) {
+	var conf testServerConf
+	if err := Defaults(&conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Timeout != 5 || conf.WS.Policy != "reject" {
+		t.Fatalf("Defaults() = %+v", conf)
+	}
+	err := Validate("server", &conf)
+	if err == nil || err.Error() != "server: ws_conf.listen_addr: is required" {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	conf.WS.ListenAddr = "127.0.0.1:0"
+	if err := Validate("server", &conf); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+}
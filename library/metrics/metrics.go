@@ -0,0 +1,354 @@
+// Author: Vcentor
+// Date: 2026/10/24 3:00 下午
+// desc: 指标统计，输出Prometheus文本格式，不依赖外部服务
+// 标签值按声明顺序作为可变参数传入，如 requests.Inc("ASR", "0")
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 指标类型
+const (
+	TYPE_COUNTER   = "counter"
+	TYPE_GAUGE     = "gauge"
+	TYPE_HISTOGRAM = "histogram"
+)
+
+// DefBuckets 默认的直方图分桶，单位s
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// labelSep 拼接标签值作为序列的key
+const labelSep = "\xff"
+
+// collector 指标
+type collector interface {
+	describe() *descriptor
+	write(buf *bytes.Buffer)
+}
+
+// descriptor 指标名称、说明、类型和标签名
+type descriptor struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+// Registry 指标注册表，同一进程可以有多个注册表
+type Registry struct {
+	mutex      sync.Mutex
+	collectors map[string]collector
+	onCollect  []func()
+}
+
+// NewRegistry 实例化注册表
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// register 注册指标，名称重复时panic
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	name := c.describe().name
+	if _, ok := r.collectors[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.collectors[name] = c
+}
+
+// OnCollect 每次输出前调用，用于在采集时计算Gauge的值
+func (r *Registry) OnCollect(fn func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.onCollect = append(r.onCollect, fn)
+}
+
+// WriteTo 按名称顺序输出所有指标
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	onCollect := append([]func(){}, r.onCollect...)
+	var collectors = make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mutex.Unlock()
+
+	for _, fn := range onCollect {
+		fn()
+	}
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].describe().name < collectors[j].describe().name
+	})
+	var buf bytes.Buffer
+	for _, c := range collectors {
+		d := c.describe()
+		fmt.Fprintf(&buf, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", d.name, d.typ)
+		c.write(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP 输出Prometheus文本格式
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+// series 按标签值存储的序列
+type series struct {
+	descriptor
+	mutex  sync.Mutex
+	values map[string]*value
+}
+
+// value 单个序列的值，直方图使用counts和sum
+type value struct {
+	labels []string
+	v      float64
+	counts []uint64
+	sum    float64
+}
+
+func newSeries(name, help, typ string, labels []string) series {
+	return series{
+		descriptor: descriptor{name: name, help: help, typ: typ, labels: labels},
+		values:     make(map[string]*value),
+	}
+}
+
+func (s *series) describe() *descriptor {
+	return &s.descriptor
+}
+
+// get 获取标签值对应的序列，调用方需持有锁，标签值数量不匹配时panic
+func (s *series) get(lvs []string) *value {
+	if len(lvs) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", s.name, len(s.labels), len(lvs)))
+	}
+	key := strings.Join(lvs, labelSep)
+	v, ok := s.values[key]
+	if !ok {
+		v = &value{labels: append([]string{}, lvs...)}
+		s.values[key] = v
+	}
+	return v
+}
+
+// sorted 按标签值排序的序列，保证输出顺序稳定，调用方需持有锁
+func (s *series) sorted() []*value {
+	var keys = make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var values = make([]*value, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, s.values[k])
+	}
+	return values
+}
+
+// writeSimple 输出counter和gauge
+func (s *series) writeSimple(buf *bytes.Buffer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, v := range s.sorted() {
+		writeSample(buf, s.name, s.labels, v.labels, "", "", v.v)
+	}
+}
+
+// Counter 只增不减的计数
+type Counter struct {
+	series
+}
+
+// NewCounter 注册计数指标
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{series: newSeries(name, help, TYPE_COUNTER, labels)}
+	r.register(c)
+	return c
+}
+
+// Inc 加1
+func (c *Counter) Inc(lvs ...string) {
+	c.Add(1, lvs...)
+}
+
+// Add 增加delta，delta为负数时忽略
+func (c *Counter) Add(delta float64, lvs ...string) {
+	if delta < 0 {
+		return
+	}
+	c.mutex.Lock()
+	c.get(lvs).v += delta
+	c.mutex.Unlock()
+}
+
+// Value 当前值
+func (c *Counter) Value(lvs ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.get(lvs).v
+}
+
+func (c *Counter) write(buf *bytes.Buffer) {
+	c.writeSimple(buf)
+}
+
+// Gauge 可增可减的瞬时值
+type Gauge struct {
+	series
+}
+
+// NewGauge 注册瞬时值指标
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{series: newSeries(name, help, TYPE_GAUGE, labels)}
+	r.register(g)
+	return g
+}
+
+// Set 设置值
+func (g *Gauge) Set(v float64, lvs ...string) {
+	g.mutex.Lock()
+	g.get(lvs).v = v
+	g.mutex.Unlock()
+}
+
+// Add 增加delta，可以为负数
+func (g *Gauge) Add(delta float64, lvs ...string) {
+	g.mutex.Lock()
+	g.get(lvs).v += delta
+	g.mutex.Unlock()
+}
+
+// Inc 加1
+func (g *Gauge) Inc(lvs ...string) {
+	g.Add(1, lvs...)
+}
+
+// Dec 减1
+func (g *Gauge) Dec(lvs ...string) {
+	g.Add(-1, lvs...)
+}
+
+// Value 当前值
+func (g *Gauge) Value(lvs ...string) float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.get(lvs).v
+}
+
+func (g *Gauge) write(buf *bytes.Buffer) {
+	g.writeSimple(buf)
+}
+
+// Histogram 分桶统计，用于耗时等分布
+type Histogram struct {
+	series
+	buckets []float64
+}
+
+// NewHistogram 注册分桶统计指标，buckets为空时使用DefBuckets
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{series: newSeries(name, help, TYPE_HISTOGRAM, labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(v float64, lvs ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s := h.get(lvs)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets)+1)
+	}
+	i := sort.SearchFloat64s(h.buckets, v)
+	s.counts[i]++
+	s.sum += v
+}
+
+func (h *Histogram) write(buf *bytes.Buffer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, s := range h.sorted() {
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(buf, h.name+"_bucket", h.labels, s.labels, "le", formatFloat(upper), float64(cumulative))
+		}
+		cumulative += s.counts[len(h.buckets)]
+		writeSample(buf, h.name+"_bucket", h.labels, s.labels, "le", "+Inf", float64(cumulative))
+		writeSample(buf, h.name+"_sum", h.labels, s.labels, "", "", s.sum)
+		writeSample(buf, h.name+"_count", h.labels, s.labels, "", "", float64(cumulative))
+	}
+}
+
+// writeSample 输出一行样本，extraName不为空时追加一个标签
+func writeSample(buf *bytes.Buffer, name string, labels, lvs []string, extraName, extraValue string, v float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		buf.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(l + `="` + escapeLabel(lvs[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatFloat(v))
+	buf.WriteByte('\n')
+}
+
+// formatFloat 输出数值，整数不带小数点
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp 转义说明中的反斜杠和换行
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+// escapeLabel 转义标签值中的反斜杠、换行和双引号
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
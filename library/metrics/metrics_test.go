@@ -0,0 +1,94 @@
+// Author: Vcentor
+// Date: 2026/10/24 4:10 下午
+// desc: 指标注册和Prometheus文本输出测试
+
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests by action.", "action", "code")
+	conns := r.NewGauge("connections", "Active connections.", "transport")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 0.5}, "action")
+	uptime := r.NewGauge("uptime", "Uptime with \\ and\nnewline.")
+	r.OnCollect(func() {
+		uptime.Set(3)
+	})
+
+	requests.Inc("ASR", "0")
+	requests.Add(2, "ASR", "0")
+	requests.Add(-1, "ASR", "0")
+	requests.Inc(`T"TS`, "1001")
+	conns.Inc("ws")
+	conns.Inc("ws")
+	conns.Dec("ws")
+	conns.Set(5, "tcp")
+	latency.Observe(0.05, "ASR")
+	latency.Observe(0.1, "ASR")
+	latency.Observe(0.3, "ASR")
+	latency.Observe(2, "ASR")
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP connections Active connections.
+# TYPE connections gauge
+connections{transport="tcp"} 5
+connections{transport="ws"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{action="ASR",le="0.1"} 2
+latency_seconds_bucket{action="ASR",le="0.5"} 3
+latency_seconds_bucket{action="ASR",le="+Inf"} 4
+latency_seconds_sum{action="ASR"} 2.45
+latency_seconds_count{action="ASR"} 4
+# HELP requests_total Requests by action.
+# TYPE requests_total counter
+requests_total{action="ASR",code="0"} 3
+requests_total{action="T\"TS",code="1001"} 1
+# HELP uptime Uptime with \\ and\nnewline.
+# TYPE uptime gauge
+uptime 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", ct)
+	}
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(r *Registry)
+	}{
+		{"duplicate", func(r *Registry) {
+			r.NewCounter("a", "")
+			r.NewGauge("a", "")
+		}},
+		{"label values", func(r *Registry) {
+			r.NewCounter("a", "", "x").Inc()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expect panic")
+				}
+			}()
+			tt.fn(NewRegistry())
+		})
+	}
+}
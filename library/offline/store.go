@@ -0,0 +1,400 @@
+// Author: Vcentor
+// Date: 2026/10/19 10:12 上午
+// desc: 离线消息存储，用户不在线时落盘，上线鉴权后按序补发
+
+package offline
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	logFileName = "offline.log"
+
+	opPut = "put"
+	opDel = "del"
+
+	// 已删除记录数超过该值且多于存活记录数时触发压缩
+	compactMinDead = 1024
+)
+
+var (
+	ErrClosed      = errors.New("offline store is closed")
+	ErrMsgTooLarge = errors.New("offline message exceeds max bytes")
+)
+
+// Options 离线存储配置
+type Options struct {
+	Dir             string        // 存储目录
+	TTL             time.Duration // 消息有效期，<=0不过期
+	MaxMsgNum       int           // 每个用户最多保留消息数，<=0不限制
+	MaxBytes        int           // 每个用户最多保留字节数，<=0不限制
+	CompactInterval time.Duration // 定时压缩间隔，<=0不定时压缩
+	Sync            bool          // 每次写入是否fsync
+}
+
+// Message 离线消息
+type Message struct {
+	ID      uint64 `json:"id"`
+	UID     string `json:"uid"`
+	Payload []byte `json:"payload"`
+	Created int64  `json:"created"` // 纳秒时间戳
+	Expire  int64  `json:"expire"`  // 纳秒时间戳，0为不过期
+}
+
+// expired 是否过期
+func (m *Message) expired(now int64) bool {
+	return m.Expire > 0 && m.Expire <= now
+}
+
+// record 日志记录
+type record struct {
+	Op string `json:"op"`
+	*Message
+}
+
+// Store 基于追加日志的离线消息存储
+type Store struct {
+	mutex      sync.Mutex
+	opts       Options
+	file       *os.File
+	seq        uint64
+	queues     map[string][]*Message
+	bytes      map[string]int
+	delivering map[string]bool
+	live       int
+	dead       int
+	closeFlag  bool
+	closeChan  chan byte
+}
+
+// Open 打开离线存储，重放日志恢复未投递的消息
+func Open(opts Options) (*Store, error) {
+	if err := os.MkdirAll(opts.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		opts:       opts,
+		queues:     make(map[string][]*Message),
+		bytes:      make(map[string]int),
+		delivering: make(map[string]bool),
+		closeChan:  make(chan byte),
+	}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	// 启动时压缩一次，清理已投递和过期的消息
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	if opts.CompactInterval > 0 {
+		go s.compactLoop()
+	}
+	return s, nil
+}
+
+// replay 重放日志
+func (s *Store) replay() error {
+	f, err := os.Open(s.logPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	index := make(map[uint64]*Message)
+	var order []*Message
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var r record
+		// 进程崩溃时最后一行可能写了一半，直接忽略
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil || r.Message == nil {
+			continue
+		}
+		if r.ID > s.seq {
+			s.seq = r.ID
+		}
+		switch r.Op {
+		case opPut:
+			index[r.ID] = r.Message
+			order = append(order, r.Message)
+		case opDel:
+			delete(index, r.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range order {
+		if _, ok := index[m.ID]; !ok {
+			continue
+		}
+		s.queues[m.UID] = append(s.queues[m.UID], m)
+		s.bytes[m.UID] += len(m.Payload)
+		s.live++
+	}
+	return nil
+}
+
+// Put 保存用户离线消息，超出容量时丢弃最早的消息
+func (s *Store) Put(uid string, payload []byte) error {
+	if s.opts.MaxBytes > 0 && len(payload) > s.opts.MaxBytes {
+		return ErrMsgTooLarge
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closeFlag {
+		return ErrClosed
+	}
+
+	now := time.Now().UnixNano()
+	s.seq++
+	m := &Message{
+		ID:      s.seq,
+		UID:     uid,
+		Payload: payload,
+		Created: now,
+	}
+	if s.opts.TTL > 0 {
+		m.Expire = now + int64(s.opts.TTL)
+	}
+	if err := s.append(record{Op: opPut, Message: m}); err != nil {
+		return err
+	}
+	s.queues[uid] = append(s.queues[uid], m)
+	s.bytes[uid] += len(payload)
+	s.live++
+
+	// 超出条数或字节数上限，淘汰最早的消息
+	for len(s.queues[uid]) > 1 &&
+		((s.opts.MaxMsgNum > 0 && len(s.queues[uid]) > s.opts.MaxMsgNum) ||
+			(s.opts.MaxBytes > 0 && s.bytes[uid] > s.opts.MaxBytes)) {
+		if err := s.remove(uid, s.queues[uid][0].ID); err != nil {
+			return err
+		}
+	}
+	return s.maybeCompact()
+}
+
+// Deliver 按序投递用户的离线消息，send返回错误时停止投递，未投递的消息保留
+func (s *Store) Deliver(uid string, send func(payload []byte) error) (int, error) {
+	s.mutex.Lock()
+	if s.closeFlag {
+		s.mutex.Unlock()
+		return 0, ErrClosed
+	}
+	// 同一用户同时只有一个投递，避免重复下发
+	if s.delivering[uid] {
+		s.mutex.Unlock()
+		return 0, nil
+	}
+	s.delivering[uid] = true
+	pending := make([]*Message, len(s.queues[uid]))
+	copy(pending, s.queues[uid])
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.delivering, uid)
+		s.mutex.Unlock()
+	}()
+
+	var (
+		n   int
+		err error
+		now = time.Now().UnixNano()
+	)
+	for _, m := range pending {
+		if !m.expired(now) {
+			if err = send(m.Payload); err != nil {
+				break
+			}
+			n++
+		}
+		s.mutex.Lock()
+		if s.closeFlag {
+			s.mutex.Unlock()
+			return n, ErrClosed
+		}
+		rmErr := s.remove(uid, m.ID)
+		s.mutex.Unlock()
+		if rmErr != nil {
+			return n, rmErr
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if compactErr := s.maybeCompact(); err == nil {
+		err = compactErr
+	}
+	return n, err
+}
+
+// Pending 用户待投递消息数
+func (s *Store) Pending(uid string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.queues[uid])
+}
+
+// Compact 清理过期消息并重写日志
+func (s *Store) Compact() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closeFlag {
+		return ErrClosed
+	}
+	return s.compact()
+}
+
+// Close 关闭存储
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closeFlag {
+		return nil
+	}
+	s.closeFlag = true
+	close(s.closeChan)
+	return s.file.Close()
+}
+
+// compactLoop 定时压缩
+func (s *Store) compactLoop() {
+	ticker := time.NewTicker(s.opts.CompactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.Compact()
+		case <-s.closeChan:
+			return
+		}
+	}
+}
+
+// remove 删除消息并写入删除记录，调用方需持有锁
+func (s *Store) remove(uid string, id uint64) error {
+	queue := s.queues[uid]
+	for i, m := range queue {
+		if m.ID != id {
+			continue
+		}
+		if err := s.append(record{Op: opDel, Message: &Message{ID: id, UID: uid}}); err != nil {
+			return err
+		}
+		s.bytes[uid] -= len(m.Payload)
+		s.queues[uid] = append(queue[:i:i], queue[i+1:]...)
+		if len(s.queues[uid]) == 0 {
+			delete(s.queues, uid)
+			delete(s.bytes, uid)
+		}
+		s.live--
+		// put和del两条记录都成为无效记录
+		s.dead += 2
+		return nil
+	}
+	return nil
+}
+
+// maybeCompact 无效记录过多时压缩，调用方需持有锁
+func (s *Store) maybeCompact() error {
+	if s.dead < compactMinDead || s.dead < s.live {
+		return nil
+	}
+	return s.compact()
+}
+
+// compact 只保留未过期的存活消息重写日志，调用方需持有锁
+func (s *Store) compact() error {
+	now := time.Now().UnixNano()
+	tmpPath := s.logPath() + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	live := 0
+	for uid, queue := range s.queues {
+		kept := queue[:0]
+		for _, m := range queue {
+			if m.expired(now) {
+				s.bytes[uid] -= len(m.Payload)
+				continue
+			}
+			if err := enc.Encode(record{Op: opPut, Message: m}); err != nil {
+				tmp.Close()
+				return err
+			}
+			kept = append(kept, m)
+		}
+		if len(kept) == 0 {
+			delete(s.queues, uid)
+			delete(s.bytes, uid)
+			continue
+		}
+		s.queues[uid] = kept
+		live += len(kept)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+	if err := os.Rename(tmpPath, s.logPath()); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.logPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.live = live
+	s.dead = 0
+	return nil
+}
+
+// append 追加一条记录，调用方需持有锁
+func (s *Store) append(r record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if s.opts.Sync {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+// logPath 日志文件路径
+func (s *Store) logPath() string {
+	return path.Join(s.opts.Dir, logFileName)
+}
@@ -0,0 +1,150 @@
+// Author: Vcentor
+// Date: 2026/10/19 10:48 上午
+// desc: 离线消息存储的补发顺序、容量限制和写入失败测试
+
+package offline
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStore_DeliverInOrderAfterReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a", "b", "c"} {
+		if err := s.Put("u1", []byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = s.Put("u2", []byte("x"))
+	_ = s.Close()
+
+	s, err = Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var got []string
+	n, err := s.Deliver("u1", func(payload []byte) error {
+		got = append(got, string(payload))
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("Deliver() n = %d, err = %v", n, err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Deliver() got = %v, want %v", got, want)
+	}
+	if s.Pending("u1") != 0 || s.Pending("u2") != 1 {
+		t.Errorf("Pending() u1 = %d, u2 = %d", s.Pending("u1"), s.Pending("u2"))
+	}
+}
+
+func TestStore_Caps(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		puts    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "max-msg-num",
+			opts: Options{MaxMsgNum: 2},
+			puts: []string{"a", "b", "c"},
+			want: []string{"b", "c"},
+		},
+		{
+			name: "max-bytes",
+			opts: Options{MaxBytes: 4},
+			puts: []string{"aa", "bb", "cc"},
+			want: []string{"bb", "cc"},
+		},
+		{
+			name:    "too-large",
+			opts:    Options{MaxBytes: 1},
+			puts:    []string{"aa"},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			opts: Options{TTL: time.Nanosecond},
+			puts: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "offline")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			tt.opts.Dir = dir
+			s, err := Open(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			for _, p := range tt.puts {
+				if err := s.Put("u", []byte(p)); (err != nil) != tt.wantErr {
+					t.Fatalf("Put() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+			time.Sleep(time.Millisecond)
+			var got []string
+			_, _ = s.Deliver("u", func(payload []byte) error {
+				got = append(got, string(payload))
+				return nil
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Deliver() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStore_DeliverStopsOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_ = s.Put("u", []byte("a"))
+	_ = s.Put("u", []byte("b"))
+	n, err := s.Deliver("u", func(payload []byte) error {
+		if string(payload) == "b" {
+			return errors.New("closed")
+		}
+		return nil
+	})
+	if err == nil || n != 1 {
+		t.Fatalf("Deliver() n = %d, err = %v", n, err)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Pending("u") != 1 {
+		t.Errorf("Pending() = %d, want 1", s.Pending("u"))
+	}
+}
@@ -0,0 +1,87 @@
+// Author: Vcentor
+// Date: 2026/10/20 10:05 上午
+// desc: 令牌桶限流
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket 令牌桶，协程安全
+type Bucket struct {
+	mutex  sync.Mutex
+	rate   float64 // 每秒生成的令牌数
+	burst  float64 // 桶容量
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket 实例化令牌桶，初始为满桶，burst<=0时等于rate
+func NewBucket(rate float64, burst int) *Bucket {
+	b := bucketSize(rate, burst)
+	return &Bucket{
+		rate:   rate,
+		burst:  b,
+		tokens: b,
+		last:   time.Now(),
+	}
+}
+
+// bucketSize 桶容量，burst<=0时等于rate，至少为1
+func bucketSize(rate float64, burst int) float64 {
+	b := float64(burst)
+	if b <= 0 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return b
+}
+
+// SetLimit 修改速率和桶容量，已有令牌超出新容量时截断
+func (b *Bucket) SetLimit(rate float64, burst int) {
+	size := bucketSize(rate, burst)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.rate == rate && b.burst == size {
+		return
+	}
+	b.rate = rate
+	b.burst = size
+	if b.tokens > size {
+		b.tokens = size
+	}
+}
+
+// Allow 消耗一个令牌，没有令牌时返回false
+func (b *Bucket) Allow() bool {
+	return b.AllowN(time.Now(), 1)
+}
+
+// AllowN 在now时刻消耗n个令牌
+func (b *Bucket) AllowN(now time.Time, n int) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// idle 令牌是否已经回满，回满的桶可以直接回收
+func (b *Bucket) idle(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
@@ -0,0 +1,67 @@
+// Author: Vcentor
+// Date: 2026/10/20 10:40 上午
+// desc: 令牌桶和按key限流测试
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket_AllowN(t *testing.T) {
+	now := time.Now()
+	b := NewBucket(10, 2)
+	b.last = now
+
+	tests := []struct {
+		name string
+		at   time.Duration
+		want bool
+	}{
+		{name: "burst-1", at: 0, want: true},
+		{name: "burst-2", at: 0, want: true},
+		{name: "empty", at: 0, want: false},
+		{name: "refill-too-early", at: 50 * time.Millisecond, want: false},
+		{name: "refilled", at: 100 * time.Millisecond, want: true},
+		{name: "capped-at-burst-1", at: 10 * time.Second, want: true},
+		{name: "capped-at-burst-2", at: 10 * time.Second, want: true},
+		{name: "capped-at-burst-3", at: 10 * time.Second, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.AllowN(now.Add(tt.at), 1); got != tt.want {
+				t.Errorf("AllowN() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBucket_SetLimit(t *testing.T) {
+	now := time.Now()
+	b := NewBucket(10, 5)
+	b.last = now
+
+	b.SetLimit(1, 2)
+	for i, want := range []bool{true, true, false} {
+		if got := b.AllowN(now, 1); got != want {
+			t.Errorf("AllowN() #%d = %v, want %v", i, got, want)
+		}
+	}
+	if got := b.AllowN(now.Add(500*time.Millisecond), 1); got {
+		t.Errorf("AllowN() refilled with old rate")
+	}
+	if got := b.AllowN(now.Add(time.Second), 1); !got {
+		t.Errorf("AllowN() not refilled with new rate")
+	}
+}
+
+func TestKeyed_Allow(t *testing.T) {
+	k := NewKeyed(1, 1)
+	if !k.Allow("a") || k.Allow("a") {
+		t.Errorf("Allow() should pass once for key a")
+	}
+	if !k.Allow("b") {
+		t.Errorf("Allow() keys should not share buckets")
+	}
+}
@@ -0,0 +1,62 @@
+// Author: Vcentor
+// Date: 2026/10/20 10:20 上午
+// desc: 按key区分的令牌桶集合
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// 桶数量超过该值时回收已回满的桶
+const keyedGCThreshold = 1024
+
+// Keyed 按key限流，如按principal、按ip
+type Keyed struct {
+	mutex   sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*Bucket
+}
+
+// NewKeyed 实例化按key限流
+func NewKeyed(rate float64, burst int) *Keyed {
+	return &Keyed{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*Bucket),
+	}
+}
+
+// Allow key消耗一个令牌
+func (k *Keyed) Allow(key string) bool {
+	now := time.Now()
+	k.mutex.Lock()
+	b, ok := k.buckets[key]
+	if !ok {
+		if len(k.buckets) >= keyedGCThreshold {
+			k.gc(now)
+		}
+		b = NewBucket(k.rate, k.burst)
+		k.buckets[key] = b
+	}
+	k.mutex.Unlock()
+	return b.AllowN(now, 1)
+}
+
+// Len 桶数量
+func (k *Keyed) Len() int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return len(k.buckets)
+}
+
+// gc 回收已回满的桶，回满的桶与新建的桶等价，调用方需持有锁
+func (k *Keyed) gc(now time.Time) {
+	for key, b := range k.buckets {
+		if b.idle(now) {
+			delete(k.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Author: Vcentor
+// Date: 2026/10/26 10:40 上午
+// desc: span输出，可替换为其他实现，内置每行一个json对象的stdout和文件输出，用于线下排查
+
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"socketserver/env"
+	"sync"
+)
+
+// 内置的Exporter
+const (
+	EXPORTER_STDOUT = "stdout"
+	EXPORTER_FILE   = "file"
+)
+
+// Exporter span输出，Export在span结束的goroutine中调用，不能阻塞太久
+// 实现了io.Closer时，替换或关闭时调用Close
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// ExporterFunc 函数形式的Exporter
+type ExporterFunc func(span SpanData)
+
+// Export 调用函数
+func (f ExporterFunc) Export(span SpanData) {
+	f(span)
+}
+
+// Config 追踪配置选项
+type Config struct {
+	Enable   bool   `toml:"enable"`
+	Exporter string `toml:"exporter" default:"file" validate:"oneof=stdout file"`
+	Path     string `toml:"path" default:"trace/trace.log"` // 相对日志目录，也可以是绝对路径
+}
+
+// file 输出文件绝对路径
+func (conf Config) file() (string, error) {
+	if filepath.IsAbs(conf.Path) {
+		return conf.Path, nil
+	}
+	dir, err := env.LogPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, conf.Path), nil
+}
+
+var (
+	exporterMutex sync.RWMutex
+	exporter      Exporter
+)
+
+// Init 按配置设置全局Exporter，未开启时不输出span
+func Init(conf Config) error {
+	if !conf.Enable {
+		SetExporter(nil)
+		return nil
+	}
+	switch conf.Exporter {
+	case EXPORTER_STDOUT:
+		SetExporter(NewWriterExporter(os.Stdout))
+	case EXPORTER_FILE:
+		file, err := conf.file()
+		if err != nil {
+			return err
+		}
+		e, err := NewFileExporter(file)
+		if err != nil {
+			return err
+		}
+		SetExporter(e)
+	}
+	return nil
+}
+
+// SetExporter 替换全局Exporter，nil为不输出，原Exporter实现了io.Closer时关闭
+func SetExporter(e Exporter) {
+	exporterMutex.Lock()
+	old := exporter
+	exporter = e
+	exporterMutex.Unlock()
+	if c, ok := old.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// Enabled 是否设置了Exporter
+func Enabled() bool {
+	exporterMutex.RLock()
+	defer exporterMutex.RUnlock()
+	return exporter != nil
+}
+
+// export 输出结束的span
+func export(span SpanData) {
+	exporterMutex.RLock()
+	defer exporterMutex.RUnlock()
+	if exporter != nil {
+		exporter.Export(span)
+	}
+}
+
+// WriterExporter 每个span输出一行json
+type WriterExporter struct {
+	mutex sync.Mutex
+	w     io.Writer
+	enc   *json.Encoder
+}
+
+// NewWriterExporter 输出到w，如os.Stdout
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w, enc: json.NewEncoder(w)}
+}
+
+// NewFileExporter 追加写入文件，目录不存在时创建
+func NewFileExporter(file string) (*WriterExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterExporter(f), nil
+}
+
+// Export 输出一行json，写入失败时丢弃，不影响请求处理
+func (e *WriterExporter) Export(span SpanData) {
+	e.mutex.Lock()
+	_ = e.enc.Encode(span)
+	e.mutex.Unlock()
+}
+
+// Close 关闭文件，stdout不关闭
+func (e *WriterExporter) Close() error {
+	if f, ok := e.w.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+		return f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// Author: Vcentor
+// Date: 2026/10/26 10:00 上午
+// desc: 链路追踪，span和W3C traceparent格式的上下文传递，结束的span交给Exporter输出
+// 未设置Exporter时span只用于传递上下文，不输出
+
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TRACEPARENT_HEADER 向下游传递上下文的http请求头
+const TRACEPARENT_HEADER = "traceparent"
+
+// 追踪ID和span ID长度，单位字节
+const (
+	traceIDSize = 16
+	spanIDSize  = 8
+)
+
+// ErrInvalidTraceparent traceparent格式错误
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// SpanContext 跨进程传递的追踪上下文
+type SpanContext struct {
+	TraceID string // 32位十六进制
+	SpanID  string // 16位十六进制
+	Sampled bool
+}
+
+// IsValid 追踪ID和span ID都不为空
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+// Traceparent 格式化为W3C traceparent，如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (sc SpanContext) Traceparent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-" + flags
+}
+
+// ParseTraceparent 解析W3C traceparent
+func ParseTraceparent(s string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	// 版本00固定4段，更高版本允许追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHex(traceID, traceIDSize) || !isHex(spanID, spanIDSize) || !isHex(flags, 1) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	if traceID == strings.Repeat("0", traceIDSize*2) || spanID == strings.Repeat("0", spanIDSize*2) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	b, _ := hex.DecodeString(flags)
+	return SpanContext{TraceID: traceID, SpanID: spanID, Sampled: b[0]&1 == 1}, nil
+}
+
+// isHex 长度为n字节的小写十六进制
+func isHex(s string, n int) bool {
+	if len(s) != n*2 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Span 一次调用的耗时和属性
+type Span struct {
+	mutex    sync.Mutex
+	name     string
+	ctx      SpanContext
+	parentID string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      string
+	ended    bool
+}
+
+// SpanContext span的上下文，用于向下游传递
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+// SetName 修改span名称，如路由完成后改为action
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	s.name = name
+	s.mutex.Unlock()
+}
+
+// SetAttr 设置属性，同名属性覆盖
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+	s.mutex.Unlock()
+}
+
+// SetError 记录错误，err为nil时不修改
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	s.err = err.Error()
+	s.mutex.Unlock()
+}
+
+// End 结束span并交给Exporter，重复调用只输出一次
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	data := s.data()
+	s.mutex.Unlock()
+	if data.Sampled {
+		export(data)
+	}
+}
+
+// data 导出的span数据，调用方持有锁
+func (s *Span) data() SpanData {
+	var attrs = make(map[string]interface{}, len(s.attrs))
+	for k, v := range s.attrs {
+		attrs[k] = v
+	}
+	return SpanData{
+		Name:       s.name,
+		TraceID:    s.ctx.TraceID,
+		SpanID:     s.ctx.SpanID,
+		ParentID:   s.parentID,
+		Sampled:    s.ctx.Sampled,
+		Start:      s.start,
+		End:        s.end,
+		Duration:   s.end.Sub(s.start).Microseconds(),
+		Attributes: attrs,
+		Error:      s.err,
+	}
+}
+
+// SpanData 结束的span
+type SpanData struct {
+	Name       string                 `json:"name"`
+	TraceID    string                 `json:"traceId"`
+	SpanID     string                 `json:"spanId"`
+	ParentID   string                 `json:"parentId,omitempty"`
+	Sampled    bool                   `json:"-"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Duration   int64                  `json:"durationUs"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// Start 创建子span，父span取自ctx，没有时使用WithRemote设置的上游上下文，都没有时开始新的追踪
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	span := &Span{name: name, start: time.Now()}
+	if parent := FromContext(ctx); parent.IsValid() {
+		span.parentID = parent.SpanID
+		span.ctx = SpanContext{TraceID: parent.TraceID, SpanID: newID(spanIDSize), Sampled: parent.Sampled}
+	} else {
+		span.ctx = SpanContext{TraceID: newID(traceIDSize), SpanID: newID(spanIDSize), Sampled: true}
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanFromContext ctx里的span，没有时返回nil，nil span的方法都可以安全调用
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// FromContext ctx里的追踪上下文，优先取当前span
+func FromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	if span := SpanFromContext(ctx); span != nil {
+		return span.ctx
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// WithRemote 设置上游传入的追踪上下文，之后Start创建的span作为它的子span
+func WithRemote(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Inject 把ctx里的追踪上下文写入请求头，没有时不修改
+func Inject(ctx context.Context, header http.Header) {
+	if tp := FromContext(ctx).Traceparent(); tp != "" {
+		header.Set(TRACEPARENT_HEADER, tp)
+	}
+}
+
+// Extract 从请求头读取上游的追踪上下文
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, err := ParseTraceparent(header.Get(TRACEPARENT_HEADER))
+	if err != nil {
+		return ctx
+	}
+	return WithRemote(ctx, sc)
+}
+
+var (
+	randMutex  sync.Mutex
+	randSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// newID 随机生成n字节的十六进制ID
+func newID(n int) string {
+	b := make([]byte, n)
+	randMutex.Lock()
+	randSource.Read(b)
+	randMutex.Unlock()
+	// 全0的ID非法
+	b[0] |= 1
+	return hex.EncodeToString(b)
+}
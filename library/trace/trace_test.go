@@ -0,0 +1,93 @@
+// Author: Vcentor
+// Date: 2026/10/26 11:20 上午
+// desc: traceparent解析和span测试
+
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    SpanContext
+		wantErr bool
+	}{
+		{
+			name: "sampled",
+			s:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			want: SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true},
+		},
+		{
+			name: "not sampled",
+			s:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			want: SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"},
+		},
+		{
+			name: "future version",
+			s:    "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			want: SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true},
+		},
+		{name: "empty", s: "", wantErr: true},
+		{name: "extra field", s: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantErr: true},
+		{name: "upper case", s: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "zero trace id", s: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "short span id", s: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTraceparent(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTraceparent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTraceparent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	var buf bytes.Buffer
+	SetExporter(NewWriterExporter(&buf))
+	defer SetExporter(nil)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := Start(WithRemote(context.Background(), remote), "parent")
+	_, child := Start(ctx, "child")
+	child.SetAttr("code", 0)
+	child.End()
+	child.End()
+	parent.End()
+
+	header := make(http.Header)
+	Inject(ctx, header)
+	if got := Extract(context.Background(), header); FromContext(got) != parent.SpanContext() {
+		t.Errorf("Extract() = %+v, want %+v", FromContext(got), parent.SpanContext())
+	}
+
+	dec := json.NewDecoder(&buf)
+	var spans []SpanData
+	for dec.More() {
+		var span SpanData
+		if err := dec.Decode(&span); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	if spans[0].Name != "child" || spans[0].ParentID != parent.SpanContext().SpanID || spans[0].Attributes["code"] != float64(0) {
+		t.Errorf("child span = %+v", spans[0])
+	}
+	if spans[1].TraceID != remote.TraceID || spans[1].ParentID != remote.SpanID {
+		t.Errorf("parent span = %+v", spans[1])
+	}
+}
@@ -4,10 +4,12 @@ package request
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"socketserver/library/trace"
 	"strings"
 	"time"
 )
@@ -47,13 +49,22 @@ func NewHTTPRequester(method, url, contentType, filename string, reqParams []byt
 
 // Request 发送请求
 func (h *HTTPRequester) Request(httpResp *HTTPResp) error {
-	var (
-		req = &http.Request{}
-		err error
-	)
+	return h.RequestContext(context.Background(), httpResp)
+}
+
+// RequestContext 发送请求，ctx携带追踪上下文时记录span并通过traceparent请求头传给下游
+// 在handler中调用时传入Session.Context()
+func (h *HTTPRequester) RequestContext(ctx context.Context, httpResp *HTTPResp) (err error) {
+	var req = &http.Request{}
 	h.Method = strings.ToUpper(h.Method)
+	ctx, span := trace.Start(ctx, "HTTP "+h.Method)
+	span.SetAttr("http.url", h.Url)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
 	if h.Method == "GET" || h.Method == "" {
-		if req, err = http.NewRequest(h.Method, h.Url, nil); err != nil {
+		if req, err = http.NewRequestWithContext(ctx, h.Method, h.Url, nil); err != nil {
 			return err
 		}
 		m, err := url.ParseQuery(string(h.ReqParams))
@@ -70,13 +81,13 @@ func (h *HTTPRequester) Request(httpResp *HTTPResp) error {
 	}
 	// key-value
 	if h.Method == "POST" && h.ContentType == FORMConverter {
-		if req, err = http.NewRequest(h.Method, h.Url, bytes.NewBuffer(h.ReqParams)); err != nil {
+		if req, err = http.NewRequestWithContext(ctx, h.Method, h.Url, bytes.NewBuffer(h.ReqParams)); err != nil {
 			return err
 		}
 	}
 	// key-value 下载文件
 	if h.Method == "POST" && h.ContentType == FILEConverter {
-		if req, err = http.NewRequest(h.Method, h.Url, bytes.NewBuffer(h.ReqParams)); err != nil {
+		if req, err = http.NewRequestWithContext(ctx, h.Method, h.Url, bytes.NewBuffer(h.ReqParams)); err != nil {
 			return err
 		}
 		req.Header.Set("Accept-Ranges", "bytes")
@@ -84,7 +95,7 @@ func (h *HTTPRequester) Request(httpResp *HTTPResp) error {
 	}
 	// pb or json or multipart/form-data
 	if h.Method == "POST" && h.ContentType != FORMConverter && h.ContentType != FILEConverter {
-		if req, err = http.NewRequest(h.Method, h.Url, bytes.NewBuffer(h.ReqParams)); err != nil {
+		if req, err = http.NewRequestWithContext(ctx, h.Method, h.Url, bytes.NewBuffer(h.ReqParams)); err != nil {
 			return err
 		}
 	}
@@ -94,6 +105,7 @@ func (h *HTTPRequester) Request(httpResp *HTTPResp) error {
 	if h.ContentType != "" {
 		req.Header.Set("Content-Type", h.ContentType)
 	}
+	trace.Inject(ctx, req.Header)
 	// 设置超时
 	client := &http.Client{
 		Timeout: time.Duration(60) * time.Second,
@@ -109,6 +121,7 @@ func (h *HTTPRequester) Request(httpResp *HTTPResp) error {
 	}
 	defer resp.Body.Close()
 	statusCode := resp.StatusCode
+	span.SetAttr("http.status_code", statusCode)
 	if statusCode != 200 {
 		return fmt.Errorf("Request [%s] failed!statusCode=%d", h.Url, statusCode)
 	}
@@ -0,0 +1,34 @@
+// Author: Vcentor
+// Date: 2026/10/19 5:52 下午
+// desc:
+
+package utils
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// WatchFile 轮询文件修改时间，文件变化时调用fn，ctx结束时退出
+func WatchFile(ctx context.Context, filename string, interval time.Duration, fn func()) {
+	var modTime time.Time
+	if fi, err := os.Stat(filename); err == nil {
+		modTime = fi.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fi, err := os.Stat(filename)
+			if err != nil || fi.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = fi.ModTime()
+			fn()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
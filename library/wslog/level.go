@@ -0,0 +1,96 @@
+// Author: Vcentor
+// Date: 2026/10/21 5:20 下午
+// desc: 日志等级过滤，等级可以在运行时修改
+
+package wslog
+
+import (
+	"context"
+	"sync/atomic"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// levelLogger 低于最小等级的日志直接丢弃
+type levelLogger struct {
+	logit.Logger
+	level uint32
+}
+
+var _ logit.Logger = (*levelLogger)(nil)
+
+// NewLevelLogger 包装logger，支持运行时修改最小日志等级，默认输出所有等级
+func NewLevelLogger(logger logit.Logger) logit.Logger {
+	if _, ok := logger.(*levelLogger); ok {
+		return logger
+	}
+	return &levelLogger{Logger: logger, level: uint32(logit.DebugLevel)}
+}
+
+// SetLevel 修改Logger的最小日志等级，等级非法时不修改
+func SetLevel(name string) error {
+	return SetLoggerLevel(Logger, name)
+}
+
+// SetLoggerLevel 修改NewLevelLogger创建的logger的最小日志等级，其他logger只校验等级
+func SetLoggerLevel(logger logit.Logger, name string) error {
+	level, err := logit.ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	if l, ok := logger.(*levelLogger); ok {
+		atomic.StoreUint32(&l.level, uint32(level))
+	}
+	return nil
+}
+
+// Level 当前最小日志等级
+func Level() string {
+	if l, ok := Logger.(*levelLogger); ok {
+		return logit.Level(atomic.LoadUint32(&l.level)).String()
+	}
+	return logit.DebugLevel.String()
+}
+
+// enabled 是否输出该等级的日志
+func (l *levelLogger) enabled(level logit.Level) bool {
+	return uint32(level) >= atomic.LoadUint32(&l.level)
+}
+
+// Debug debug
+func (l *levelLogger) Debug(ctx context.Context, message string, fields ...logit.Field) {
+	l.Output(ctx, logit.DebugLevel, 1, message, fields...)
+}
+
+// Trace trace
+func (l *levelLogger) Trace(ctx context.Context, message string, fields ...logit.Field) {
+	l.Output(ctx, logit.TraceLevel, 1, message, fields...)
+}
+
+// Notice notice
+func (l *levelLogger) Notice(ctx context.Context, message string, fields ...logit.Field) {
+	l.Output(ctx, logit.NoticeLevel, 1, message, fields...)
+}
+
+// Warning warning
+func (l *levelLogger) Warning(ctx context.Context, message string, fields ...logit.Field) {
+	l.Output(ctx, logit.WarningLevel, 1, message, fields...)
+}
+
+// Error error
+func (l *levelLogger) Error(ctx context.Context, message string, fields ...logit.Field) {
+	l.Output(ctx, logit.ErrorLevel, 1, message, fields...)
+}
+
+// Fatal fatal
+func (l *levelLogger) Fatal(ctx context.Context, message string, fields ...logit.Field) {
+	l.Output(ctx, logit.FatalLevel, 1, message, fields...)
+}
+
+// Output 输出日志
+func (l *levelLogger) Output(ctx context.Context, level logit.Level, callDepth int, message string, fields ...logit.Field) {
+	if !l.enabled(level) {
+		return
+	}
+	l.Logger.Output(ctx, level, callDepth+1, message, fields...)
+}
@@ -4,37 +4,82 @@
 package wslog
 
 import (
-	"bytes"
 	"context"
+	"path/filepath"
 	"socketserver/env"
-	"socketserver/library/utils"
-	"time"
 
 	"icode.baidu.com/baidu/gdp/logit"
 )
 
+// 日志格式
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
 var Logger logit.Logger
 
-func Init(ctx context.Context) {
-	var err error
+// Config 日志配置选项，warning及以上等级写入path.wf
+type Config struct {
+	Level    string `toml:"level" default:"debug" validate:"oneof=debug trace notice warning error fatal"` // 最小日志等级
+	Path     string `toml:"path" default:"service/service.log"`                                            // 相对日志目录，也可以是绝对路径
+	Rotate   string `toml:"rotate" default:"1hour" validate:"oneof=1min 5min 10min 15min 30min 1hour 1day no"`
+	MaxFiles int    `toml:"max_files" default:"48" validate:"min=-1"` // 保留的日志文件数，-1为不清理
+	Format   string `toml:"format" default:"text" validate:"oneof=text json"`
+}
+
+// file 日志文件绝对路径
+func (conf Config) file() (string, error) {
+	if filepath.IsAbs(conf.Path) {
+		return conf.Path, nil
+	}
+	dir, err := env.LogPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, conf.Path), nil
+}
+
+// New 按配置创建文件日志，支持运行时修改最小日志等级
+func New(ctx context.Context, conf Config) (logit.Logger, error) {
+	file, err := conf.file()
+	if err != nil {
+		return nil, err
+	}
 	c := &logit.Config{
-		FileName:   env.LogPath() + "/service/service.log",
-		RotateRule: "1hour", // 每1小时产生一个新的文件
-		MaxFileNum: 48,      // 保留最新的48个日志文件
-		// PrefixFunc:    logit.DefaultPrefixFunc, // 日志每行的前缀部分
-		PrefixFunc: func(ctx context.Context, level logit.Level, callDepth int) []byte {
-			var buf bytes.Buffer
-			buf.WriteString(level.String() + " ")
-			buf.WriteString(utils.TimeStamp2Datetime(time.Now()))
-			buf.Write([]byte(" "))
-			return buf.Bytes()
-		},
+		FileName:      file,
+		RotateRule:    conf.Rotate,
+		MaxFileNum:    conf.MaxFiles,
 		BufferSize:    1024, // 若为0会使用默认值 4096，-1 是禁用(值0)
 		WriterTimeout: 0,
 	}
+	if conf.Format == FORMAT_JSON {
+		// 等级、时间和调用位置写入json字段
+		c.Prefix = "no"
+		c.BeforeOutput = "to_body"
+		c.EncoderPool = "default_json"
+	} else {
+		// 日志每行的前缀部分，包含等级、时间和调用位置
+		c.PrefixFunc = logit.DefaultPrefixFunc
+	}
+
+	logger, err := logit.NewLogger(ctx, logit.OptConfig(c))
+	if err != nil {
+		return nil, err
+	}
+	l := NewLevelLogger(logger)
+	if err := SetLoggerLevel(l, conf.Level); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
 
-	Logger, err = logit.NewLogger(ctx, logit.OptConfig(c))
+// Init 按配置初始化全局Logger
+func Init(ctx context.Context, conf Config) error {
+	logger, err := New(ctx, conf)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	Logger = logger
+	return nil
 }
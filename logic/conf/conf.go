@@ -0,0 +1,130 @@
+// Author: Vcentor
+// Date: 2026/10/22 5:30 下午
+// desc: 业务配置，语音识别、语音合成和对话服务，支持环境变量覆盖和热加载
+
+package conf
+
+import (
+	"path"
+	"socketserver/env"
+	"socketserver/library/config"
+	"sync/atomic"
+)
+
+// 业务配置文件
+const (
+	ASR_CONF_FILE  = "bd_asr.toml"
+	TTS_CONF_FILE  = "tts.toml"
+	UNIT_CONF_FILE = "unit.toml"
+)
+
+// ASRConf 语音识别配置，环境变量前缀SOCKETSERVER_ASR
+type ASRConf struct {
+	URL    string `toml:"url" default:"wss://vop.baidu.com/realtime_asr"` // 实时识别websocket地址
+	AppID  int    `toml:"app_id" validate:"min=0"`
+	AppKey string `toml:"app_key"`
+	DevPid int    `toml:"dev_pid" default:"1537" validate:"oneof=1537 15372 1737 17372"` // 识别模型
+	Cuid   string `toml:"cuid"`                                                          // 设备唯一id，用于统计UV
+	Format string `toml:"format" default:"pcm" validate:"oneof=pcm"`
+	Sample int    `toml:"sample" default:"16000" validate:"oneof=16000"`
+}
+
+// TTSConf 语音合成配置，环境变量前缀SOCKETSERVER_TTS
+type TTSConf struct {
+	BdTTS BdTTSConfOption `toml:"bd_tts_conf"`
+}
+
+// BdTTSConfOption 百度语音合成参数
+type BdTTSConfOption struct {
+	URL  string `toml:"url"`
+	Lan  string `toml:"lan" default:"zh" validate:"oneof=zh"`
+	Ctp  int    `toml:"ctp" default:"1" validate:"oneof=1 10"` // 客户端类型，web端为1
+	Key  string `toml:"key"`
+	Cuid string `toml:"cuid"`
+	Pit  int    `toml:"pit" default:"5" validate:"min=0,max=15"` // 音调
+	Spd  int    `toml:"spd" default:"5" validate:"min=0,max=15"` // 语速
+	Vol  int    `toml:"vol" default:"5" validate:"min=0,max=15"` // 音量
+	Pdt  int    `toml:"pdt" validate:"min=0"`                    // 产品ID
+	Aue  int    `toml:"aue" default:"3" validate:"oneof=2 3 4 5 6"`
+	Per  int    `toml:"per" validate:"min=0"` // 发音人
+}
+
+// UnitConf 对话服务配置，环境变量前缀SOCKETSERVER_UNIT
+type UnitConf struct {
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	BotID        string `toml:"bot_id"`
+	UnitURL      string `toml:"unit_url" default:"https://aip.baidubce.com/rpc/2.0/unit/bot/chat"`
+}
+
+// confs 当前生效的业务配置
+type confs struct {
+	asr  *ASRConf
+	tts  *TTSConf
+	unit *UnitConf
+}
+
+var current atomic.Value // *confs
+
+// Init 加载业务配置
+func Init() error {
+	return Load()
+}
+
+// Load 加载并校验所有业务配置，全部通过后才替换当前配置，可用于热加载
+func Load() error {
+	c, err := load()
+	if err != nil {
+		return err
+	}
+	current.Store(c)
+	return nil
+}
+
+// Check 校验所有业务配置，不修改当前配置
+func Check() error {
+	_, err := load()
+	return err
+}
+
+// load 读取所有业务配置，返回所有文件的错误
+func load() (*confs, error) {
+	dir, err := env.ConfPath()
+	if err != nil {
+		return nil, err
+	}
+	c := &confs{asr: new(ASRConf), tts: new(TTSConf), unit: new(UnitConf)}
+	var errs config.Errors
+	for _, f := range []struct {
+		file   string
+		prefix string
+		v      interface{}
+	}{
+		{ASR_CONF_FILE, config.ENV_PREFIX + "_ASR", c.asr},
+		{TTS_CONF_FILE, config.ENV_PREFIX + "_TTS", c.tts},
+		{UNIT_CONF_FILE, config.ENV_PREFIX + "_UNIT", c.unit},
+	} {
+		if err := config.Load(path.Join(dir, f.file), f.prefix, f.v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
+
+// ASR 语音识别配置
+func ASR() *ASRConf {
+	return current.Load().(*confs).asr
+}
+
+// TTS 语音合成配置
+func TTS() *TTSConf {
+	return current.Load().(*confs).tts
+}
+
+// Unit 对话服务配置
+func Unit() *UnitConf {
+	return current.Load().(*confs).unit
+}
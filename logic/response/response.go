@@ -4,8 +4,8 @@
 package response
 
 import (
-	"socketserver/gate"
 	"encoding/json"
+	"socketserver/gate"
 )
 
 // Resp 下行数据格式
@@ -28,7 +28,8 @@ func NewResp(requestId, action string, body interface{}, code int, message strin
 	}
 }
 
-func (j *JsonResp) JsonSend(a *gate.WSAgent) {
+// JsonSend 下发json数据，websocket和tcp会话通用
+func (j *JsonResp) JsonSend(s gate.Session) {
 	b, _ := json.Marshal(j)
-	a.Conn.WriteMsg(b)
+	s.WriteMsg(b)
 }
@@ -4,11 +4,26 @@
 package logic
 
 import (
+	"socketserver/gate"
 	"socketserver/logic/actions"
+	"socketserver/logic/conf"
 	"socketserver/processer"
 )
 
-// Init 初始化注册路由
-func Init(processer processer.ProcesserOpt) {
+// Init 加载业务配置并初始化注册路由，业务配置非法时返回错误
+func Init(g *gate.Gate, processer processer.ProcesserOpt) error {
+	if err := conf.Init(); err != nil {
+		return err
+	}
+	g.OnReload("business", conf.Load)
+	// 开启business_checks时检查上游地址，地址随业务配置热加载，未配置时跳过
+	if g.HealthConf.BusinessChecks {
+		g.AddChecker(
+			gate.URLChecker("asr", func() string { return conf.ASR().URL }),
+			gate.URLChecker("tts", func() string { return conf.TTS().BdTTS.URL }),
+			gate.URLChecker("unit", func() string { return conf.Unit().UnitURL }),
+		)
+	}
 	actions.Sample()
+	return nil
 }
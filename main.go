@@ -5,12 +5,115 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"os"
 	"socketserver/bootstrap"
+	"socketserver/env"
+	"strings"
 )
 
+const usage = `Usage: socketserver [command] [flags]
+
+Commands:
+  serve         启动服务，默认命令
+  check-config  校验配置文件后退出
+  version       打印版本信息
+  replay        回放抓包文件并比较响应: socketserver replay [flags] capture.jsonl
+  bench         压测: socketserver bench -action PING -conns 100 -rate 1000
+  client        交互式客户端: socketserver client -tcp 127.0.0.1:8990
+
+Flags:
+`
+
 func main() {
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var paths env.Paths
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.StringVar(&paths.Root, "root", "", "根目录，也可通过"+env.ENV_ROOT_DIR+"指定")
+	fs.StringVar(&paths.Conf, "conf-dir", "", "配置目录，默认root/conf，也可通过"+env.ENV_CONF_DIR+"指定")
+	fs.StringVar(&paths.Log, "log-dir", "", "日志目录，默认root/log，也可通过"+env.ENV_LOG_DIR+"指定")
+	fs.StringVar(&paths.Data, "data-dir", "", "数据目录，默认root/data，也可通过"+env.ENV_DATA_DIR+"指定")
+	fs.StringVar(&paths.ConfigFile, "config", "", "server.toml路径，默认conf-dir/server.toml，也可通过"+env.ENV_CONFIG_FILE+"指定")
+	checkConfig := fs.Bool("check-config", false, "校验配置文件后退出，同check-config命令")
+	var (
+		replayArgs replayFlags
+		benchArgs  benchFlags
+		clientArgs clientFlags
+	)
+	switch cmd {
+	case "replay":
+		replayArgs.register(fs)
+	case "bench":
+		benchArgs.register(fs)
+	case "client":
+		clientArgs.register(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	// replay命令需要一个抓包文件参数
+	var file string
+	if cmd == "replay" && fs.NArg() == 1 {
+		file = fs.Arg(0)
+	} else if cmd == "replay" {
+		fmt.Fprintln(os.Stderr, "replay requires a capture file")
+		fs.Usage()
+		os.Exit(2)
+	} else if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *checkConfig {
+		cmd = "check-config"
+	}
+
 	// 当服务重启或者关闭时，等待其它请求完成，默认等待1s
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	bootstrap.NewBootstrap(ctx).Init().Run()
+	switch cmd {
+	case "serve":
+		b, err := bootstrap.NewBootstrap(ctx, paths).Init()
+		if err == nil {
+			err = b.Run()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "check-config":
+		if err := bootstrap.NewBootstrap(ctx, paths).CheckConfig(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("config ok")
+	case "version":
+		fmt.Println(env.VersionInfo())
+	case "replay":
+		if err := replay(ctx, paths, replayArgs, file); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "bench":
+		if err := runBench(ctx, paths, benchArgs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "client":
+		if err := runClient(ctx, paths, clientArgs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+		fs.Usage()
+		os.Exit(2)
+	}
 }
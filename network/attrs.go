@@ -0,0 +1,201 @@
+// Author: Vcentor
+// Date: 2026/10/19 2:05 下午
+// desc: 会话级别的属性存储，连接断开时清理
+
+package network
+
+import (
+	"sync"
+	"time"
+)
+
+// attr 属性值
+type attr struct {
+	value  interface{}
+	expire time.Time // 零值为不过期
+}
+
+// expired 是否过期
+func (a attr) expired(now time.Time) bool {
+	return !a.expire.IsZero() && !now.Before(a.expire)
+}
+
+// Attrs 协程安全的会话属性存储
+type Attrs struct {
+	mutex     sync.RWMutex
+	values    map[string]attr
+	hooks     []func()
+	closeFlag bool
+}
+
+// NewAttrs 实例化属性存储
+func NewAttrs() *Attrs {
+	return &Attrs{
+		values: make(map[string]attr),
+	}
+}
+
+// Set 设置属性，不过期
+func (attrs *Attrs) Set(key string, value interface{}) {
+	attrs.SetTTL(key, value, 0)
+}
+
+// SetTTL 设置属性，ttl<=0为不过期
+func (attrs *Attrs) SetTTL(key string, value interface{}, ttl time.Duration) {
+	var a = attr{value: value}
+	now := time.Now()
+	if ttl > 0 {
+		a.expire = now.Add(ttl)
+	}
+	attrs.mutex.Lock()
+	defer attrs.mutex.Unlock()
+	if attrs.closeFlag {
+		return
+	}
+	// 顺带清理过期属性，释放内存
+	for k, v := range attrs.values {
+		if v.expired(now) {
+			delete(attrs.values, k)
+		}
+	}
+	attrs.values[key] = a
+}
+
+// Get 获取属性
+func (attrs *Attrs) Get(key string) (interface{}, bool) {
+	attrs.mutex.RLock()
+	a, ok := attrs.values[key]
+	attrs.mutex.RUnlock()
+	if !ok || a.expired(time.Now()) {
+		return nil, false
+	}
+	return a.value, true
+}
+
+// LoadOrStore 属性存在时返回已有值，否则设置为value，loaded表示是否已存在
+func (attrs *Attrs) LoadOrStore(key string, value interface{}) (actual interface{}, loaded bool) {
+	attrs.mutex.Lock()
+	defer attrs.mutex.Unlock()
+	if a, ok := attrs.values[key]; ok && !a.expired(time.Now()) {
+		return a.value, true
+	}
+	if !attrs.closeFlag {
+		attrs.values[key] = attr{value: value}
+	}
+	return value, false
+}
+
+// Del 删除属性
+func (attrs *Attrs) Del(key string) {
+	attrs.mutex.Lock()
+	delete(attrs.values, key)
+	attrs.mutex.Unlock()
+}
+
+// Keys 获取所有未过期属性的key
+func (attrs *Attrs) Keys() []string {
+	now := time.Now()
+	attrs.mutex.RLock()
+	defer attrs.mutex.RUnlock()
+	var keys = make([]string, 0, len(attrs.values))
+	for k, v := range attrs.values {
+		if !v.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// GetString 获取string属性，类型不匹配时ok为false
+func (attrs *Attrs) GetString(key string) (v string, ok bool) {
+	value, exist := attrs.Get(key)
+	if exist {
+		v, ok = value.(string)
+	}
+	return
+}
+
+// GetInt 获取int属性，类型不匹配时ok为false
+func (attrs *Attrs) GetInt(key string) (v int, ok bool) {
+	value, exist := attrs.Get(key)
+	if exist {
+		v, ok = value.(int)
+	}
+	return
+}
+
+// GetInt64 获取int64属性，类型不匹配时ok为false
+func (attrs *Attrs) GetInt64(key string) (v int64, ok bool) {
+	value, exist := attrs.Get(key)
+	if exist {
+		v, ok = value.(int64)
+	}
+	return
+}
+
+// GetFloat64 获取float64属性，类型不匹配时ok为false
+func (attrs *Attrs) GetFloat64(key string) (v float64, ok bool) {
+	value, exist := attrs.Get(key)
+	if exist {
+		v, ok = value.(float64)
+	}
+	return
+}
+
+// GetBool 获取bool属性，类型不匹配时ok为false
+func (attrs *Attrs) GetBool(key string) (v bool, ok bool) {
+	value, exist := attrs.Get(key)
+	if exist {
+		v, ok = value.(bool)
+	}
+	return
+}
+
+// GetBytes 获取[]byte属性，类型不匹配时ok为false
+func (attrs *Attrs) GetBytes(key string) (v []byte, ok bool) {
+	value, exist := attrs.Get(key)
+	if exist {
+		v, ok = value.([]byte)
+	}
+	return
+}
+
+// GetTime 获取time.Time属性，类型不匹配时ok为false
+func (attrs *Attrs) GetTime(key string) (v time.Time, ok bool) {
+	value, exist := attrs.Get(key)
+	if exist {
+		v, ok = value.(time.Time)
+	}
+	return
+}
+
+// OnClose 注册连接断开时的清理函数，按注册的逆序执行
+// 连接已经断开时立即执行
+func (attrs *Attrs) OnClose(fn func()) {
+	attrs.mutex.Lock()
+	if attrs.closeFlag {
+		attrs.mutex.Unlock()
+		fn()
+		return
+	}
+	attrs.hooks = append(attrs.hooks, fn)
+	attrs.mutex.Unlock()
+}
+
+// close 连接断开时执行清理函数并释放所有属性
+func (attrs *Attrs) close() {
+	attrs.mutex.Lock()
+	if attrs.closeFlag {
+		attrs.mutex.Unlock()
+		return
+	}
+	attrs.closeFlag = true
+	hooks := attrs.hooks
+	attrs.hooks = nil
+	attrs.values = make(map[string]attr)
+	attrs.mutex.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
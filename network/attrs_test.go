@@ -0,0 +1,65 @@
+// Author: Vcentor
+// Date: 2026/10/19 2:40 下午
+// desc: 会话属性的类型读取、过期和关闭回调测试
+
+package network
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAttrs_TypedGet(t *testing.T) {
+	attrs := NewAttrs()
+	attrs.Set("asr", "sn-1")
+	attrs.Set("turn", 3)
+
+	if v, ok := attrs.GetString("asr"); !ok || v != "sn-1" {
+		t.Errorf("GetString() = %v, %v", v, ok)
+	}
+	if v, ok := attrs.GetInt("turn"); !ok || v != 3 {
+		t.Errorf("GetInt() = %v, %v", v, ok)
+	}
+	if _, ok := attrs.GetString("turn"); ok {
+		t.Errorf("GetString() on int should not be ok")
+	}
+	if _, ok := attrs.GetBool("missing"); ok {
+		t.Errorf("GetBool() on missing key should not be ok")
+	}
+}
+
+func TestAttrs_TTL(t *testing.T) {
+	attrs := NewAttrs()
+	attrs.SetTTL("dialog", "ctx", time.Millisecond)
+	attrs.Set("profile", "p")
+	time.Sleep(2 * time.Millisecond)
+
+	if _, ok := attrs.Get("dialog"); ok {
+		t.Errorf("Get() expired key should not be ok")
+	}
+	if got := attrs.Keys(); !reflect.DeepEqual(got, []string{"profile"}) {
+		t.Errorf("Keys() = %v", got)
+	}
+}
+
+func TestAttrs_OnClose(t *testing.T) {
+	attrs := NewAttrs()
+	var order []int
+	attrs.OnClose(func() { order = append(order, 1) })
+	attrs.OnClose(func() { order = append(order, 2) })
+	attrs.Set("k", "v")
+	attrs.close()
+	attrs.close()
+
+	if !reflect.DeepEqual(order, []int{2, 1}) {
+		t.Errorf("hooks order = %v", order)
+	}
+	if _, ok := attrs.Get("k"); ok {
+		t.Errorf("Get() after close should not be ok")
+	}
+	attrs.OnClose(func() { order = append(order, 3) })
+	if len(order) != 3 {
+		t.Errorf("OnClose() after close should run immediately")
+	}
+}
@@ -0,0 +1,74 @@
+// Author: Vcentor
+// Date: 2026/10/27 5:00 下午
+// desc: 建连重试的指数退避，加入随机抖动避免大量客户端同时重连
+
+package network
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// 默认退避参数
+const (
+	DEFAULT_BACKOFF_MIN    = 50 * time.Millisecond
+	DEFAULT_BACKOFF_MAX    = 5 * time.Second
+	DEFAULT_BACKOFF_FACTOR = 2
+	DEFAULT_BACKOFF_JITTER = 0.2
+)
+
+// Backoff 指数退避，第n次重试等待Min*Factor^n，不超过Max
+type Backoff struct {
+	Min    time.Duration // 默认50ms
+	Max    time.Duration // 默认5s
+	Factor float64       // 默认2
+	Jitter float64       // 随机减少的比例，0~1，默认0.2，小于0时不抖动
+}
+
+// Duration 第attempt次(从0开始)重试前的等待时间
+func (b Backoff) Duration(attempt int) time.Duration {
+	min, max, factor, jitter := b.Min, b.Max, b.Factor, b.Jitter
+	if min <= 0 {
+		min = DEFAULT_BACKOFF_MIN
+	}
+	if max <= 0 {
+		max = DEFAULT_BACKOFF_MAX
+	}
+	if max < min {
+		max = min
+	}
+	if factor < 1 {
+		factor = DEFAULT_BACKOFF_FACTOR
+	}
+	if jitter == 0 {
+		jitter = DEFAULT_BACKOFF_JITTER
+	}
+
+	d := float64(min)
+	for i := 0; i < attempt && d < float64(max); i++ {
+		d *= factor
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	if jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		d -= d * jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// sleepContext 等待d，ctx取消时返回false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
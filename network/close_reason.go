@@ -0,0 +1,51 @@
+// Author: Vcentor
+// Date: 2026/10/24 10:20 上午
+// desc: 连接关闭原因，网关据此通知业务方连接断开的原因
+
+package network
+
+import (
+	"errors"
+	"sync"
+)
+
+// 连接关闭原因
+const (
+	CLOSE_CLIENT            = "client_close"      // 客户端主动断开
+	CLOSE_HEARTBEAT_TIMEOUT = "heartbeat_timeout" // 心跳超时
+	CLOSE_SLOW_CONSUMER     = "slow_consumer"     // 客户端消费过慢，写队列已满
+	CLOSE_SERVER_SHUTDOWN   = "server_shutdown"   // 服务退出
+	CLOSE_READ_ERROR        = "read_error"        // 读数据失败
+	CLOSE_WRITE_ERROR       = "write_error"       // 写数据失败
+	CLOSE_SERVER            = "server_close"      // 服务端主动关闭，未指定原因
+)
+
+var (
+	// ErrConnClosed 连接已关闭，消息未写入
+	ErrConnClosed = errors.New("connection is closed")
+	// ErrSlowConsumer 写channel已满，连接已按CLOSE_SLOW_CONSUMER断开
+	ErrSlowConsumer = errors.New("write channel is full, connection is closed")
+)
+
+// closeReason 连接关闭原因，只记录第一次，嵌入到TCPConn和WSConn中
+type closeReason struct {
+	reasonMutex sync.Mutex
+	reason      string
+	err         error
+}
+
+// setCloseReason 记录关闭原因，已有原因时不覆盖
+func (c *closeReason) setCloseReason(reason string, err error) {
+	c.reasonMutex.Lock()
+	defer c.reasonMutex.Unlock()
+	if c.reason == "" {
+		c.reason, c.err = reason, err
+	}
+}
+
+// CloseReason 关闭原因及导致关闭的错误，连接未关闭时原因为空
+func (c *closeReason) CloseReason() (string, error) {
+	c.reasonMutex.Lock()
+	defer c.reasonMutex.Unlock()
+	return c.reason, c.err
+}
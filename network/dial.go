@@ -0,0 +1,88 @@
+// Author: Vcentor
+// Date: 2026/10/28 4:00 下午
+// desc: 按传输协议建立websocket或tcp客户端连接，压测、回放和交互客户端共用
+// 基于WSClient和TCPClient，支持wss、tcp over TLS和握手鉴权，不自动重连
+
+package network
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// 客户端传输协议
+const (
+	TRANSPORT_WS  = "ws"
+	TRANSPORT_TCP = "tcp"
+)
+
+// DialOption 客户端连接选项，按Transport使用WS或TCP
+type DialOption struct {
+	Transport string          // ws或tcp
+	WS        WSDialOption    // websocket地址、握手请求头、Token和TLS配置
+	TCP       TCPClientOption // tcp地址、消息格式和TLS配置
+}
+
+// ClientConn websocket或tcp客户端连接
+type ClientConn interface {
+	// WriteMsg 发送一条消息，binary只对websocket有效
+	WriteMsg(data []byte, binary bool) error
+	// ReadMsg 读取一条消息，连接断开前已收到的消息读完后返回错误；tcp没有消息类型，binary总是false
+	ReadMsg() (data []byte, binary bool, err error)
+	// Close 关闭连接
+	Close()
+}
+
+// Dial 按传输协议建立客户端连接
+func Dial(ctx context.Context, opt DialOption) (ClientConn, error) {
+	switch opt.Transport {
+	case TRANSPORT_WS:
+		opt.WS.AutoReconnect = false
+		c, err := DialWS(ctx, opt.WS)
+		if err != nil {
+			return nil, err
+		}
+		return wsClientConn{c}, nil
+	case TRANSPORT_TCP:
+		c, err := NewTCPClientContext(ctx, opt.TCP)
+		if err != nil {
+			return nil, err
+		}
+		return tcpClientConn{c}, nil
+	}
+	return nil, fmt.Errorf("unsupported transport %q", opt.Transport)
+}
+
+// wsClientConn websocket客户端连接
+type wsClientConn struct {
+	*WSClient
+}
+
+func (c wsClientConn) WriteMsg(data []byte, binary bool) error {
+	typ := websocket.TextMessage
+	if binary {
+		typ = websocket.BinaryMessage
+	}
+	return c.WSClient.WriteMsg(WriteChan{Type: typ, Message: data})
+}
+
+func (c wsClientConn) ReadMsg() ([]byte, bool, error) {
+	data, typ, err := c.WSClient.ReadMsg()
+	return data, typ == websocket.BinaryMessage, err
+}
+
+// tcpClientConn tcp客户端连接
+type tcpClientConn struct {
+	*TCPClient
+}
+
+func (c tcpClientConn) WriteMsg(data []byte, _ bool) error {
+	return c.TCPClient.WriteMsg(data)
+}
+
+func (c tcpClientConn) ReadMsg() ([]byte, bool, error) {
+	data, err := c.TCPClient.ReadMsg()
+	return data, false, err
+}
@@ -0,0 +1,112 @@
+// Author: Vcentor
+// Date: 2026/10/28 4:30 下午
+// desc: Dial按地址协议建立wss和tls连接的测试
+
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDial(t *testing.T) {
+	serverTLS, clientTLS := selfSignedTLS(t)
+
+	// wss服务校验Token，返回三条消息后断开
+	var upgrader websocket.Upgrader
+	ws := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		typ, data, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		for i := 0; i < 3; i++ {
+			_ = c.WriteMessage(typ, data)
+		}
+	}))
+	ws.TLS = serverTLS
+	ws.StartTLS()
+	defer ws.Close()
+
+	// tcp over TLS服务返回三条消息后断开
+	parser := NewTCPParser()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				data, err := parser.Decode(c)
+				if err != nil {
+					return
+				}
+				b, _ := parser.Encode(data)
+				for i := 0; i < 3; i++ {
+					_, _ = c.Write(b)
+				}
+			}(c)
+		}
+	}()
+
+	wsOpt := WSDialOption{Addr: "wss" + strings.TrimPrefix(ws.URL, "https") + WS_PATH, Token: "secret", TLSConfig: clientTLS}
+	tests := []struct {
+		name    string
+		opt     DialOption
+		binary  bool
+		wantErr bool
+	}{
+		{name: "wss", opt: DialOption{Transport: TRANSPORT_WS, WS: wsOpt}, binary: true},
+		{name: "tcp tls", opt: DialOption{Transport: TRANSPORT_TCP,
+			TCP: TCPClientOption{Addr: ln.Addr().String(), Parser: parser, TLSConfig: clientTLS}}},
+		{name: "wss without token", opt: DialOption{Transport: TRANSPORT_WS,
+			WS: WSDialOption{Addr: wsOpt.Addr, TLSConfig: clientTLS}}, wantErr: true},
+		{name: "unknown transport", opt: DialOption{Transport: "udp"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Dial(context.Background(), tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Dial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			if err := c.WriteMsg([]byte("hello"), tt.binary); err != nil {
+				t.Fatal(err)
+			}
+			// 服务端断开前发出的消息都能读到
+			for i := 0; i < 3; i++ {
+				data, binary, err := c.ReadMsg()
+				if err != nil || string(data) != "hello" || binary != tt.binary {
+					t.Fatalf("ReadMsg() %d = %q, %v, %v", i, data, binary, err)
+				}
+			}
+			if _, _, err := c.ReadMsg(); err == nil {
+				t.Error("ReadMsg() after server close error = nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Author: Vcentor
+// Date: 2026/10/20 2:10 下午
+// desc: 接入控制，按来源ip限制连接数和建连频率，支持CIDR黑白名单
+
+package network
+
+import (
+	"errors"
+	"net"
+	"socketserver/library/ratelimit"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 拒绝连接的原因
+const (
+	REJECT_MAX_CONN      = "max_conn"      // 超过最大连接数
+	REJECT_DENY          = "deny"          // 命中黑名单
+	REJECT_NOT_ALLOWED   = "not_allowed"   // 不在白名单
+	REJECT_IP_CONN_LIMIT = "ip_conn_limit" // 超过单ip最大连接数
+	REJECT_ACCEPT_RATE   = "accept_rate"   // 单ip建连过于频繁
+	REJECT_INVALID_ADDR  = "invalid_addr"  // 无法解析来源地址
+)
+
+// IPFilterOption 接入控制配置
+type IPFilterOption struct {
+	MaxConnPerIP int      // 单ip最大连接数，<=0不限制
+	Allow        []string // 白名单，ip或CIDR，为空不限制
+	Deny         []string // 黑名单，ip或CIDR
+	AcceptRate   float64  // 单ip每秒建连数，<=0不限制
+	AcceptBurst  int      // 单ip允许的突发建连数
+}
+
+// IPFilter 接入控制，websocket和tcp服务可以共用
+type IPFilter struct {
+	mutex        sync.Mutex
+	allow        []*net.IPNet
+	deny         []*net.IPNet
+	maxConnPerIP int
+	conns        map[string]int
+	acceptRate   *ratelimit.Keyed
+	rate         float64 // acceptRate的参数，热加载时未变化则沿用各ip的令牌桶
+	burst        int
+	rejects      sync.Map // reason -> *int64
+}
+
+// NewIPFilter 实例化接入控制
+func NewIPFilter(opt IPFilterOption) (*IPFilter, error) {
+	f := &IPFilter{
+		conns: make(map[string]int),
+	}
+	if err := f.Update(opt); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Update 更新接入控制配置，配置非法时不修改，已建立的连接不受影响
+func (f *IPFilter) Update(opt IPFilterOption) error {
+	allow, err := ParseCIDRs(opt.Allow)
+	if err != nil {
+		return err
+	}
+	deny, err := ParseCIDRs(opt.Deny)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.allow = allow
+	f.deny = deny
+	f.maxConnPerIP = opt.MaxConnPerIP
+	if f.acceptRate != nil && opt.AcceptRate == f.rate && opt.AcceptBurst == f.burst {
+		return nil
+	}
+	f.acceptRate, f.rate, f.burst = nil, opt.AcceptRate, opt.AcceptBurst
+	if opt.AcceptRate > 0 {
+		f.acceptRate = ratelimit.NewKeyed(opt.AcceptRate, opt.AcceptBurst)
+	}
+	return nil
+}
+
+// ParseCIDRs 解析ip或CIDR列表，单个ip按/32或/128处理
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	var nets = make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.New("invalid ip: " + s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// containsIP ip是否在网段列表中
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddrIP 从net.Addr或host:port字符串中解析ip
+func AddrIP(addr interface{}) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case net.Addr:
+		return AddrIP(a.String())
+	case string:
+		host, _, err := net.SplitHostPort(a)
+		if err != nil {
+			host = a
+		}
+		return net.ParseIP(host)
+	}
+	return nil
+}
+
+// Acquire 检查来源ip是否允许接入，允许时返回的release需要在连接关闭时调用
+// 拒绝时reason为拒绝原因
+func (f *IPFilter) Acquire(ip net.IP) (release func(), reason string) {
+	if ip == nil {
+		return nil, f.Reject(REJECT_INVALID_ADDR)
+	}
+	f.mutex.Lock()
+	allow, deny, acceptRate := f.allow, f.deny, f.acceptRate
+	f.mutex.Unlock()
+	if containsIP(deny, ip) {
+		return nil, f.Reject(REJECT_DENY)
+	}
+	if len(allow) > 0 && !containsIP(allow, ip) {
+		return nil, f.Reject(REJECT_NOT_ALLOWED)
+	}
+	key := ip.String()
+	if acceptRate != nil && !acceptRate.Allow(key) {
+		return nil, f.Reject(REJECT_ACCEPT_RATE)
+	}
+
+	f.mutex.Lock()
+	if f.maxConnPerIP > 0 && f.conns[key] >= f.maxConnPerIP {
+		f.mutex.Unlock()
+		return nil, f.Reject(REJECT_IP_CONN_LIMIT)
+	}
+	f.conns[key]++
+	f.mutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.mutex.Lock()
+			if f.conns[key]--; f.conns[key] <= 0 {
+				delete(f.conns, key)
+			}
+			f.mutex.Unlock()
+		})
+	}, ""
+}
+
+// Reject 记录拒绝原因
+func (f *IPFilter) Reject(reason string) string {
+	v, _ := f.rejects.LoadOrStore(reason, new(int64))
+	atomic.AddInt64(v.(*int64), 1)
+	return reason
+}
+
+// Rejects 各原因累计拒绝次数
+func (f *IPFilter) Rejects() map[string]int64 {
+	var res = make(map[string]int64)
+	f.rejects.Range(func(k, v interface{}) bool {
+		res[k.(string)] = atomic.LoadInt64(v.(*int64))
+		return true
+	})
+	return res
+}
+
+// ConnNum 来源ip当前连接数
+func (f *IPFilter) ConnNum(ip net.IP) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.conns[ip.String()]
+}
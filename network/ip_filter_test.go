@@ -0,0 +1,102 @@
+// Author: Vcentor
+// Date: 2026/10/20 3:05 下午
+// desc: 接入控制和来源地址解析测试
+
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPFilter_Acquire(t *testing.T) {
+	f, err := NewIPFilter(IPFilterOption{
+		MaxConnPerIP: 1,
+		Allow:        []string{"10.0.0.0/8", "192.168.1.1"},
+		Deny:         []string{"10.0.0.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, reason := f.Acquire(net.ParseIP("10.0.0.1"))
+	if reason != "" {
+		t.Fatalf("Acquire() reason = %s", reason)
+	}
+
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{name: "ip-conn-limit", ip: "10.0.0.1", want: REJECT_IP_CONN_LIMIT},
+		{name: "deny", ip: "10.0.0.2", want: REJECT_DENY},
+		{name: "not-allowed", ip: "172.16.0.1", want: REJECT_NOT_ALLOWED},
+		{name: "allowed-single-ip", ip: "192.168.1.1", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := f.Acquire(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("Acquire() reason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	release()
+	release()
+	if n := f.ConnNum(net.ParseIP("10.0.0.1")); n != 0 {
+		t.Errorf("ConnNum() after release = %d", n)
+	}
+	if got := f.Rejects()[REJECT_DENY]; got != 1 {
+		t.Errorf("Rejects()[deny] = %d", got)
+	}
+}
+
+func TestIPFilter_UpdateAcceptRate(t *testing.T) {
+	opt := IPFilterOption{AcceptRate: 0.001, AcceptBurst: 1}
+	f, err := NewIPFilter(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := net.ParseIP("10.0.0.1")
+	release, _ := f.Acquire(ip)
+	release()
+	if _, reason := f.Acquire(ip); reason != REJECT_ACCEPT_RATE {
+		t.Fatalf("Acquire() reason = %q, want %q", reason, REJECT_ACCEPT_RATE)
+	}
+
+	// 建连频率未变化时沿用令牌桶，修改后重新计算
+	opt.Deny = []string{"10.0.0.2"}
+	if err := f.Update(opt); err != nil {
+		t.Fatal(err)
+	}
+	if _, reason := f.Acquire(ip); reason != REJECT_ACCEPT_RATE {
+		t.Errorf("Acquire() after update reason = %q, want %q", reason, REJECT_ACCEPT_RATE)
+	}
+	opt.AcceptBurst = 2
+	if err := f.Update(opt); err != nil {
+		t.Fatal(err)
+	}
+	if _, reason := f.Acquire(ip); reason != "" {
+		t.Errorf("Acquire() after rate change reason = %q", reason)
+	}
+}
+
+func TestAddrIP(t *testing.T) {
+	tests := []struct {
+		name string
+		addr interface{}
+		want string
+	}{
+		{name: "tcp-addr", addr: &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 80}, want: "1.2.3.4"},
+		{name: "host-port", addr: "[::1]:80", want: "::1"},
+		{name: "host", addr: "5.6.7.8", want: "5.6.7.8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AddrIP(tt.addr); got.String() != tt.want {
+				t.Errorf("AddrIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Author: Vcentor
+// Date: 2026/10/21 3:30 下午
+// desc: 监听地址管理，平滑重启时把listener的文件描述符传给新进程
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ENV_LISTEN_FDS 从父进程继承的listener，格式 addr=fd,addr=fd
+const ENV_LISTEN_FDS = "SOCKETSERVER_LISTEN_FDS"
+
+// listeners 本进程创建的tcp listener，按监听地址索引
+var listeners = struct {
+	sync.Mutex
+	m map[string]*net.TCPListener
+}{m: make(map[string]*net.TCPListener)}
+
+// Listen 监听tcp地址，父进程传入了该地址的文件描述符时直接复用
+func Listen(addr string) (net.Listener, error) {
+	ln, err := inheritedListener(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ln == nil {
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	tl, ok := ln.(*net.TCPListener)
+	if !ok {
+		_ = ln.Close()
+		return nil, errors.New("not a tcp listener: " + addr)
+	}
+	listeners.Lock()
+	listeners.m[addr] = tl
+	listeners.Unlock()
+	return &registeredListener{TCPListener: tl, addr: addr}, nil
+}
+
+// registeredListener 关闭时从listeners中移除，平滑重启时不再传递
+type registeredListener struct {
+	*net.TCPListener
+	addr string
+}
+
+// Close 关闭listener
+func (l *registeredListener) Close() error {
+	listeners.Lock()
+	if listeners.m[l.addr] == l.TCPListener {
+		delete(listeners.m, l.addr)
+	}
+	listeners.Unlock()
+	return l.TCPListener.Close()
+}
+
+// inheritedListener 查找父进程传入的listener，没有时返回nil
+func inheritedListener(addr string) (net.Listener, error) {
+	for _, item := range strings.Split(os.Getenv(ENV_LISTEN_FDS), ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] != addr {
+			continue
+		}
+		fd, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", ENV_LISTEN_FDS, item)
+		}
+		f := os.NewFile(uintptr(fd), addr)
+		defer f.Close()
+		return net.FileListener(f)
+	}
+	return nil, nil
+}
+
+// ListenerFiles 复制本进程所有listener的文件描述符，fds为传给子进程的环境变量值
+// 子进程的文件描述符从offset开始按顺序编号，files由调用方在子进程启动后关闭
+func ListenerFiles(offset int) (files []*os.File, fds string, err error) {
+	listeners.Lock()
+	defer listeners.Unlock()
+	var items = make([]string, 0, len(listeners.m))
+	for addr, ln := range listeners.m {
+		f, err := ln.File()
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, "", err
+		}
+		items = append(items, addr+"="+strconv.Itoa(offset+len(files)))
+		files = append(files, f)
+	}
+	return files, strings.Join(items, ","), nil
+}
@@ -0,0 +1,52 @@
+// Author: Vcentor
+// Date: 2026/10/21 4:40 下午
+// desc: 从环境变量继承listener的测试
+
+package network
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestListen_Inherit(t *testing.T) {
+	ln, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	files, fds, err := ListenerFiles(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	if len(files) != 1 || fds != "127.0.0.1:0=3" {
+		t.Fatalf("ListenerFiles() = %d files, fds %s", len(files), fds)
+	}
+
+	// 进程内模拟子进程，直接使用复制出的文件描述符
+	addr := ln.Addr().String()
+	os.Setenv(ENV_LISTEN_FDS, "127.0.0.1:1=100,"+addr+"="+strconv.Itoa(int(files[0].Fd())))
+	defer os.Unsetenv(ENV_LISTEN_FDS)
+
+	inherited, err := Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inherited.Close()
+	if got := inherited.Addr().String(); got != addr {
+		t.Errorf("inherited addr = %s, want %s", got, addr)
+	}
+
+	os.Setenv(ENV_LISTEN_FDS, addr+"=x")
+	if _, err := Listen(addr); err == nil || !strings.Contains(err.Error(), ENV_LISTEN_FDS) {
+		t.Errorf("Listen() error = %v", err)
+	}
+}
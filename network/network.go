@@ -3,7 +3,74 @@
 
 package network
 
+import (
+	"context"
+	"socketserver/library/wslog"
+	"sync/atomic"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
 // Agent 连接对象接口
 type Agent interface {
 	ReadMsg()
 }
+
+// defaultLogger 未指定logger时使用wslog.Logger，wslog未初始化时丢弃日志
+func defaultLogger(logger logit.Logger) logit.Logger {
+	if logger != nil {
+		return logger
+	}
+	if wslog.Logger != nil {
+		return wslog.Logger
+	}
+	return logit.NopLogger
+}
+
+// writeReq 写channel中的消息，done不为nil时写入连接后通知调用方
+type writeReq struct {
+	data []byte
+	done chan error
+}
+
+// finish 通知调用方写入结果
+func (req writeReq) finish(err error) {
+	if req.done != nil {
+		req.done <- err
+	}
+}
+
+// writeWait 写channel满时等待，消息写入连接后返回，TCPConn和WSConn共用
+// 连接关闭前已写入的消息返回写入结果，其他情况返回ErrConnClosed或ctx的错误
+func writeWait(ctx context.Context, writeChan chan writeReq, closeChan chan byte, pending *int64, b []byte) error {
+	req := writeReq{data: b, done: make(chan error, 1)}
+	atomic.AddInt64(pending, 1)
+	select {
+	case <-closeChan:
+		atomic.AddInt64(pending, -1)
+		return ErrConnClosed
+	default:
+	}
+	select {
+	case writeChan <- req:
+	case <-closeChan:
+		atomic.AddInt64(pending, -1)
+		return ErrConnClosed
+	case <-ctx.Done():
+		atomic.AddInt64(pending, -1)
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-closeChan:
+		select {
+		case err := <-req.done:
+			return err
+		default:
+			return ErrConnClosed
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
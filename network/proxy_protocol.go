@@ -0,0 +1,227 @@
+// Author: Vcentor
+// Date: 2026/10/20 4:10 下午
+// desc: HAProxy PROXY protocol v1/v2解析，部署在四层负载均衡之后时获取真实客户端地址
+// 协议说明 https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt
+
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLen    = 107
+	proxyV2HeaderLen = 16
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var ErrInvalidProxyHeader = errors.New("invalid proxy protocol header")
+
+// ProxyListener 解析PROXY protocol头的listener，只有来源在可信网段内的连接才会解析
+// 可信来源未发送PROXY头时按直连处理
+type ProxyListener struct {
+	net.Listener
+	Trusted       []*net.IPNet
+	HeaderTimeout time.Duration // 读取PROXY头的超时时间
+}
+
+// Accept 接收连接，PROXY头在第一次读取数据或获取地址时解析，不阻塞accept
+func (l *ProxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !containsIP(l.Trusted, AddrIP(conn.RemoteAddr())) {
+		return conn, nil
+	}
+	timeout := l.HeaderTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &proxyConn{
+		Conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: timeout,
+	}, nil
+}
+
+// proxyConn 带PROXY头的连接
+type proxyConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	timeout    time.Duration
+	once       sync.Once
+	remoteAddr net.Addr
+	localAddr  net.Addr
+	err        error
+}
+
+// Read 读取PROXY头之后的数据
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr 真实客户端地址
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr 客户端连接的目标地址
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// SetLinger 设置底层tcp连接的linger
+func (c *proxyConn) SetLinger(sec int) error {
+	if tc, ok := c.Conn.(*net.TCPConn); ok {
+		return tc.SetLinger(sec)
+	}
+	return nil
+}
+
+// readHeader 解析PROXY头
+func (c *proxyConn) readHeader() {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	first, err := c.reader.Peek(1)
+	if err != nil {
+		c.err = err
+		return
+	}
+	switch first[0] {
+	case proxyV1Prefix[0]:
+		c.remoteAddr, c.localAddr, c.err = parseProxyV1(c.reader)
+	case proxyV2Signature[0]:
+		c.remoteAddr, c.localAddr, c.err = parseProxyV2(c.reader)
+	}
+}
+
+// parseProxyV1 解析文本格式的PROXY头，如 PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\n
+// 不是PROXY头时不消费数据，返回nil地址
+func parseProxyV1(r *bufio.Reader) (src, dst net.Addr, err error) {
+	prefix, err := r.Peek(len(proxyV1Prefix))
+	if err != nil || string(prefix) != proxyV1Prefix {
+		return nil, nil, nil
+	}
+	var line []byte
+	for len(line) < proxyV1MaxLen {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, ErrInvalidProxyHeader
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, ErrInvalidProxyHeader
+	}
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if srcIP == nil || dstIP == nil || err1 != nil || err2 != nil {
+		return nil, nil, ErrInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: srcIP, Port: int(srcPort)}, &net.TCPAddr{IP: dstIP, Port: int(dstPort)}, nil
+}
+
+// parseProxyV2 解析二进制格式的PROXY头
+// 不是PROXY头时不消费数据，返回nil地址
+func parseProxyV2(r *bufio.Reader) (src, dst net.Addr, err error) {
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err != nil || !bytes.Equal(sig, proxyV2Signature) {
+		return nil, nil, nil
+	}
+	var header [proxyV2HeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, ErrInvalidProxyHeader
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+	// LOCAL命令为负载均衡自身的连接，如健康检查
+	if header[12]&0x0f == 0 {
+		return nil, nil, nil
+	}
+	switch header[13] >> 4 {
+	case 1: // AF_INET
+		if len(payload) < 12 {
+			return nil, nil, ErrInvalidProxyHeader
+		}
+		src = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		dst = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+	case 2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, nil, ErrInvalidProxyHeader
+		}
+		src = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		dst = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	}
+	// 其他地址族保留原始地址，TLV扩展字段忽略
+	return src, dst, nil
+}
+
+// ForwardedIP 可信代理转发的请求，从X-Real-IP或X-Forwarded-For中获取真实客户端ip
+// X-Forwarded-For从右向左取第一个不可信的地址
+func ForwardedIP(peer net.IP, header map[string][]string, trusted []*net.IPNet) net.IP {
+	if peer == nil || !containsIP(trusted, peer) {
+		return peer
+	}
+	if v := headerValue(header, "X-Forwarded-For"); v != "" {
+		hops := strings.Split(v, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if !containsIP(trusted, ip) || i == 0 {
+				return ip
+			}
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(headerValue(header, "X-Real-Ip"))); ip != nil {
+		return ip
+	}
+	return peer
+}
+
+// headerValue 获取header，多个同名header用逗号拼接
+func headerValue(header map[string][]string, key string) string {
+	return strings.Join(header[key], ",")
+}
@@ -0,0 +1,102 @@
+// Author: Vcentor
+// Date: 2026/10/20 5:20 下午
+// desc: PROXY protocol和转发头解析测试
+
+package network
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// proxyV2Header 生成AF_INET的v2头
+func proxyV2Header(src, dst string, sport, dport uint16) []byte {
+	b := append([]byte{}, proxyV2Signature...)
+	b = append(b, 0x21, 0x11, 0, 12)
+	b = append(b, net.ParseIP(src).To4()...)
+	b = append(b, net.ParseIP(dst).To4()...)
+	var port [4]byte
+	binary.BigEndian.PutUint16(port[0:2], sport)
+	binary.BigEndian.PutUint16(port[2:4], dport)
+	return append(b, port[:]...)
+}
+
+func TestProxyListener(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		trusted []string
+		want    string
+	}{
+		{name: "v1", header: []byte("PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\n"), trusted: []string{"127.0.0.1"}, want: "1.2.3.4:1111"},
+		{name: "v1-unknown", header: []byte("PROXY UNKNOWN\r\n"), trusted: []string{"127.0.0.1"}, want: "127.0.0.1"},
+		{name: "v2", header: proxyV2Header("9.8.7.6", "5.6.7.8", 3333, 2222), trusted: []string{"127.0.0.1"}, want: "9.8.7.6:3333"},
+		{name: "no-header", header: nil, trusted: []string{"127.0.0.1"}, want: "127.0.0.1"},
+		{name: "untrusted", header: []byte("PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\n"), trusted: nil, want: "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trusted, _ := ParseCIDRs(tt.trusted)
+			raw, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ln := &ProxyListener{Listener: raw, Trusted: trusted, HeaderTimeout: time.Second}
+			defer ln.Close()
+
+			go func() {
+				c, err := net.Dial("tcp", raw.Addr().String())
+				if err != nil {
+					return
+				}
+				c.Write(append(tt.header, []byte("hello")...))
+				c.Close()
+			}()
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			got := conn.RemoteAddr().String()
+			if tt.want == "127.0.0.1" {
+				got = AddrIP(conn.RemoteAddr()).String()
+			}
+			if got != tt.want {
+				t.Errorf("RemoteAddr() = %s, want %s", got, tt.want)
+			}
+			data, err := ioutil.ReadAll(conn)
+			if tt.name == "untrusted" {
+				return
+			}
+			if err != nil || string(data) != "hello" {
+				t.Errorf("Read() = %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestForwardedIP(t *testing.T) {
+	trusted, _ := ParseCIDRs([]string{"10.0.0.0/8"})
+	tests := []struct {
+		name   string
+		peer   string
+		header map[string][]string
+		want   string
+	}{
+		{name: "untrusted-peer", peer: "1.1.1.1", header: map[string][]string{"X-Real-Ip": {"2.2.2.2"}}, want: "1.1.1.1"},
+		{name: "real-ip", peer: "10.0.0.1", header: map[string][]string{"X-Real-Ip": {"2.2.2.2"}}, want: "2.2.2.2"},
+		{name: "xff-rightmost-untrusted", peer: "10.0.0.1", header: map[string][]string{"X-Forwarded-For": {"6.6.6.6, 3.3.3.3, 10.0.0.9"}}, want: "3.3.3.3"},
+		{name: "no-header", peer: "10.0.0.1", header: nil, want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ForwardedIP(net.ParseIP(tt.peer), tt.header, trusted); got.String() != tt.want {
+				t.Errorf("ForwardedIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+// Author: Vcentor
+// Date: 2026/10/27 5:20 下午
+// desc: tcp client，与TCPServer使用相同的长度前缀格式，读写channel语义与WSClient一致
+
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"socketserver/library/trace"
+	"sync"
+	"time"
+
+	"icode.baidu.com/baidu/gdp/logit"
+)
+
+// ErrTCPClientClosed 连接已关闭
+var ErrTCPClientClosed = errors.New("TCPClient channel is closed")
+
+// TCPClientOption tcp client选项
+type TCPClientOption struct {
+	Addr          string
+	ChanCap       int           // 读写channel缓冲，默认100
+	Retry         int           // 建连和重连的尝试次数，<=0时NewTCPClient尝试1次，ReConnect直到成功或ctx取消
+	AutoReconnect bool          // 连接异常断开后在后台按Retry和Backoff自动ReConnect，Close后停止
+	Parser        *TCPParser    // 消息格式，需与服务端一致，为空时使用NewTCPParser
+	TLSConfig     *tls.Config   // 不为空时使用TLS
+	DialTimeout   time.Duration // 单次建连超时，默认10s
+	Backoff       Backoff       // 重试间隔
+	Logger        logit.Logger  // 为空时使用wslog.Logger
+}
+
+// TCPClient tcp client
+type TCPClient struct {
+	opt       TCPClientOption
+	logger    logit.Logger
+	ctx       context.Context
+	cancel    context.CancelFunc // Close时取消，结束自动重连
+	conn      net.Conn
+	readChan  chan []byte
+	writeChan chan []byte
+	closeFlag bool
+	closed    bool // 调用了Close
+	closeChan chan byte
+	mutex     sync.Mutex
+}
+
+// NewTCPClient 建立tcp连接，按Retry和Backoff重试
+func NewTCPClient(opt TCPClientOption) (*TCPClient, error) {
+	return NewTCPClientContext(context.Background(), opt)
+}
+
+// NewTCPClientContext 建立tcp连接，ctx携带追踪上下文时记录建连span，ctx取消时停止重试
+func NewTCPClientContext(ctx context.Context, opt TCPClientOption) (*TCPClient, error) {
+	if opt.ChanCap <= 0 {
+		opt.ChanCap = 100
+	}
+	if opt.Parser == nil {
+		opt.Parser = NewTCPParser()
+	}
+	if opt.DialTimeout <= 0 {
+		opt.DialTimeout = 10 * time.Second
+	}
+	retry := opt.Retry
+	if retry <= 0 {
+		retry = 1
+	}
+	tc := &TCPClient{opt: opt, logger: defaultLogger(opt.Logger)}
+	tc.ctx, tc.cancel = context.WithCancel(context.Background())
+	conn, err := tc.dialRetry(ctx, retry)
+	if err != nil {
+		tc.cancel()
+		return nil, err
+	}
+	tc.start(conn)
+	return tc, nil
+}
+
+// dial 建立一次连接
+func (tc *TCPClient) dial(ctx context.Context) (net.Conn, error) {
+	d := &net.Dialer{Timeout: tc.opt.DialTimeout}
+	if tc.opt.TLSConfig != nil {
+		td := &tls.Dialer{NetDialer: d, Config: tc.opt.TLSConfig}
+		return td.DialContext(ctx, "tcp", tc.opt.Addr)
+	}
+	return d.DialContext(ctx, "tcp", tc.opt.Addr)
+}
+
+// dialRetry 按退避间隔重试，retry<=0时直到成功或ctx取消
+func (tc *TCPClient) dialRetry(ctx context.Context, retry int) (net.Conn, error) {
+	ctx, span := trace.Start(ctx, "TCP connect")
+	span.SetAttr("tcp.addr", tc.opt.Addr)
+	defer span.End()
+	var (
+		conn net.Conn
+		err  error
+	)
+	for i := 0; retry <= 0 || i < retry; i++ {
+		if i > 0 && !sleepContext(ctx, tc.opt.Backoff.Duration(i-1)) {
+			err = ctx.Err()
+			break
+		}
+		if conn, err = tc.dial(ctx); err == nil {
+			return conn, nil
+		}
+		tc.logger.Warning(ctx, "TCPClient connect fail", logit.String("addr", tc.opt.Addr),
+			logit.Int("attempt", i+1), logit.Error("error", err))
+	}
+	span.SetError(err)
+	return nil, err
+}
+
+// start 使用新连接，启动读写协程，已Close或并发重连已成功时关闭conn
+func (tc *TCPClient) start(conn net.Conn) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if tc.closed || (tc.conn != nil && !tc.closeFlag) {
+		conn.Close()
+		return
+	}
+	tc.conn = conn
+	tc.closeFlag = false
+	tc.closeChan = make(chan byte, 1)
+	tc.readChan = make(chan []byte, tc.opt.ChanCap)
+	tc.writeChan = make(chan []byte, tc.opt.ChanCap)
+	go tc.readLoop(conn, tc.readChan, tc.closeChan)
+	go tc.writeLoop(conn, tc.writeChan, tc.closeChan)
+}
+
+// chans 当前连接的读写channel
+func (tc *TCPClient) chans() (readChan, writeChan chan []byte, closeChan chan byte) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	return tc.readChan, tc.writeChan, tc.closeChan
+}
+
+// ReadMsg 读取一条消息，连接关闭前已收到的消息读完后返回错误
+func (tc *TCPClient) ReadMsg() ([]byte, error) {
+	readChan, _, closeChan := tc.chans()
+	select {
+	case data := <-readChan:
+		return data, nil
+	case <-closeChan:
+	}
+	select {
+	case data := <-readChan:
+		return data, nil
+	default:
+		return nil, ErrTCPClientClosed
+	}
+}
+
+// readLoop 读取数据
+func (tc *TCPClient) readLoop(conn net.Conn, readChan chan []byte, closeChan chan byte) {
+	defer tc.lost(conn)
+	for {
+		data, err := tc.opt.Parser.Decode(conn)
+		if err != nil {
+			tc.logger.Notice(context.Background(), "TCPClient read message failed", logit.Error("error", err))
+			return
+		}
+		select {
+		case readChan <- data:
+		case <-closeChan:
+			return
+		}
+	}
+}
+
+// WriteMsg 发送一条消息，长度超出Parser限制时返回错误
+func (tc *TCPClient) WriteMsg(data []byte) error {
+	b, err := tc.opt.Parser.Encode(data)
+	if err != nil {
+		return err
+	}
+	_, writeChan, closeChan := tc.chans()
+	// 写channel有空间时select随机选择，先检查是否已关闭
+	select {
+	case <-closeChan:
+		return ErrTCPClientClosed
+	default:
+	}
+	select {
+	case writeChan <- b:
+		return nil
+	case <-closeChan:
+		return ErrTCPClientClosed
+	}
+}
+
+// writeLoop 发送已编码的数据
+func (tc *TCPClient) writeLoop(conn net.Conn, writeChan chan []byte, closeChan chan byte) {
+	defer tc.lost(conn)
+	for {
+		select {
+		case b := <-writeChan:
+			if _, err := conn.Write(b); err != nil {
+				tc.logger.Notice(context.Background(), "TCPClient write message failed", logit.Error("error", err))
+				return
+			}
+		case <-closeChan:
+			return
+		}
+	}
+}
+
+// closeConn 关闭conn，已经重连时不影响新连接，返回是否由本次调用关闭
+func (tc *TCPClient) closeConn(conn net.Conn) bool {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if tc.conn != conn || tc.closeFlag {
+		return false
+	}
+	tc.conn.Close()
+	close(tc.closeChan)
+	tc.closeFlag = true
+	return true
+}
+
+// lost 读写失败时关闭conn，开启AutoReconnect且未Close时后台重连
+func (tc *TCPClient) lost(conn net.Conn) {
+	if !tc.closeConn(conn) || !tc.opt.AutoReconnect {
+		return
+	}
+	go func() { _ = tc.ReConnect(tc.ctx) }()
+}
+
+// Close 关闭连接，停止自动重连，之后ReConnect返回ErrTCPClientClosed
+func (tc *TCPClient) Close() {
+	tc.mutex.Lock()
+	if tc.closed {
+		tc.mutex.Unlock()
+		return
+	}
+	tc.closed = true
+	conn := tc.conn
+	tc.mutex.Unlock()
+	tc.cancel()
+	tc.closeConn(conn)
+}
+
+// ReConnect 连接断开后按Retry和Backoff重连，未断开时直接返回
+// 重连期间不持有锁，不阻塞读写和Close，Close后返回ErrTCPClientClosed
+func (tc *TCPClient) ReConnect(ctx context.Context) error {
+	tc.mutex.Lock()
+	closed, closeFlag := tc.closed, tc.closeFlag
+	tc.mutex.Unlock()
+	if closed {
+		return ErrTCPClientClosed
+	}
+	if !closeFlag {
+		return nil
+	}
+	// Close时同时停止重连
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-tc.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	conn, err := tc.dialRetry(ctx, tc.opt.Retry)
+	if err != nil {
+		tc.logger.Error(ctx, "TCPClient reconnect fail", logit.String("addr", tc.opt.Addr), logit.Error("error", err))
+		return err
+	}
+	tc.start(conn)
+	tc.logger.Debug(ctx, "TCPClient reconnect success", logit.String("addr", tc.opt.Addr))
+	return nil
+}
+
+// GetCloseFlag 获取closeFlag
+func (tc *TCPClient) GetCloseFlag() bool {
+	tc.mutex.Lock()
+	flag := tc.closeFlag
+	tc.mutex.Unlock()
+	return flag
+}
+
+// LocalAddr 本地地址
+func (tc *TCPClient) LocalAddr() net.Addr {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	return tc.conn.LocalAddr()
+}
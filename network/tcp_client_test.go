@@ -0,0 +1,225 @@
+// Author: Vcentor
+// Date: 2026/10/27 5:50 下午
+// desc: tcp client收发、TLS、重连和退避间隔测试
+
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// selfSignedTLS 生成127.0.0.1的自签名证书，返回服务端和客户端配置
+func selfSignedTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: pool}
+}
+
+// echoServer 按parser格式原样返回消息，收到bye时断开连接
+func echoServer(t *testing.T, ln net.Listener, parser *TCPParser) {
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					data, err := parser.Decode(conn)
+					if err != nil || string(data) == "bye" {
+						return
+					}
+					b, _ := parser.Encode(data)
+					if _, err := conn.Write(b); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+}
+
+func TestTCPClient(t *testing.T) {
+	serverTLS, clientTLS := selfSignedTLS(t)
+	parser := NewTCPParser()
+	parser.WithMsgLen(4, 1, 16)
+	parser.WithEndian(true)
+
+	tests := []struct {
+		name      string
+		serverTLS *tls.Config
+		clientTLS *tls.Config
+	}{
+		{name: "plain"},
+		{name: "tls", serverTLS: serverTLS, clientTLS: clientTLS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.serverTLS != nil {
+				ln = tls.NewListener(ln, tt.serverTLS)
+			}
+			echoServer(t, ln, parser)
+
+			tc, err := NewTCPClient(TCPClientOption{
+				Addr:      ln.Addr().String(),
+				Retry:     3,
+				Parser:    parser,
+				TLSConfig: tt.clientTLS,
+				Backoff:   Backoff{Min: time.Millisecond, Max: 10 * time.Millisecond},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tc.Close()
+
+			echo := func() {
+				if err := tc.WriteMsg([]byte("hello")); err != nil {
+					t.Fatal(err)
+				}
+				if data, err := tc.ReadMsg(); err != nil || string(data) != "hello" {
+					t.Fatalf("ReadMsg() = %q, %v", data, err)
+				}
+			}
+			echo()
+			if err := tc.WriteMsg(make([]byte, 17)); err == nil {
+				t.Error("WriteMsg() over max_msg_len error = nil")
+			}
+
+			// 服务端断开后读取失败，重连后恢复
+			_ = tc.WriteMsg([]byte("bye"))
+			if _, err := tc.ReadMsg(); err != ErrTCPClientClosed {
+				t.Fatalf("ReadMsg() after server close error = %v", err)
+			}
+			if !tc.GetCloseFlag() {
+				t.Fatal("GetCloseFlag() = false after server close")
+			}
+			if err := tc.ReConnect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			echo()
+
+			// Close后不再重连
+			tc.Close()
+			if err := tc.ReConnect(context.Background()); err != ErrTCPClientClosed {
+				t.Errorf("ReConnect() after Close error = %v, want %v", err, ErrTCPClientClosed)
+			}
+			if err := tc.WriteMsg([]byte("hello")); err != ErrTCPClientClosed {
+				t.Errorf("WriteMsg() after Close error = %v, want %v", err, ErrTCPClientClosed)
+			}
+		})
+	}
+
+	t.Run("auto reconnect", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		echoServer(t, ln, parser)
+		tc, err := NewTCPClient(TCPClientOption{
+			Addr:          ln.Addr().String(),
+			Parser:        parser,
+			AutoReconnect: true,
+			Backoff:       Backoff{Min: time.Millisecond, Max: 10 * time.Millisecond},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tc.Close()
+
+		// 服务端断开后后台自动重连
+		_ = tc.WriteMsg([]byte("bye"))
+		if _, err := tc.ReadMsg(); err != ErrTCPClientClosed {
+			t.Fatalf("ReadMsg() after server close error = %v", err)
+		}
+		deadline := time.Now().Add(time.Second)
+		for tc.GetCloseFlag() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if err := tc.WriteMsg([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := tc.ReadMsg(); err != nil || string(data) != "hello" {
+			t.Fatalf("ReadMsg() after auto reconnect = %q, %v", data, err)
+		}
+	})
+
+	t.Run("dial fail", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := ln.Addr().String()
+		ln.Close()
+		_, err = NewTCPClient(TCPClientOption{Addr: addr, Retry: 2, Backoff: Backoff{Min: time.Millisecond}})
+		if err == nil {
+			t.Error("NewTCPClient() to closed port error = nil")
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Min: 10 * time.Millisecond, Max: 100 * time.Millisecond, Jitter: -1}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+		{3, 80 * time.Millisecond},
+		{4, 100 * time.Millisecond},
+		{50, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := b.Duration(tt.attempt); got != tt.want {
+			t.Errorf("Duration(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := b.Duration(1); got < 10*time.Millisecond || got > 20*time.Millisecond {
+			t.Fatalf("Duration(1) with jitter = %v, want in [10ms, 20ms]", got)
+		}
+	}
+}
@@ -6,10 +6,10 @@ package network
 
 import (
 	"context"
-	"socketserver/library/wslog"
 	"icode.baidu.com/baidu/gdp/logit"
 	"net"
 	"sync"
+	"sync/atomic"
 )
 
 // TCPConnPool 连接池
@@ -25,7 +25,7 @@ func NewTCPConnPool() *TCPConnPool {
 	}
 }
 
-//ConnNum 连接数
+// ConnNum 连接数
 func (pool *TCPConnPool) Len() int {
 	pool.Lock()
 	defer pool.Unlock()
@@ -94,25 +94,31 @@ func (pool *TCPConnPool) DelConn(conn *TCPConn) {
 // TCPConn read and write
 type TCPConn struct {
 	sync.Mutex
+	closeReason
 	conn      net.Conn
-	writeChan chan []byte
+	writeChan chan writeReq
 	connPool  *TCPConnPool
 	closeFlag bool
 	closeChan chan byte
 	parser    *TCPParser
 	sessionID string
+	attrs     *Attrs
+	pending   int64 // 写入channel但未写入连接的消息数
+	logger    logit.Logger
 }
 
 // newTCPConn 初始化TCPConn
-func newTCPConn(conn net.Conn, chanCap int, ssid string, parser *TCPParser, pool *TCPConnPool) *TCPConn {
+func newTCPConn(conn net.Conn, chanCap int, ssid string, parser *TCPParser, pool *TCPConnPool, logger logit.Logger) *TCPConn {
 	tcpConn := &TCPConn{
 		conn:      conn,
-		writeChan: make(chan []byte, chanCap),
+		writeChan: make(chan writeReq, chanCap),
 		connPool:  pool,
 		closeFlag: false,
 		closeChan: make(chan byte, 1),
 		parser:    parser,
 		sessionID: ssid,
+		attrs:     NewAttrs(),
+		logger:    defaultLogger(logger),
 	}
 	go tcpConn.writeLoop()
 	return tcpConn
@@ -123,35 +129,62 @@ func (tcpConn *TCPConn) Read(b []byte) (n int, err error) {
 	return tcpConn.conn.Read(b)
 }
 
-func (tcpConn *TCPConn) doWrite(b []byte) {
+// doWrite 写入channel，channel满时返回false，调用方需持有锁
+func (tcpConn *TCPConn) doWrite(b []byte) bool {
 	if len(tcpConn.writeChan) == cap(tcpConn.writeChan) {
-		wslog.Logger.Notice(context.Background(), "close tcp conn: channel full")
-		tcpConn.Close()
+		return false
 	}
-	tcpConn.writeChan <- b
+	atomic.AddInt64(&tcpConn.pending, 1)
+	tcpConn.writeChan <- writeReq{data: b}
+	return true
 }
 
-// Write data
-func (tcpConn *TCPConn) Write(b []byte) {
+// Write data，不阻塞调用方；写channel满时说明客户端消费过慢，断开连接
+func (tcpConn *TCPConn) Write(b []byte) error {
 	tcpConn.Lock()
-	defer tcpConn.Unlock()
-	if tcpConn.closeFlag || b == nil {
-		return
+	if tcpConn.closeFlag {
+		tcpConn.Unlock()
+		return ErrConnClosed
+	}
+	if b == nil {
+		tcpConn.Unlock()
+		return nil
 	}
-	tcpConn.doWrite(b)
+	ok := tcpConn.doWrite(b)
+	tcpConn.Unlock()
+	if !ok {
+		tcpConn.logger.Warning(context.Background(), "close tcp conn: channel full",
+			logit.String("sessionId", tcpConn.GetSessionID()), logit.String("remoteAddr", tcpConn.RemoteAddr().String()))
+		tcpConn.CloseWithReason(CLOSE_SLOW_CONSUMER, nil)
+		return ErrSlowConsumer
+	}
+	return nil
+}
+
+// WriteContext 写channel满时等待，数据写入连接后返回，ctx取消或连接关闭时返回错误
+func (tcpConn *TCPConn) WriteContext(ctx context.Context, b []byte) error {
+	if b == nil {
+		return nil
+	}
+	return writeWait(ctx, tcpConn.writeChan, tcpConn.closeChan, &tcpConn.pending, b)
 }
 
 // writeLoop
 func (tcpConn *TCPConn) writeLoop() {
-	var b []byte
+	var req writeReq
 	for {
 		select {
-		case b = <-tcpConn.writeChan:
+		case req = <-tcpConn.writeChan:
 		case <-tcpConn.closeChan:
 			goto CLOSE
 		}
-		if _, err := tcpConn.conn.Write(b); err != nil {
-			wslog.Logger.Notice(context.Background(), "TCPConn write message failed!", logit.String("message", string(b)), logit.Error("error", err))
+		_, err := tcpConn.conn.Write(req.data)
+		atomic.AddInt64(&tcpConn.pending, -1)
+		req.finish(err)
+		if err != nil {
+			tcpConn.logger.Warning(context.Background(), "TCPConn write message failed!", logit.String("sessionId", tcpConn.GetSessionID()),
+				logit.String("message", string(req.data)), logit.Error("error", err))
+			tcpConn.setCloseReason(CLOSE_WRITE_ERROR, err)
 			goto CLOSE
 		}
 	}
@@ -159,18 +192,42 @@ CLOSE:
 	tcpConn.Close()
 }
 
-// Close 关闭连接，释放内存
+// Close 关闭连接，释放内存，未发送的数据直接丢弃
 func (tcpConn *TCPConn) Close() {
-	if !tcpConn.closeFlag {
-		tcpConn.Lock()
-		if !tcpConn.closeFlag {
-			_ = tcpConn.conn.(*net.TCPConn).SetLinger(0)
-			_ = tcpConn.conn.Close()
-			tcpConn.connPool.DelConn(tcpConn)
-			close(tcpConn.closeChan)
-			tcpConn.closeFlag = true
+	tcpConn.setCloseReason(CLOSE_SERVER, nil)
+	tcpConn.close(true)
+}
+
+// CloseWithReason 关闭连接并记录原因，已有原因时不覆盖
+func (tcpConn *TCPConn) CloseWithReason(reason string, err error) {
+	tcpConn.setCloseReason(reason, err)
+	tcpConn.close(true)
+}
+
+// CloseGracefully 关闭连接，已写入内核缓冲区的数据继续发送
+func (tcpConn *TCPConn) CloseGracefully() {
+	tcpConn.setCloseReason(CLOSE_SERVER, nil)
+	tcpConn.close(false)
+}
+
+// close 关闭连接，reset为true时丢弃内核缓冲区中未发送的数据
+func (tcpConn *TCPConn) close(reset bool) {
+	// closeFlag只在锁内读写
+	tcpConn.Lock()
+	closed := tcpConn.closeFlag
+	if !closed {
+		if lc, ok := tcpConn.conn.(interface{ SetLinger(int) error }); ok && reset {
+			_ = lc.SetLinger(0)
 		}
-		tcpConn.Unlock()
+		_ = tcpConn.conn.Close()
+		tcpConn.connPool.DelConn(tcpConn)
+		close(tcpConn.closeChan)
+		tcpConn.closeFlag = true
+	}
+	tcpConn.Unlock()
+	// 清理函数可能会访问连接池，放在锁外执行
+	if !closed {
+		tcpConn.attrs.close()
 	}
 }
 
@@ -199,9 +256,19 @@ func (tcpConn *TCPConn) GetCloseFlag() bool {
 	return tcpConn.closeFlag
 }
 
-// GetSessionID 获取session信息
+// Attrs 会话属性
+func (tcpConn *TCPConn) Attrs() *Attrs {
+	return tcpConn.attrs
+}
+
+// PendingWrites 待发送的消息数
+func (tcpConn *TCPConn) PendingWrites() int {
+	return int(atomic.LoadInt64(&tcpConn.pending))
+}
+
+// GetSessionID 获取session信息，连接关闭移出连接池后仍然有效
 func (tcpConn *TCPConn) GetSessionID() string {
-	return tcpConn.connPool.SessionID(tcpConn)
+	return tcpConn.sessionID
 }
 
 // ReadMsg 根据协议读取数据
@@ -213,3 +280,12 @@ func (tcpConn *TCPConn) ReadMsg() ([]byte, error) {
 func (tcpConn *TCPConn) WriteMsg(args ...[]byte) error {
 	return tcpConn.parser.Write(tcpConn, args...)
 }
+
+// WriteMsgContext 根据协议写入数据，写channel满时等待，写入连接后返回
+func (tcpConn *TCPConn) WriteMsgContext(ctx context.Context, args ...[]byte) error {
+	msg, err := tcpConn.parser.Encode(args...)
+	if err != nil {
+		return err
+	}
+	return tcpConn.WriteContext(ctx, msg)
+}
@@ -70,10 +70,15 @@ func (p *TCPParser) WithEndian(littleEndian bool) {
 
 // Read 读取信息
 func (p *TCPParser) Read(conn *TCPConn) ([]byte, error) {
+	return p.Decode(conn)
+}
+
+// Decode 从r读取一条消息，客户端可以直接读取net.Conn
+func (p *TCPParser) Decode(r io.Reader) ([]byte, error) {
 	var buf = make([]byte, 4)
 	bufMsgLen := buf[:p.lenMsgLen]
 
-	if _, err := io.ReadFull(conn, bufMsgLen); err != nil {
+	if _, err := io.ReadFull(r, bufMsgLen); err != nil {
 		return nil, err
 	}
 
@@ -106,7 +111,7 @@ func (p *TCPParser) Read(conn *TCPConn) ([]byte, error) {
 	}
 
 	msgData := make([]byte, msgLen)
-	if _, err := io.ReadFull(msgData); err != nil {
+	if _, err := io.ReadFull(r, msgData); err != nil {
 		return nil, err
 	}
 
@@ -115,17 +120,27 @@ func (p *TCPParser) Read(conn *TCPConn) ([]byte, error) {
 
 // Write 写入信息
 func (p *TCPParser) Write(conn *TCPConn, args ...[]byte) error {
+	msg, err := p.Encode(args...)
+	if err != nil {
+		return err
+	}
+
+	return conn.Write(msg)
+}
+
+// Encode 拼接长度和数据，客户端可以直接写入net.Conn
+func (p *TCPParser) Encode(args ...[]byte) ([]byte, error) {
 	var msgLen uint32
 	for i := 0; i < len(args); i++ {
 		msgLen += uint32(len(args[i]))
 	}
 
 	if msgLen > p.maxMsgLen {
-		return errors.New("message too long")
+		return nil, errors.New("message too long")
 	}
 
 	if msgLen < p.minMsgLen {
-		return errors.New("message too short")
+		return nil, errors.New("message too short")
 	}
 
 	var msg = make([]byte, uint32(p.lenMsgLen)+msgLen)
@@ -152,7 +167,5 @@ func (p *TCPParser) Write(conn *TCPConn, args ...[]byte) error {
 		l += len(args[i])
 	}
 
-	conn.Write(msg)
-
-	return nil
+	return msg, nil
 }
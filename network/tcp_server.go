@@ -6,11 +6,13 @@ package network
 
 import (
 	"context"
-	"socketserver/library/utils"
-	"socketserver/library/wslog"
 	"fmt"
+	"icode.baidu.com/baidu/gdp/logit"
 	"log"
 	"net"
+	"socketserver/library/utils"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,8 +23,21 @@ type TCPServer struct {
 	MaxConnNum int
 	ChanCap    int
 	NewAgent   func(*TCPConn) Agent
+	IPFilter   *IPFilter           // 接入控制，为空时只限制最大连接数
+	Listener   net.Listener        // 已创建的listener，为空时监听ListenAddr
+	Logger     logit.Logger        // 为空时使用wslog.Logger
+	OnReject   func(reason string) // 拒绝连接时回调，用于统计
+	FailChan   chan error          // 启动后accept失败的错误，为空时只记录日志
 	ln         net.Listener
-	connPool   *TCPConnPool
+	closed     int32        // 主动停止accept，之后的accept错误不属于失败
+	mutex      sync.RWMutex // 保护运行时可修改的MaxConnNum和ChanCap
+	reserved   int32        // 已通过连接数检查、尚未加入连接池的连接，计入最大连接数
+
+	// PROXY protocol，只解析来自可信网段的连接
+	ProxyProtocol      bool
+	TrustedProxies     []*net.IPNet
+	ProxyHeaderTimeout time.Duration
+	connPool           *TCPConnPool
 
 	// parser
 	LenMsgLen    int
@@ -32,20 +47,33 @@ type TCPServer struct {
 	tcpParser    *TCPParser
 }
 
-// Start 启动
-func (tcpServer *TCPServer) Start() {
-	ctx, _ := context.WithCancel(tcpServer.Ctx)
-	tcpServer.init()
-	go tcpServer.run(ctx)
+// Start 启动，监听失败时返回错误
+func (tcpServer *TCPServer) Start() error {
+	if err := tcpServer.init(); err != nil {
+		return err
+	}
+	go tcpServer.run(tcpServer.Ctx)
+	return nil
 }
 
 // init 初始化
-func (tcpServer *TCPServer) init() {
-	ln, err := net.Listen("tcp", tcpServer.ListenAddr)
-	if err != nil {
-		panic(err)
+func (tcpServer *TCPServer) init() error {
+	ln := tcpServer.Listener
+	if ln == nil {
+		var err error
+		if ln, err = Listen(tcpServer.ListenAddr); err != nil {
+			return err
+		}
 	}
+	tcpServer.Logger = defaultLogger(tcpServer.Logger)
 
+	if tcpServer.ProxyProtocol {
+		ln = &ProxyListener{
+			Listener:      ln,
+			Trusted:       tcpServer.TrustedProxies,
+			HeaderTimeout: tcpServer.ProxyHeaderTimeout,
+		}
+	}
 	tcpServer.ln = ln
 
 	if tcpServer.MaxConnNum <= 0 {
@@ -58,13 +86,23 @@ func (tcpServer *TCPServer) init() {
 		log.Printf("Invalid ChanCap, reset to %d\n", tcpServer.ChanCap)
 	}
 
+	if tcpServer.IPFilter == nil {
+		tcpServer.IPFilter, _ = NewIPFilter(IPFilterOption{})
+	}
+
 	tcpServer.connPool = NewTCPConnPool()
 
 	tcpParser := NewTCPParser()
 	tcpParser.WithMsgLen(tcpServer.LenMsgLen, tcpServer.MinMsgLen, tcpServer.MaxMsgLen)
-	tcpParser.WithEndian(tcpParser.littleEndian)
+	tcpParser.WithEndian(tcpServer.LittleEndian)
 
 	tcpServer.tcpParser = tcpParser
+	return nil
+}
+
+// LocalAddr 实际监听地址，ListenAddr端口为0时可获取分配的端口
+func (tcpServer *TCPServer) LocalAddr() net.Addr {
+	return tcpServer.ln.Addr()
 }
 
 // run 启动
@@ -86,35 +124,112 @@ func (tcpServer *TCPServer) run(ctx context.Context) {
 				if max := 1 * time.Second; tempDelay > max {
 					tempDelay = max
 				}
-				wslog.Logger.Notice(ctx, fmt.Sprintf("TCPAccept:accept error: %v; retrying in %v", err, tempDelay))
+				tcpServer.Logger.Notice(ctx, fmt.Sprintf("TCPAccept:accept error: %v; retrying in %v", err, tempDelay))
 
 				time.Sleep(tempDelay)
 				continue
 			}
+			if atomic.LoadInt32(&tcpServer.closed) == 0 {
+				tcpServer.Logger.Error(ctx, "TCPAccept:accept failed", logit.Error("error", err))
+				tcpServer.fail(err)
+			}
 			return
 		}
 		tempDelay = 0
 
-		if tcpServer.connPool.Len() >= tcpServer.MaxConnNum {
+		maxConnNum, _ := tcpServer.limits()
+		// 接入控制和读取PROXY头在协程中进行，先占用名额，避免突发连接超过上限
+		if tcpServer.connPool.Len()+int(atomic.LoadInt32(&tcpServer.reserved)) >= maxConnNum {
 			_ = conn.Close()
-			wslog.Logger.Notice(ctx, "TCPAccept:too many connects")
+			tcpServer.reject(tcpServer.IPFilter.Reject(REJECT_MAX_CONN))
+			tcpServer.Logger.Notice(ctx, "TCPAccept:too many connects")
 			continue
 		}
 
-		ssid := utils.NewUUID()
-		netConn := newTCPConn(conn, tcpServer.ChanCap, ssid, tcpServer.tcpParser, tcpServer.connPool)
-		tcpServer.connPool.WithConn(netConn, ssid)
-
-		agent := tcpServer.NewAgent(netConn)
 		// 不能阻塞掉，否则无法接收连接
-		go agent.ReadMsg()
+		atomic.AddInt32(&tcpServer.reserved, 1)
+		go tcpServer.serveConn(ctx, conn)
+	}
+}
+
+// fail 写入FailChan，已有未处理的错误时丢弃
+func (tcpServer *TCPServer) fail(err error) {
+	if tcpServer.FailChan == nil {
+		return
+	}
+	select {
+	case tcpServer.FailChan <- err:
+	default:
+	}
+}
+
+// reject 回调拒绝原因
+func (tcpServer *TCPServer) reject(reason string) {
+	if tcpServer.OnReject != nil {
+		tcpServer.OnReject(reason)
+	}
+}
+
+// serveConn 接入控制并处理连接，开启PROXY protocol时获取地址需要读取PROXY头
+// 加入连接池或被拒绝后释放run中占用的名额
+func (tcpServer *TCPServer) serveConn(ctx context.Context, conn net.Conn) {
+	release, reason := tcpServer.IPFilter.Acquire(AddrIP(conn.RemoteAddr()))
+	if reason != "" {
+		atomic.AddInt32(&tcpServer.reserved, -1)
+		_ = conn.Close()
+		tcpServer.reject(reason)
+		tcpServer.Logger.Notice(ctx, "TCPAccept:connection rejected", logit.String("reason", reason),
+			logit.String("remoteAddr", conn.RemoteAddr().String()))
+		return
+	}
+
+	_, chanCap := tcpServer.limits()
+	ssid := utils.NewUUID()
+	netConn := newTCPConn(conn, chanCap, ssid, tcpServer.tcpParser, tcpServer.connPool, tcpServer.Logger)
+	netConn.Attrs().OnClose(release)
+	tcpServer.connPool.WithConn(netConn, ssid)
+	atomic.AddInt32(&tcpServer.reserved, -1)
+
+	agent := tcpServer.NewAgent(netConn)
+	agent.ReadMsg()
+}
+
+// SetLimits 修改最大连接数和写channel缓冲，只对新连接生效，<=0时不修改
+func (tcpServer *TCPServer) SetLimits(maxConnNum, chanCap int) {
+	tcpServer.mutex.Lock()
+	defer tcpServer.mutex.Unlock()
+	if maxConnNum > 0 {
+		tcpServer.MaxConnNum = maxConnNum
+	}
+	if chanCap > 0 {
+		tcpServer.ChanCap = chanCap
 	}
 }
 
-// Close 关闭
+// limits 当前最大连接数和写channel缓冲
+func (tcpServer *TCPServer) limits() (maxConnNum, chanCap int) {
+	tcpServer.mutex.RLock()
+	defer tcpServer.mutex.RUnlock()
+	return tcpServer.MaxConnNum, tcpServer.ChanCap
+}
+
+// StopAccept 停止接收新连接，已建立的连接不受影响
+func (tcpServer *TCPServer) StopAccept() {
+	atomic.StoreInt32(&tcpServer.closed, 1)
+	_ = tcpServer.ln.Close()
+}
+
+// Conns 当前所有连接
+func (tcpServer *TCPServer) Conns() []*TCPConn {
+	return tcpServer.connPool.GetConns()
+}
+
+// Close 关闭，已写入内核缓冲区的数据继续发送
 func (tcpServer *TCPServer) Close() {
+	atomic.StoreInt32(&tcpServer.closed, 1)
 	_ = tcpServer.ln.Close()
 	for _, conn := range tcpServer.connPool.GetConns() {
-		conn.Close()
+		conn.setCloseReason(CLOSE_SERVER_SHUTDOWN, nil)
+		conn.CloseGracefully()
 	}
 }
@@ -0,0 +1,158 @@
+// Author: Vcentor
+// Date: 2026/10/28 10:00 上午
+// desc: tcp服务的连接数限制、写入错误和accept失败测试
+
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockAgent 不读取数据，直到测试结束
+type blockAgent struct {
+	done chan struct{}
+}
+
+func (a blockAgent) ReadMsg() { <-a.done }
+
+func TestTCPServer_MaxConnBurst(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("127.0.0.0/8")
+	done := make(chan struct{})
+	defer close(done)
+	var rejected int32
+	srv := &TCPServer{
+		Ctx:                context.Background(),
+		ListenAddr:         "127.0.0.1:0",
+		MaxConnNum:         2,
+		ChanCap:            1,
+		NewAgent:           func(*TCPConn) Agent { return blockAgent{done: done} },
+		OnReject:           func(string) { atomic.AddInt32(&rejected, 1) },
+		ProxyProtocol:      true,
+		TrustedProxies:     []*net.IPNet{trusted},
+		ProxyHeaderTimeout: 2 * time.Second,
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// 连接不发送PROXY头，接入控制阻塞在读取PROXY头，此时还没有加入连接池
+	for i := 0; i < 5; i++ {
+		c, err := net.Dial("tcp", srv.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&rejected) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&rejected); got != 3 {
+		t.Errorf("rejected = %d, want 3", got)
+	}
+}
+
+// tcpFloodAgent 持续发送数据直到失败，返回写入错误
+type tcpFloodAgent struct {
+	conn   *TCPConn
+	result chan error
+}
+
+func (a tcpFloodAgent) ReadMsg() {
+	data := make([]byte, 1024)
+	for i := 0; i < 10000; i++ {
+		if err := a.conn.WriteMsg(data); err != nil {
+			a.result <- err
+			a.result <- a.conn.WriteMsg(data)
+			return
+		}
+	}
+	a.result <- nil
+}
+
+func TestTCPConn_WriteError(t *testing.T) {
+	result := make(chan error, 2)
+	srv := &TCPServer{
+		Ctx:        context.Background(),
+		ListenAddr: "127.0.0.1:0",
+		MaxConnNum: 10,
+		ChanCap:    1,
+		LenMsgLen:  2,
+		MaxMsgLen:  4096,
+		NewAgent:   func(c *TCPConn) Agent { return tcpFloodAgent{conn: c, result: result} },
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// 客户端不读取数据，写channel很快被占满，之后的写入返回连接已关闭
+	// 服务端断开很快，连接可能在Dial返回前就被重置
+	if c, err := net.Dial("tcp", srv.LocalAddr().String()); err == nil {
+		defer c.Close()
+	}
+	select {
+	case err := <-result:
+		if err != ErrSlowConsumer {
+			t.Errorf("WriteMsg() error = %v, want %v", err, ErrSlowConsumer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WriteMsg blocked on slow consumer")
+	}
+	if err := <-result; err != ErrConnClosed {
+		t.Errorf("WriteMsg() after close error = %v, want %v", err, ErrConnClosed)
+	}
+}
+
+// failListener accept直接返回错误
+type failListener struct {
+	net.Listener
+}
+
+func (l failListener) Accept() (net.Conn, error) {
+	return nil, errors.New("accept failed")
+}
+
+func TestTCPServer_AcceptFail(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failChan := make(chan error, 1)
+	srv := &TCPServer{
+		Ctx:      context.Background(),
+		Listener: failListener{ln},
+		NewAgent: func(*TCPConn) Agent { return blockAgent{} },
+		FailChan: failChan,
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	select {
+	case err := <-failChan:
+		if err == nil || err.Error() != "accept failed" {
+			t.Errorf("FailChan error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("accept error not reported")
+	}
+
+	// 主动停止accept时不属于失败
+	srv = &TCPServer{Ctx: context.Background(), ListenAddr: "127.0.0.1:0", FailChan: failChan}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	srv.StopAccept()
+	select {
+	case err := <-failChan:
+		t.Errorf("StopAccept() reported %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
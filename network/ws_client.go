@@ -5,159 +5,380 @@ package network
 
 import (
 	"context"
-	"socketserver/library/wslog"
+	"crypto/tls"
 	"errors"
-	"github.com/gorilla/websocket"
-	"icode.baidu.com/baidu/gdp/logit"
+	"net/http"
+	"net/url"
+	"socketserver/library/trace"
 	"sync"
 	"time"
+
+	"github.com/gorilla/websocket"
+	"icode.baidu.com/baidu/gdp/logit"
 )
 
+// ErrWSClientClosed 连接已关闭
+var ErrWSClientClosed = errors.New("WSClient channel is closed")
+
+// WSClientState 连接状态
+type WSClientState int
+
 const (
-	RECONNECT_SLEEP_DURATION = 50
+	WS_CLIENT_CONNECTING WSClientState = iota // 正在建连，每次尝试都会通知
+	WS_CLIENT_CONNECTED                       // 建连成功
+	WS_CLIENT_LOST                            // 连接异常断开
+	WS_CLIENT_CLOSED                          // 调用Close关闭
 )
 
+// String 状态名称
+func (s WSClientState) String() string {
+	switch s {
+	case WS_CLIENT_CONNECTING:
+		return "connecting"
+	case WS_CLIENT_CONNECTED:
+		return "connected"
+	case WS_CLIENT_LOST:
+		return "lost"
+	case WS_CLIENT_CLOSED:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// WSDialOption websocket client建连选项
+type WSDialOption struct {
+	Addr              string
+	Header            http.Header                           // 握手请求头，重连时复用
+	Token             string                                // 不为空时通过Authorization: Bearer请求头鉴权
+	TLSConfig         *tls.Config                           // wss使用的TLS配置
+	Proxy             func(*http.Request) (*url.URL, error) // 为空时使用环境变量中的代理
+	HandshakeTimeout  time.Duration                         // 握手超时，默认10s
+	ReadBufferSize    int
+	WriteBufferSize   int
+	EnableCompression bool
+	ChanCap           int     // 读写channel缓冲，默认100
+	Retry             int     // DialWS的尝试次数，默认1
+	MaxReconnect      int     // ReConnect的尝试次数，<=0时直到成功或ctx取消
+	AutoReconnect     bool    // 连接异常断开后在后台自动ReConnect，Close后停止
+	Backoff           Backoff // 重试间隔
+	// OnStateChange 状态变化回调，在发生变化的协程中同步执行，不能阻塞，err为建连失败或断开的原因
+	OnStateChange func(state WSClientState, err error)
+	Logger        logit.Logger // 为空时使用wslog.Logger
+}
+
+// stateListener 状态订阅
+type stateListener struct {
+	fn func(WSClientState, error)
+}
+
 // WSClient websocket client
 type WSClient struct {
-	addr      string
-	chanCap   int
+	opt       WSDialOption
+	logger    logit.Logger
+	dialer    *websocket.Dialer
+	header    http.Header // 握手请求头，含追踪上下文和鉴权，重连时复用
+	ctx       context.Context
+	cancel    context.CancelFunc // Close时取消，结束自动重连
 	conn      *websocket.Conn
 	readChan  chan readChan
 	writeChan chan WriteChan
 	closeFlag bool
+	closed    bool // 调用了Close
 	closeChan chan byte
+	state     WSClientState
+	listeners []*stateListener
 	mutex     sync.Mutex
 }
 
-// NewWSClient 初始化websocket client
+// NewWSClient 初始化websocket client，失败时返回nil，新代码使用DialWS
 func NewWSClient(addr string, chanCap, retry int) *WSClient {
-	var (
-		conn *websocket.Conn
-		err  error
-	)
-	for i := 0; i < retry; i++ {
-		conn, _, err = websocket.DefaultDialer.Dial(addr, nil)
-		if err != nil {
-			time.Sleep(10 * time.Millisecond)
-			continue
+	return NewWSClientContext(context.Background(), addr, chanCap, retry)
+}
+
+// NewWSClientContext 同NewWSClient，ctx携带追踪上下文，失败时返回nil，新代码使用DialWS
+func NewWSClientContext(ctx context.Context, addr string, chanCap, retry int) *WSClient {
+	wc, err := DialWS(ctx, WSDialOption{Addr: addr, ChanCap: chanCap, Retry: retry})
+	if err != nil {
+		return nil
+	}
+	return wc
+}
+
+// DialWS 建立websocket连接，按Retry和Backoff重试
+// ctx携带追踪上下文时记录建连span并通过traceparent握手请求头传给上游，在handler中调用时传入Session.Context()
+func DialWS(ctx context.Context, opt WSDialOption) (*WSClient, error) {
+	if opt.Addr == "" {
+		return nil, errors.New("WSClient addr is required")
+	}
+	if opt.ChanCap <= 0 {
+		opt.ChanCap = 100
+	}
+	if opt.HandshakeTimeout <= 0 {
+		opt.HandshakeTimeout = 10 * time.Second
+	}
+	if opt.Proxy == nil {
+		opt.Proxy = http.ProxyFromEnvironment
+	}
+	retry := opt.Retry
+	if retry <= 0 {
+		retry = 1
+	}
+
+	header := make(http.Header)
+	for k, v := range opt.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	if opt.Token != "" {
+		header.Set("Authorization", "Bearer "+opt.Token)
+	}
+	ctx, span := trace.Start(ctx, "WS connect")
+	span.SetAttr("ws.url", opt.Addr)
+	defer span.End()
+	trace.Inject(ctx, header)
+
+	wc := &WSClient{
+		opt:    opt,
+		logger: defaultLogger(opt.Logger),
+		header: header,
+		dialer: &websocket.Dialer{
+			Proxy:             opt.Proxy,
+			TLSClientConfig:   opt.TLSConfig,
+			HandshakeTimeout:  opt.HandshakeTimeout,
+			ReadBufferSize:    opt.ReadBufferSize,
+			WriteBufferSize:   opt.WriteBufferSize,
+			EnableCompression: opt.EnableCompression,
+		},
+	}
+	if opt.OnStateChange != nil {
+		wc.listeners = append(wc.listeners, &stateListener{fn: opt.OnStateChange})
+	}
+	wc.ctx, wc.cancel = context.WithCancel(context.Background())
+	conn, err := wc.dialRetry(ctx, retry)
+	if err != nil {
+		wc.cancel()
+		span.SetError(err)
+		wc.logger.Error(ctx, "WSClient connect fail", logit.String("addr", opt.Addr), logit.Error("error", err))
+		return nil, err
+	}
+	wc.start(conn)
+	return wc, nil
+}
+
+// dialRetry 按退避间隔重试，retry<=0时直到成功或ctx取消
+func (wc *WSClient) dialRetry(ctx context.Context, retry int) (*websocket.Conn, error) {
+	var err error
+	for i := 0; retry <= 0 || i < retry; i++ {
+		if i > 0 && !sleepContext(ctx, wc.opt.Backoff.Duration(i-1)) {
+			return nil, ctx.Err()
+		}
+		if !wc.setState(WS_CLIENT_CONNECTING, nil) {
+			return nil, ErrWSClientClosed
 		}
-		break
+		var conn *websocket.Conn
+		if conn, _, err = wc.dialer.DialContext(ctx, wc.opt.Addr, wc.header); err == nil {
+			return conn, nil
+		}
+		wc.logger.Warning(ctx, "WSClient dial fail", logit.String("addr", wc.opt.Addr),
+			logit.Int("attempt", i+1), logit.Error("error", err))
 	}
-	if conn == nil {
-		wslog.Logger.Fatal(context.Background(), "WSClient connect fail", logit.String("addr", addr), logit.Error("error", err))
-		return nil
+	wc.setState(WS_CLIENT_LOST, err)
+	return nil, err
+}
+
+// setState 更新状态并通知订阅者，已Close时返回false
+func (wc *WSClient) setState(state WSClientState, err error) bool {
+	wc.mutex.Lock()
+	if wc.closed && state != WS_CLIENT_CLOSED {
+		wc.mutex.Unlock()
+		return false
+	}
+	wc.state = state
+	listeners := append([]*stateListener(nil), wc.listeners...)
+	wc.mutex.Unlock()
+	for _, l := range listeners {
+		l.fn(state, err)
+	}
+	return true
+}
+
+// State 当前状态
+func (wc *WSClient) State() WSClientState {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	return wc.state
+}
+
+// OnStateChange 订阅状态变化，回调要求同WSDialOption.OnStateChange，返回的函数用于取消订阅
+func (wc *WSClient) OnStateChange(fn func(state WSClientState, err error)) func() {
+	l := &stateListener{fn: fn}
+	wc.mutex.Lock()
+	wc.listeners = append(wc.listeners, l)
+	wc.mutex.Unlock()
+	return func() {
+		wc.mutex.Lock()
+		defer wc.mutex.Unlock()
+		for i, item := range wc.listeners {
+			if item == l {
+				wc.listeners = append(wc.listeners[:i:i], wc.listeners[i+1:]...)
+				return
+			}
+		}
 	}
+}
 
-	wsClient := &WSClient{
-		addr:      addr,
-		chanCap:   chanCap,
-		conn:      conn,
-		readChan:  make(chan readChan, chanCap),
-		writeChan: make(chan WriteChan, chanCap),
-		closeFlag: false,
-		closeChan: make(chan byte, 1),
+// start 使用新连接，启动读写协程，已Close或并发重连已成功时关闭conn
+func (wc *WSClient) start(conn *websocket.Conn) {
+	wc.mutex.Lock()
+	if wc.closed || (wc.conn != nil && !wc.closeFlag) {
+		wc.mutex.Unlock()
+		conn.Close()
+		return
 	}
-	go wsClient.readLoop()
-	go wsClient.writeLoop()
-	return wsClient
+	wc.conn = conn
+	wc.closeFlag = false
+	wc.closeChan = make(chan byte, 1)
+	wc.readChan = make(chan readChan, wc.opt.ChanCap)
+	wc.writeChan = make(chan WriteChan, wc.opt.ChanCap)
+	go wc.readLoop(conn, wc.readChan, wc.closeChan)
+	go wc.writeLoop(conn, wc.writeChan, wc.closeChan)
+	wc.mutex.Unlock()
+	wc.setState(WS_CLIENT_CONNECTED, nil)
 }
 
-// ReadMsg 读取数据
+// chans 当前连接的读写channel
+func (wc *WSClient) chans() (chan readChan, chan WriteChan, chan byte) {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	return wc.readChan, wc.writeChan, wc.closeChan
+}
+
+// ReadMsg 读取数据，连接断开前已收到的消息读完后返回错误
 func (wc *WSClient) ReadMsg() (data []byte, messageType int, err error) {
+	reads, _, closeChan := wc.chans()
 	select {
-	case rc := <-wc.readChan:
-		data = rc.message
-		messageType = rc.messageType
-	case <-wc.closeChan:
-		err = errors.New("WSClient channel is closed")
+	case rc := <-reads:
+		return rc.message, rc.messageType, nil
+	case <-closeChan:
+	}
+	select {
+	case rc := <-reads:
+		return rc.message, rc.messageType, nil
+	default:
+		return nil, 0, ErrWSClientClosed
 	}
-	return
 }
 
 // readLoop	读取数据
-func (wc *WSClient) readLoop() {
+func (wc *WSClient) readLoop(conn *websocket.Conn, reads chan readChan, closeChan chan byte) {
 	for {
-		messageType, data, err := wc.conn.ReadMessage()
+		messageType, data, err := conn.ReadMessage()
 		if err != nil {
-			wslog.Logger.Notice(context.Background(), "WSClient read message failed", logit.Error("error", err))
-			goto CLOSE
-		}
-		var rc = readChan{
-			message:     data,
-			messageType: messageType,
+			wc.logger.Notice(context.Background(), "WSClient read message failed", logit.Error("error", err))
+			wc.lost(conn, err)
+			return
 		}
 		select {
-		case wc.readChan <- rc:
-		case <-wc.closeChan:
-			goto CLOSE
+		case reads <- readChan{message: data, messageType: messageType}:
+		case <-closeChan:
+			return
 		}
 	}
-CLOSE:
-	wc.Close()
 }
 
 // WriteMsg 发送websocket信息
 func (wc *WSClient) WriteMsg(data WriteChan) (err error) {
+	_, writeChan, closeChan := wc.chans()
 	select {
-	case wc.writeChan <- data:
-	case <-wc.closeChan:
-		err = errors.New("WSClient channel is closed")
+	case writeChan <- data:
+	case <-closeChan:
+		err = ErrWSClientClosed
 	}
 	return
 }
 
 // writeLoop 发送websocket信息
-func (wc *WSClient) writeLoop() {
-	var data WriteChan
+func (wc *WSClient) writeLoop(conn *websocket.Conn, writeChan chan WriteChan, closeChan chan byte) {
 	for {
 		select {
-		case data = <-wc.writeChan:
-			if err := wc.conn.WriteMessage(data.Type, data.Message); err != nil {
-				goto CLOSE
+		case data := <-writeChan:
+			if err := conn.WriteMessage(data.Type, data.Message); err != nil {
+				wc.lost(conn, err)
+				return
 			}
-
-		case <-wc.closeChan:
-			goto CLOSE
+		case <-closeChan:
+			return
 		}
 	}
-CLOSE:
-	wc.Close()
 }
 
-// Close 关闭连接
+// closeConn 关闭conn，已经重连时不影响新连接，返回是否由本次调用关闭
+func (wc *WSClient) closeConn(conn *websocket.Conn) bool {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	if wc.conn != conn || wc.closeFlag {
+		return false
+	}
+	wc.conn.Close()
+	close(wc.closeChan)
+	wc.closeFlag = true
+	return true
+}
+
+// lost 连接异常断开，开启AutoReconnect时后台重连
+func (wc *WSClient) lost(conn *websocket.Conn, err error) {
+	if !wc.closeConn(conn) || !wc.setState(WS_CLIENT_LOST, err) {
+		return
+	}
+	if wc.opt.AutoReconnect {
+		go func() { _ = wc.ReConnect(wc.ctx) }()
+	}
+}
+
+// Close 关闭连接，停止自动重连
 func (wc *WSClient) Close() {
-	if !wc.closeFlag {
-		wc.mutex.Lock()
-		if !wc.closeFlag {
-			wc.conn.Close()
-			close(wc.closeChan)
-			wc.closeFlag = true
-		}
+	wc.mutex.Lock()
+	if wc.closed {
 		wc.mutex.Unlock()
+		return
 	}
+	wc.closed = true
+	conn := wc.conn
+	wc.mutex.Unlock()
+	wc.cancel()
+	wc.closeConn(conn)
+	wc.setState(WS_CLIENT_CLOSED, nil)
 }
 
-// ReConnect 断线重连
-func (wc *WSClient) ReConnect() {
+// ReConnect 连接断开后按MaxReconnect和Backoff重连，未断开时直接返回
+// 重连期间不持有锁，不阻塞读写和Close，Close后返回ErrWSClientClosed
+func (wc *WSClient) ReConnect(ctx context.Context) error {
 	wc.mutex.Lock()
-	if wc.closeFlag {
-	reconnect:
-		conn, _, err := websocket.DefaultDialer.Dial(wc.addr, nil)
-		if err != nil {
-			wslog.Logger.Fatal(context.Background(), "WSClient reconnect fail", logit.String("addr", wc.addr), logit.Error("error", err))
-			time.Sleep(RECONNECT_SLEEP_DURATION * time.Millisecond)
-			goto reconnect
+	closed, closeFlag := wc.closed, wc.closeFlag
+	wc.mutex.Unlock()
+	if closed {
+		return ErrWSClientClosed
+	}
+	if !closeFlag {
+		return nil
+	}
+	// Close时同时停止重连
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-wc.ctx.Done():
+			cancel()
+		case <-ctx.Done():
 		}
-		wc.conn = conn
-		wc.closeFlag = false
-		wc.closeChan = make(chan byte, 1)
-		wc.readChan = make(chan readChan, wc.chanCap)
-		wc.writeChan = make(chan WriteChan, wc.chanCap)
-		go wc.readLoop()
-		go wc.writeLoop()
-		wslog.Logger.Debug(context.Background(), "reconnect success")
+	}()
+	conn, err := wc.dialRetry(ctx, wc.opt.MaxReconnect)
+	if err != nil {
+		wc.logger.Error(ctx, "WSClient reconnect fail", logit.String("addr", wc.opt.Addr), logit.Error("error", err))
+		return err
 	}
-	wc.mutex.Unlock()
+	wc.start(conn)
+	wc.logger.Debug(ctx, "WSClient reconnect success", logit.String("addr", wc.opt.Addr))
+	return nil
 }
 
 // GetCloseFlag 获取closeFlag
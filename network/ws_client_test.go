@@ -0,0 +1,153 @@
+// Author: Vcentor
+// Date: 2026/10/27 6:30 下午
+// desc: websocket client建连、重连和状态通知测试
+
+package network
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stateRecorder 记录状态变化
+type stateRecorder struct {
+	mutex  sync.Mutex
+	states []string
+	notify chan WSClientState
+}
+
+func newStateRecorder() *stateRecorder {
+	return &stateRecorder{notify: make(chan WSClientState, 100)}
+}
+
+func (r *stateRecorder) record(state WSClientState, _ error) {
+	r.mutex.Lock()
+	r.states = append(r.states, state.String())
+	r.mutex.Unlock()
+	r.notify <- state
+}
+
+// wait 等待指定状态
+func (r *stateRecorder) wait(t *testing.T, state WSClientState) {
+	timer := time.NewTimer(2 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case s := <-r.notify:
+			if s == state {
+				return
+			}
+		case <-timer.C:
+			t.Fatalf("state %s not reached, got %v", state, r.list())
+		}
+	}
+}
+
+func (r *stateRecorder) list() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return strings.Join(r.states, ",")
+}
+
+func TestWSClient(t *testing.T) {
+	var (
+		upgrader websocket.Upgrader
+		mutex    sync.Mutex
+		auths    []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		auths = append(auths, r.Header.Get("Authorization")+" "+r.Header.Get("X-Client"))
+		mutex.Unlock()
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			typ, data, err := c.ReadMessage()
+			if err != nil || string(data) == "bye" {
+				return
+			}
+			if err := c.WriteMessage(typ, data); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	addr := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	rec := newStateRecorder()
+	wc, err := DialWS(context.Background(), WSDialOption{
+		Addr:             addr,
+		Header:           http.Header{"X-Client": []string{"test"}},
+		Token:            "secret",
+		HandshakeTimeout: time.Second,
+		AutoReconnect:    true,
+		Backoff:          Backoff{Min: time.Millisecond, Max: 10 * time.Millisecond},
+		OnStateChange:    rec.record,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := func() {
+		if err := wc.WriteMsg(WriteChan{Type: websocket.TextMessage, Message: []byte("hello")}); err != nil {
+			t.Fatal(err)
+		}
+		if data, _, err := wc.ReadMsg(); err != nil || string(data) != "hello" {
+			t.Fatalf("ReadMsg() = %q, %v", data, err)
+		}
+	}
+	echo()
+
+	// 服务端断开后自动重连，握手请求头不变
+	_ = wc.WriteMsg(WriteChan{Type: websocket.TextMessage, Message: []byte("bye")})
+	rec.wait(t, WS_CLIENT_LOST)
+	rec.wait(t, WS_CLIENT_CONNECTED)
+	echo()
+	wc.Close()
+	rec.wait(t, WS_CLIENT_CLOSED)
+
+	if got, want := rec.list(), "connecting,connected,lost,connecting,connected,closed"; got != want {
+		t.Errorf("states = %s, want %s", got, want)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, a := range auths {
+		if a != "Bearer secret test" {
+			t.Errorf("handshake header = %q", a)
+		}
+	}
+	if err := wc.ReConnect(context.Background()); err != ErrWSClientClosed {
+		t.Errorf("ReConnect() after Close error = %v", err)
+	}
+}
+
+func TestWSClient_DialFail(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	addr := "ws" + strings.TrimPrefix(srv.URL, "http")
+	srv.Close()
+
+	rec := newStateRecorder()
+	if _, err := DialWS(context.Background(), WSDialOption{
+		Addr:          addr,
+		Retry:         3,
+		Backoff:       Backoff{Min: time.Millisecond},
+		OnStateChange: rec.record,
+	}); err == nil {
+		t.Fatal("DialWS() error = nil")
+	}
+	if got, want := rec.list(), "connecting,connecting,connecting,lost"; got != want {
+		t.Errorf("states = %s, want %s", got, want)
+	}
+	if wc := NewWSClient(addr, 1, 1); wc != nil {
+		t.Error("NewWSClient() != nil")
+	}
+}
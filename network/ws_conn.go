@@ -5,12 +5,14 @@ package network
 
 import (
 	"context"
-	"socketserver/library/wslog"
 	"errors"
 	"github.com/gorilla/websocket"
 	"icode.baidu.com/baidu/gdp/logit"
+	"io"
 	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -35,28 +37,33 @@ type WriteChan struct {
 // WSConn websocket connection
 // read message and write message
 type WSConn struct {
-	conn      *websocket.Conn
-	writeChan chan []byte
-	readChan  chan readChan
-	closeChan chan byte
-	closeFlag bool
-	mutex     sync.Mutex
-	handler   *WSHandler
-	sessionID string
-	authInfo  map[string]bool
+	closeReason
+	conn       *websocket.Conn
+	writeChan  chan writeReq
+	readChan   chan readChan
+	closeChan  chan byte
+	closeFlag  bool
+	mutex      sync.Mutex
+	handler    *WSHandler
+	sessionID  string
+	request    *http.Request
+	remoteAddr net.Addr // 经可信代理转发时的真实客户端地址
+	attrs      *Attrs
+	pending    int64 // 写入channel但未写入连接的消息数
 }
 
 // newWSConn 初始化WSConn
-func newWSConn(conn *websocket.Conn, handler *WSHandler, chanCap int, ssid string) *WSConn {
+func newWSConn(conn *websocket.Conn, r *http.Request, handler *WSHandler, chanCap int, ssid string) *WSConn {
 	var wsConn = &WSConn{
 		conn:      conn,
-		writeChan: make(chan []byte, chanCap),
+		writeChan: make(chan writeReq, chanCap),
 		readChan:  make(chan readChan, chanCap),
 		closeChan: make(chan byte, 1),
 		closeFlag: false,
 		handler:   handler,
 		sessionID: ssid,
-		authInfo:  make(map[string]bool),
+		request:   r,
+		attrs:     NewAttrs(),
 	}
 
 	go wsConn.readLoop()
@@ -71,6 +78,7 @@ func (wsConn *WSConn) ReadMsg() (data []byte, messageType int, err error) {
 		messageType = rc.messageType
 	case <-time.After(HEARTBEAT_TIMEOUT * time.Second):
 		wsConn.WriteMsg([]byte(`read timeout connect closed`))
+		wsConn.setCloseReason(CLOSE_HEARTBEAT_TIMEOUT, nil)
 		err = errors.New("heartbeat timeout, connection is closed")
 	case <-wsConn.closeChan:
 		err = errors.New("connection is closed")
@@ -83,7 +91,13 @@ func (wsConn *WSConn) readLoop() {
 	for {
 		messageType, data, err := wsConn.conn.ReadMessage()
 		if err != nil {
-			wslog.Logger.Notice(context.Background(), "WSConn read message failed", logit.Error("error", err))
+			wsConn.handler.logger.Notice(wsConn.handler.ctx, "WSConn read message failed", logit.String("sessionId", wsConn.GetSessionID()),
+				logit.Error("error", err))
+			if _, ok := err.(*websocket.CloseError); ok || err == io.EOF || err == io.ErrUnexpectedEOF {
+				wsConn.setCloseReason(CLOSE_CLIENT, nil)
+			} else {
+				wsConn.setCloseReason(CLOSE_READ_ERROR, err)
+			}
 			goto CLOSE
 		}
 		var rc = readChan{
@@ -100,26 +114,48 @@ CLOSE:
 	wsConn.Close()
 }
 
-// WriteMsg 发送数据
+// WriteMsg 发送数据，不阻塞调用方；写channel满时说明客户端消费过慢，断开连接
 func (wsConn *WSConn) WriteMsg(b []byte) (err error) {
+	atomic.AddInt64(&wsConn.pending, 1)
 	select {
-	case wsConn.writeChan <- b:
 	case <-wsConn.closeChan:
-		err = errors.New("channel is closed")
+		atomic.AddInt64(&wsConn.pending, -1)
+		return ErrConnClosed
+	default:
 	}
-	return
+	select {
+	case wsConn.writeChan <- writeReq{data: b}:
+		return nil
+	default:
+	}
+	atomic.AddInt64(&wsConn.pending, -1)
+	wsConn.handler.logger.Warning(wsConn.handler.ctx, "close ws conn: channel full",
+		logit.String("sessionId", wsConn.GetSessionID()), logit.String("remoteAddr", wsConn.RemoteAddr().String()))
+	wsConn.CloseWithReason(CLOSE_SLOW_CONSUMER, nil)
+	return ErrSlowConsumer
+}
+
+// WriteMsgContext 发送数据，写channel满时等待，消息写入连接后返回
+// 用于离线补发、下线通知等服务端主动下发的场景，ctx取消或连接关闭时返回错误
+func (wsConn *WSConn) WriteMsgContext(ctx context.Context, b []byte) error {
+	return writeWait(ctx, wsConn.writeChan, wsConn.closeChan, &wsConn.pending, b)
 }
 
 func (wsConn *WSConn) writeLoop() {
-	var data []byte
+	var req writeReq
 	for {
 		select {
-		case data = <-wsConn.writeChan:
+		case req = <-wsConn.writeChan:
 		case <-wsConn.closeChan:
 			goto CLOSE
 		}
-		if err := wsConn.conn.WriteMessage(websocket.TextMessage, data); err != nil {
-			wslog.Logger.Notice(context.Background(), "WSConn write text message failed", logit.String("data", string(data)), logit.Error("error", err))
+		err := wsConn.conn.WriteMessage(websocket.TextMessage, req.data)
+		atomic.AddInt64(&wsConn.pending, -1)
+		req.finish(err)
+		if err != nil {
+			wsConn.handler.logger.Warning(wsConn.handler.ctx, "WSConn write text message failed", logit.String("sessionId", wsConn.GetSessionID()),
+				logit.String("data", string(req.data)), logit.Error("error", err))
+			wsConn.setCloseReason(CLOSE_WRITE_ERROR, err)
 			goto CLOSE
 		}
 	}
@@ -127,21 +163,29 @@ CLOSE:
 	wsConn.Close()
 }
 
+// Close 关闭连接
 func (wsConn *WSConn) Close() {
-	if !wsConn.closeFlag {
-		// 线程安全的，可重复调用
-		wsConn.conn.Close()
-		// channel只能关闭一次，且非线程安全
-		wsConn.handler.mutex.Lock()
-		if !wsConn.closeFlag {
-			// 删除鉴权信息,释放内存
-			wsConn.DelAuthInfo(wsConn.handler.conns[wsConn])
-			// 删除连接池，释放内存
-			delete(wsConn.handler.conns, wsConn)
-			close(wsConn.closeChan)
-			wsConn.closeFlag = true
-		}
-		wsConn.handler.mutex.Unlock()
+	wsConn.CloseWithReason(CLOSE_SERVER, nil)
+}
+
+// CloseWithReason 关闭连接并记录原因，已有原因时不覆盖
+func (wsConn *WSConn) CloseWithReason(reason string, err error) {
+	wsConn.setCloseReason(reason, err)
+	// 线程安全的，可重复调用
+	wsConn.conn.Close()
+	// channel只能关闭一次，且非线程安全，closeFlag只在锁内读写
+	wsConn.handler.mutex.Lock()
+	closed := wsConn.closeFlag
+	if !closed {
+		// 删除连接池，释放内存
+		delete(wsConn.handler.conns, wsConn)
+		close(wsConn.closeChan)
+		wsConn.closeFlag = true
+	}
+	wsConn.handler.mutex.Unlock()
+	// 清理函数可能会访问连接池，放在锁外执行
+	if !closed {
+		wsConn.attrs.close()
 	}
 }
 
@@ -150,8 +194,11 @@ func (wsConn *WSConn) LocalAddr() net.Addr {
 	return wsConn.conn.LocalAddr()
 }
 
-// RemoteAddr 远程地址
+// RemoteAddr 远程地址，经可信代理转发时为真实客户端地址
 func (wsConn *WSConn) RemoteAddr() net.Addr {
+	if wsConn.remoteAddr != nil {
+		return wsConn.remoteAddr
+	}
 	return wsConn.conn.RemoteAddr()
 }
 
@@ -181,32 +228,22 @@ func (wsConn *WSConn) GetCloseFlag() bool {
 	return wsConn.closeFlag
 }
 
-// GetSessionID 获取session id
-func (wsConn *WSConn) GetSessionID() string {
-	return wsConn.sessionID
+// PendingWrites 待发送的消息数
+func (wsConn *WSConn) PendingWrites() int {
+	return int(atomic.LoadInt64(&wsConn.pending))
 }
 
-// SetAuthInfo 设置鉴权信息
-func (wsConn *WSConn) SetAuthInfo(sid string) {
-	wsConn.mutex.Lock()
-	wsConn.authInfo[sid] = true
-	wsConn.mutex.Unlock()
+// Request 握手请求，可用于读取握手时携带的参数和header
+func (wsConn *WSConn) Request() *http.Request {
+	return wsConn.request
 }
 
-// 删除鉴权信息
-func (wsConn *WSConn) DelAuthInfo(sid string) {
-	wsConn.mutex.Lock()
-	delete(wsConn.authInfo, sid)
-	wsConn.mutex.Unlock()
+// Attrs 会话属性
+func (wsConn *WSConn) Attrs() *Attrs {
+	return wsConn.attrs
 }
 
-// Auth 鉴权
-func (wsConn *WSConn) Auth(sid string) bool {
-	var res bool
-	wsConn.mutex.Lock()
-	if _, ok := wsConn.authInfo[sid]; ok {
-		res = true
-	}
-	wsConn.mutex.Unlock()
-	return res
+// GetSessionID 获取session id
+func (wsConn *WSConn) GetSessionID() string {
+	return wsConn.sessionID
 }
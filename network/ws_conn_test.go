@@ -0,0 +1,115 @@
+// Author: Vcentor
+// Date: 2026/10/28 2:30 下午
+// desc: websocket连接的慢消费断开和等待写入测试
+
+package network
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// floodAgent 持续发送数据直到失败，返回关闭原因
+type floodAgent struct {
+	conn   *WSConn
+	result chan string
+}
+
+func (a floodAgent) ReadMsg() {
+	data := make([]byte, 64*1024)
+	for i := 0; i < 10000; i++ {
+		if err := a.conn.WriteMsg(data); err != nil {
+			reason, _ := a.conn.CloseReason()
+			a.result <- reason
+			return
+		}
+	}
+	a.result <- ""
+}
+
+func TestWSConn_SlowConsumer(t *testing.T) {
+	result := make(chan string, 1)
+	srv := &WSServer{
+		Ctx:         context.Background(),
+		Addr:        "127.0.0.1:0",
+		MaxConnNum:  10,
+		WriteMsgCap: 1,
+		HTTPTimeout: time.Second,
+		NewAgent:    func(c *WSConn) Agent { return floodAgent{conn: c, result: result} },
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// 客户端不读取数据，写channel很快被占满
+	c, _, err := websocket.DefaultDialer.Dial("ws://"+srv.LocalAddr().String()+WS_PATH, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	select {
+	case reason := <-result:
+		if reason != CLOSE_SLOW_CONSUMER {
+			t.Errorf("close reason = %q, want %s", reason, CLOSE_SLOW_CONSUMER)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WriteMsg blocked on slow consumer")
+	}
+}
+
+// burstAgent 阻塞发送超过写channel容量的消息，返回第一个错误
+type burstAgent struct {
+	conn   *WSConn
+	n      int
+	result chan error
+}
+
+func (a burstAgent) ReadMsg() {
+	for i := 0; i < a.n; i++ {
+		if err := a.conn.WriteMsgContext(context.Background(), []byte(strconv.Itoa(i))); err != nil {
+			a.result <- err
+			return
+		}
+	}
+	a.result <- nil
+}
+
+func TestWSConn_WriteMsgContext(t *testing.T) {
+	const n = 200
+	result := make(chan error, 1)
+	srv := &WSServer{
+		Ctx:         context.Background(),
+		Addr:        "127.0.0.1:0",
+		MaxConnNum:  10,
+		WriteMsgCap: 1,
+		HTTPTimeout: time.Second,
+		NewAgent:    func(c *WSConn) Agent { return burstAgent{conn: c, n: n, result: result} },
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// 客户端晚于服务端开始读取，写channel满时服务端等待而不是断开连接
+	c, _, err := websocket.DefaultDialer.Dial("ws://"+srv.LocalAddr().String()+WS_PATH, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	time.Sleep(100 * time.Millisecond)
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < n; i++ {
+		_, data, err := c.ReadMessage()
+		if err != nil || string(data) != strconv.Itoa(i) {
+			t.Fatalf("ReadMessage() %d = %q, %v", i, data, err)
+		}
+	}
+	if err := <-result; err != nil {
+		t.Errorf("WriteMsgContext() error = %v", err)
+	}
+}
@@ -6,18 +6,21 @@ package network
 import (
 	"context"
 	"crypto/tls"
-	"socketserver/library/utils"
-	"socketserver/library/wslog"
 	"icode.baidu.com/baidu/gdp/logit"
 	"log"
 	"net"
 	"net/http"
+	"socketserver/library/utils"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// WS_PATH websocket连接路径
+const WS_PATH = "/digitalhuman-ws"
+
 // WSServer websocket server run
 type WSServer struct {
 	Ctx         context.Context
@@ -30,39 +33,83 @@ type WSServer struct {
 	KeyFile     string
 	NewAgent    func(*WSConn) Agent
 	FailChan    chan error
+	IPFilter    *IPFilter           // 接入控制，为空时只限制最大连接数
+	Listener    net.Listener        // 已创建的listener，为空时监听Addr
+	Logger      logit.Logger        // 为空时使用wslog.Logger
+	Handler     http.Handler        // 处理websocket路径之外的http请求，为空时返回404
+	OnReject    func(reason string) // 拒绝连接时回调，用于统计
 	handler     *WSHandler
-	ln          net.Listener
+
+	// PROXY protocol和X-Forwarded-For，只信任来自可信网段的地址
+	ProxyProtocol      bool
+	ForwardedHeader    bool
+	TrustedProxies     []*net.IPNet
+	ProxyHeaderTimeout time.Duration
+	ln                 net.Listener
+	certificate        atomic.Value // *tls.Certificate，支持运行时替换证书
 	// ReadMaxMsgLen uint32
 }
 
 // WSHandler handle tcp to websocket
 type WSHandler struct {
 	ctx         context.Context
+	logger      logit.Logger
 	maxConnNum  int
 	writeMsgCap int
 	upgrader    websocket.Upgrader
 	conns       WSConnPool
 	mutex       sync.Mutex
 	newAgent    func(*WSConn) Agent
+	ipFilter    *IPFilter
+	handler     http.Handler
+	onReject    func(reason string)
+	rejectWS    int32 // 为1时拒绝新的websocket握手，其它http请求照常处理
+	// 可信代理转发时从header中获取真实客户端地址
+	forwardedHeader bool
+	trustedProxies  []*net.IPNet
 	//wg          sync.WaitGroup
 	//ReadMaxMsgLen uint32
 }
 
 func (handler *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != WS_PATH {
+		if handler.handler != nil {
+			handler.handler.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, "404 NOT FOUND", 404)
+		return
+	}
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowd", 405)
 		return
 	}
-	if r.URL.Path != "/digitalhuman-ws" {
-		http.Error(w, "404 NOT FOUND", 404)
+	if atomic.LoadInt32(&handler.rejectWS) == 1 {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	// 接入控制，在升级协议和分配连接之前执行
+	remoteIP := AddrIP(r.RemoteAddr)
+	if handler.forwardedHeader {
+		remoteIP = ForwardedIP(remoteIP, r.Header, handler.trustedProxies)
+	}
+	release, reason := handler.ipFilter.Acquire(remoteIP)
+	if reason != "" {
+		handler.reject(reason)
+		handler.logger.Notice(handler.ctx, "Connection rejected", logit.String("reason", reason),
+			logit.String("remoteAddr", r.RemoteAddr))
+		http.Error(w, "Connection rejected", http.StatusForbidden)
 		return
 	}
 
 	// 升级为websocket协议
 	conn, err := handler.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		wslog.Logger.Fatal(handler.ctx, "Upgrader error", logit.Error("error", err))
-		http.Error(w, "Upgrade websocket failed!", 500)
+		release()
+		// Upgrade失败时已经返回了错误响应
+		handler.logger.Warning(handler.ctx, "Upgrader error", logit.String("remoteAddr", r.RemoteAddr),
+			logit.Error("error", err))
 		return
 	}
 
@@ -76,31 +123,49 @@ func (handler *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if handler.conns == nil {
 		handler.mutex.Unlock()
 		conn.Close()
+		release()
 		return
 	}
 	if len(handler.conns) >= handler.maxConnNum {
 		handler.mutex.Unlock()
 		conn.Close()
-		wslog.Logger.Fatal(handler.ctx, "Too many connections!")
+		release()
+		handler.reject(handler.ipFilter.Reject(REJECT_MAX_CONN))
+		handler.logger.Warning(handler.ctx, "Too many connections!", logit.String("remoteAddr", r.RemoteAddr))
 		return
 	}
 	// 链接相关操作
 	ssid := utils.NewUUID()
-	wsConn := newWSConn(conn, handler, handler.writeMsgCap, ssid)
+	wsConn := newWSConn(conn, r, handler, handler.writeMsgCap, ssid)
+	if peer := AddrIP(r.RemoteAddr); remoteIP != nil && !remoteIP.Equal(peer) {
+		wsConn.remoteAddr = &net.TCPAddr{IP: remoteIP}
+	}
+	wsConn.Attrs().OnClose(release)
 	handler.conns[wsConn] = ssid
 	handler.mutex.Unlock()
 	agent := handler.newAgent(wsConn)
 	agent.ReadMsg()
 }
 
-// Start 启动服务
-func (server *WSServer) Start() {
+// reject 回调拒绝原因
+func (handler *WSHandler) reject(reason string) {
+	if handler.onReject != nil {
+		handler.onReject(reason)
+	}
+}
+
+// Start 启动服务，监听失败或证书错误时返回错误，启动后的错误写入FailChan
+func (server *WSServer) Start() error {
 	log.Println("Websocket server starting...")
 	log.Println("Websocket address [" + server.Addr + "]")
-	ln, err := net.Listen("tcp", server.Addr)
-	if err != nil {
-		panic(err)
+	ln := server.Listener
+	if ln == nil {
+		var err error
+		if ln, err = Listen(server.Addr); err != nil {
+			return err
+		}
 	}
+	server.Logger = defaultLogger(server.Logger)
 	if server.MaxConnNum <= 0 {
 		server.MaxConnNum = 100
 		log.Printf("Invalid MaxConnNum, reset to %v\n", server.MaxConnNum)
@@ -121,22 +186,40 @@ func (server *WSServer) Start() {
 		log.Printf("Invalid HTTPTimeout, reset to %v\n", server.HTTPTimeout)
 	}
 
-	if server.CerFile != "" || server.KeyFile != "" {
+	// PROXY头在TLS握手之前
+	if server.ProxyProtocol {
+		ln = &ProxyListener{
+			Listener:      ln,
+			Trusted:       server.TrustedProxies,
+			HeaderTimeout: server.ProxyHeaderTimeout,
+		}
+	}
+
+	if server.TLSEnabled() {
 		config := &tls.Config{}
 		config.NextProtos = []string{"http/1.1"}
 
-		var err error
-		config.Certificates = make([]tls.Certificate, 1)
-		config.Certificates[0], err = tls.LoadX509KeyPair(server.CerFile, server.KeyFile)
+		cert, err := tls.LoadX509KeyPair(server.CerFile, server.KeyFile)
 		if err != nil {
-			log.Fatal("Run TLS server failed, " + err.Error())
+			_ = ln.Close()
+			return err
+		}
+		server.SetCertificate(&cert)
+		// 每次握手时获取证书，SetCertificate后新连接使用新证书
+		config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return server.certificate.Load().(*tls.Certificate), nil
 		}
 		ln = tls.NewListener(ln, config)
 	}
 
+	if server.IPFilter == nil {
+		server.IPFilter, _ = NewIPFilter(IPFilterOption{})
+	}
+
 	server.ln = ln
 	server.handler = &WSHandler{
 		ctx:         server.Ctx,
+		logger:      server.Logger,
 		maxConnNum:  server.MaxConnNum,
 		writeMsgCap: server.WriteMsgCap,
 		upgrader: websocket.Upgrader{
@@ -147,6 +230,12 @@ func (server *WSServer) Start() {
 		},
 		conns:    make(WSConnPool),
 		newAgent: server.NewAgent,
+		ipFilter: server.IPFilter,
+		handler:  server.Handler,
+		onReject: server.OnReject,
+
+		forwardedHeader: server.ForwardedHeader,
+		trustedProxies:  server.TrustedProxies,
 	}
 	server.HTTPServer = &http.Server{
 		Addr:           server.Addr,
@@ -162,18 +251,72 @@ func (server *WSServer) Start() {
 	//}
 
 	// 另外启一个进程是因为增加信号处理
+	// 主动Shutdown时返回http.ErrServerClosed，不属于启动失败
 	go func(failChan chan error) {
-		if err := server.HTTPServer.Serve(ln); err != nil {
+		if err := server.HTTPServer.Serve(ln); err != nil && err != http.ErrServerClosed {
 			failChan <- err
 		}
 	}(server.FailChan)
+	return nil
+}
+
+// LocalAddr 实际监听地址，Addr端口为0时可获取分配的端口
+func (server *WSServer) LocalAddr() net.Addr {
+	return server.ln.Addr()
+}
+
+// TLSEnabled 是否开启TLS
+func (server *WSServer) TLSEnabled() bool {
+	return server.CerFile != "" || server.KeyFile != ""
+}
+
+// SetCertificate 替换证书，只对新连接生效
+func (server *WSServer) SetCertificate(cert *tls.Certificate) {
+	server.certificate.Store(cert)
+}
+
+// SetLimits 修改最大连接数和写channel缓冲，只对新连接生效，<=0时不修改
+func (server *WSServer) SetLimits(maxConnNum, writeMsgCap int) {
+	server.handler.mutex.Lock()
+	defer server.handler.mutex.Unlock()
+	if maxConnNum > 0 {
+		server.handler.maxConnNum = maxConnNum
+	}
+	if writeMsgCap > 0 {
+		server.handler.writeMsgCap = writeMsgCap
+	}
+}
+
+// StopAccept 停止接收新连接，已升级的websocket连接不受影响
+func (server *WSServer) StopAccept(ctx context.Context) error {
+	return server.HTTPServer.Shutdown(ctx)
+}
+
+// RejectUpgrade 拒绝新的websocket握手并返回503，挂在websocket服务上的健康检查等http请求照常处理
+// 用于排空期间保持/readyz可访问，Close时关闭监听
+func (server *WSServer) RejectUpgrade() {
+	atomic.StoreInt32(&server.handler.rejectWS, 1)
+}
+
+// Conns 当前所有连接
+func (server *WSServer) Conns() []*WSConn {
+	server.handler.mutex.Lock()
+	defer server.handler.mutex.Unlock()
+	var conns = make([]*WSConn, 0, len(server.handler.conns))
+	for wsConn := range server.handler.conns {
+		conns = append(conns, wsConn)
+	}
+	return conns
 }
 
 // Close 关闭服务
 func (server *WSServer) Close() {
+	// 关闭监听和未升级的http连接
+	_ = server.HTTPServer.Close()
 	server.ln.Close()
-	for wsConn := range server.handler.conns {
-		wsConn.Close()
+	// 连接关闭时会加锁从连接池删除，需要先复制一份
+	for _, wsConn := range server.Conns() {
+		wsConn.CloseWithReason(CLOSE_SERVER_SHUTDOWN, nil)
 	}
 	server.handler.mutex.Lock()
 	server.handler.conns = nil
@@ -6,7 +6,9 @@ package processer
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"sort"
 )
 
 // JSONProcesser json解析器
@@ -14,7 +16,10 @@ type JSONProcesser struct {
 	RequestIDField string
 	ActionField    string
 	BodyField      string
+	TraceField     string // 可选的追踪上下文字段，为空时不解析
 	router         map[string]func(string, []byte, interface{})
+	public         map[string]bool
+	middlewares    []Middleware
 }
 
 // NewJSONProcesser 初始化processer
@@ -23,46 +28,76 @@ func NewJSONProcesser(requestIDField, actionField, bodyField string) *JSONProces
 		RequestIDField: requestIDField,
 		ActionField:    actionField,
 		BodyField:      bodyField,
+		TraceField:     "traceparent",
 		router:         make(map[string]func(string, []byte, interface{})),
+		public:         make(map[string]bool),
 	}
 }
 
 // Unmarshal 解析接收数据
 func (j *JSONProcesser) Unmarshal(data []byte) (Processer, error) {
 	var (
-		m map[string]string
+		m map[string]json.RawMessage
 		p Processer
 	)
 	if err := json.Unmarshal(data, &m); err != nil {
 		return p, err
 	}
-	reqeustID, ok := m[j.RequestIDField]
-	if !ok {
+	raw, ok := m[j.RequestIDField]
+	if !ok || json.Unmarshal(raw, &p.RequestID) != nil {
 		return p, errors.New("ReqeustIdField cannot parse")
 	}
-	p.RequestID = reqeustID
-	action, ok := m[j.ActionField]
-	if !ok {
+	raw, ok = m[j.ActionField]
+	if !ok || json.Unmarshal(raw, &p.Action) != nil {
 		return p, errors.New("ActionField cannot parse")
 	}
-	p.Action = action
 	p.Body = make([]byte, 0)
-	body, ok := m[j.BodyField]
+	raw, ok = m[j.BodyField]
 	// 这样写是因为端上发送心跳时，没有body字段
 	if ok {
-		p.Body = []byte(body)
+		p.Body = rawBody(raw)
+	}
+	// 追踪上下文格式错误时忽略，不影响请求
+	if raw, ok = m[j.TraceField]; ok && j.TraceField != "" {
+		_ = json.Unmarshal(raw, &p.Trace)
 	}
 	return p, nil
 }
 
-// Route 路由
+// rawBody body为字符串时返回字符串内容，否则原样返回json
+func rawBody(raw json.RawMessage) []byte {
+	var s string
+	if len(raw) > 0 && raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return []byte(s)
+	}
+	return []byte(raw)
+}
+
+// Route 路由，依次执行中间件和业务handler
 func (j *JSONProcesser) Route(p Processer, agent interface{}) error {
 	handle, ok := j.router[p.Action]
 	if !ok {
-		return errors.New("route not register, requestId=" + p.RequestID + ", action=" + p.Action)
+		return fmt.Errorf("%w, requestId=%s, action=%s", ErrRouteNotFound, p.RequestID, p.Action)
 	}
-	handle(p.RequestID, p.Body, agent)
-	return nil
+	var next HandlerFunc = func(p Processer, agent interface{}) error {
+		handle(p.RequestID, p.Body, agent)
+		return nil
+	}
+	for i := len(j.middlewares) - 1; i >= 0; i-- {
+		next = j.middlewares[i](next)
+	}
+	return next(p, agent)
+}
+
+// HasRoute action是否已注册路由
+func (j *JSONProcesser) HasRoute(action string) bool {
+	_, ok := j.router[action]
+	return ok
+}
+
+// Use 注册中间件，按注册顺序执行，需在服务启动前注册
+func (j *JSONProcesser) Use(middlewares ...Middleware) {
+	j.middlewares = append(j.middlewares, middlewares...)
 }
 
 // RegisterRouter 注册路由
@@ -73,3 +108,34 @@ func (j *JSONProcesser) RegisterRouter(action string, handler func(string, []byt
 	}
 	j.router[action] = handler
 }
+
+// RegisterPublicRouter 注册无需鉴权即可调用的路由
+func (j *JSONProcesser) RegisterPublicRouter(action string, handler func(string, []byte, interface{})) {
+	j.RegisterRouter(action, handler)
+	j.MarkPublic(action)
+}
+
+// MarkPublic 标记action无需鉴权
+func (j *JSONProcesser) MarkPublic(actions ...string) {
+	if j.public == nil {
+		j.public = make(map[string]bool)
+	}
+	for _, action := range actions {
+		j.public[action] = true
+	}
+}
+
+// IsPublic action是否无需鉴权
+func (j *JSONProcesser) IsPublic(action string) bool {
+	return j.public[action]
+}
+
+// Actions 已注册的action，按名称排序
+func (j *JSONProcesser) Actions() []string {
+	var actions = make([]string, 0, len(j.router))
+	for action := range j.router {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
@@ -4,6 +4,7 @@
 package processer
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -13,6 +14,7 @@ func TestJSONProcesser_Unmarshal(t *testing.T) {
 		RequestIDField string
 		ActionField    string
 		BodyField      string
+		TraceField     string
 		router         map[string]func(string, []byte, interface{})
 	}
 	type args struct {
@@ -65,6 +67,28 @@ func TestJSONProcesser_Unmarshal(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "test-trace",
+			fields: fields{
+				RequestIDField: "requestId",
+				ActionField:    "action",
+				BodyField:      "body",
+				TraceField:     "traceparent",
+				router:         nil,
+			},
+			args: args{data: []byte(`{
+					"requestId": "request_id",
+					"action": "GET",
+					"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+			}`)},
+			want: Processer{
+				RequestID: "request_id",
+				Action:    "GET",
+				Body:      []byte{},
+				Trace:     "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -72,6 +96,7 @@ func TestJSONProcesser_Unmarshal(t *testing.T) {
 				RequestIDField: tt.fields.RequestIDField,
 				ActionField:    tt.fields.ActionField,
 				BodyField:      tt.fields.BodyField,
+				TraceField:     tt.fields.TraceField,
 				router:         tt.fields.router,
 			}
 			got, err := j.Unmarshal(tt.args.data)
@@ -180,3 +205,41 @@ func TestJSONProcesser_RegisterRouter(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONProcesser_Use(t *testing.T) {
+	var errDenied = errors.New("denied")
+	tests := []struct {
+		name    string
+		action  string
+		wantErr error
+		wantRun bool
+	}{
+		{name: "public", action: "AUTH", wantRun: true},
+		{name: "private", action: "GET", wantErr: errDenied},
+		{name: "not-found", action: "PUT", wantErr: ErrRouteNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var run bool
+			handler := func(string, []byte, interface{}) { run = true }
+			j := NewJSONProcesser("requestId", "action", "body")
+			j.RegisterPublicRouter("AUTH", handler)
+			j.RegisterRouter("GET", handler)
+			j.Use(func(next HandlerFunc) HandlerFunc {
+				return func(p Processer, agent interface{}) error {
+					if !j.IsPublic(p.Action) {
+						return errDenied
+					}
+					return next(p, agent)
+				}
+			})
+			err := j.Route(Processer{RequestID: "r", Action: tt.action}, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Route() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if run != tt.wantRun {
+				t.Errorf("Route() run = %v, wantRun %v", run, tt.wantRun)
+			}
+		})
+	}
+}
@@ -3,16 +3,42 @@
 
 package processer
 
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrRouteNotFound   = errors.New("route not register")
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+	ErrThrottled       = errors.New("throttled")
+)
+
 // ProcesserOpt 处理器接口
 type ProcesserOpt interface {
 	Unmarshal([]byte) (Processer, error)
 	Route(Processer, interface{}) error
+	HasRoute(string) bool
 	RegisterRouter(string, func(string, []byte, interface{}))
+	RegisterPublicRouter(string, func(string, []byte, interface{}))
+	MarkPublic(...string)
+	IsPublic(string) bool
+	Actions() []string
+	Use(...Middleware)
 }
 
+// HandlerFunc 路由处理函数，返回错误时由网关下发对应错误码
+type HandlerFunc func(p Processer, agent interface{}) error
+
+// Middleware 路由中间件，在业务handler之前执行，可以拦截请求
+type Middleware func(next HandlerFunc) HandlerFunc
+
 // Processer 处理器对象
 type Processer struct {
 	RequestID string
 	Action    string
 	Body      []byte
+	Trace     string          // 可选的W3C traceparent，端上或上游传入的追踪上下文
+	Ctx       context.Context // 请求上下文，网关分发时携带sessionId、requestId等日志字段和追踪span
 }
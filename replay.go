@@ -0,0 +1,70 @@
+// Author: Vcentor
+// Date: 2026/10/26 5:30 下午
+// desc: replay命令，把抓包文件回放到运行中的服务或进程内启动的网关，并比较响应
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"socketserver/env"
+	"socketserver/library/capture"
+	"socketserver/network"
+	"strings"
+	"time"
+)
+
+// replayFlags replay命令参数
+type replayFlags struct {
+	ws     string
+	tcp    string
+	speed  float64
+	wait   time.Duration
+	ignore string
+	dial   dialFlags
+}
+
+// register 注册replay命令参数
+func (f *replayFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.ws, "ws", "", "replay: websocket地址,如ws://127.0.0.1:8989"+network.WS_PATH+",与-tcp都为空时在进程内启动网关")
+	fs.StringVar(&f.tcp, "tcp", "", "replay: tcp地址,如127.0.0.1:8990,消息格式取自server.toml")
+	fs.Float64Var(&f.speed, "speed", 1, "replay: 回放速度,1为按原始时间间隔发送,0为不等待")
+	fs.DurationVar(&f.wait, "wait", capture.DEFAULT_REPLAY_WAIT, "replay: 发送完成后等待响应的最长时间")
+	fs.StringVar(&f.ignore, "ignore", "", "replay: 比较json响应时忽略的字段,逗号分隔的点分路径,如requestId,body.timestamp")
+	f.dial.register(fs, "replay")
+}
+
+// replay 回放抓包文件，有差异时返回错误
+func replay(ctx context.Context, paths env.Paths, f replayFlags, file string) error {
+	records, err := capture.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	opt := capture.ReplayOption{
+		Speed: f.speed,
+		Wait:  f.wait,
+	}
+	if f.ignore != "" {
+		opt.Ignore = strings.Split(f.ignore, ",")
+	}
+
+	t, err := resolveTarget(ctx, paths, f.ws, f.tcp)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+	dial, err := t.dialOption("", f.dial)
+	if err != nil {
+		return err
+	}
+	opt.WS, opt.TCP = dial.WS, dial.TCP
+
+	result := capture.Replay(ctx, records, opt)
+	result.Report(os.Stdout)
+	if !result.OK() {
+		return errors.New("replay found differences")
+	}
+	return nil
+}
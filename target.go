@@ -0,0 +1,126 @@
+// Author: Vcentor
+// Date: 2026/10/27 11:00 上午
+// desc: replay、bench和client命令的目标服务，未指定地址时在进程内启动网关
+// 连接远程服务时支持wss、tcp over TLS和握手鉴权
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"socketserver/bootstrap"
+	"socketserver/env"
+	"socketserver/gate"
+	"socketserver/network"
+)
+
+// target 目标服务地址
+type target struct {
+	ws      string             // websocket地址，含连接路径
+	tcp     string             // tcp地址
+	framing gate.TPCConfOption // tcp消息格式，取自server.toml
+	close   func()
+}
+
+// parser tcp消息解析器
+func (t *target) parser() *network.TCPParser {
+	return t.framing.Parser()
+}
+
+// dialOption 连接目标服务的选项
+func (t *target) dialOption(transport string, f dialFlags) (network.DialOption, error) {
+	tlsConf, err := f.tlsConfig()
+	if err != nil {
+		return network.DialOption{}, err
+	}
+	opt := network.DialOption{
+		Transport: transport,
+		WS:        network.WSDialOption{Addr: t.ws, Token: f.token, TLSConfig: tlsConf},
+		TCP:       network.TCPClientOption{Addr: t.tcp, Parser: t.parser()},
+	}
+	if f.tls {
+		if tlsConf == nil {
+			tlsConf = new(tls.Config)
+		}
+		opt.TCP.TLSConfig = tlsConf
+	}
+	return opt, nil
+}
+
+// dialFlags 连接远程服务的鉴权和TLS参数，replay、bench和client命令共用
+type dialFlags struct {
+	token    string
+	tls      bool
+	caFile   string
+	insecure bool
+}
+
+// register 注册连接参数，cmd为命令名
+func (f *dialFlags) register(fs *flag.FlagSet, cmd string) {
+	fs.StringVar(&f.token, "token", "", cmd+": websocket握手鉴权凭证,以Authorization: Bearer请求头发送,tcp需要发送鉴权请求")
+	fs.BoolVar(&f.tls, "tls", false, cmd+": tcp连接使用TLS,websocket按地址是否为wss判断")
+	fs.StringVar(&f.caFile, "ca-file", "", cmd+": 校验服务端证书的CA文件,为空时使用系统证书")
+	fs.BoolVar(&f.insecure, "insecure", false, cmd+": 不校验服务端证书,只用于测试")
+}
+
+// tlsConfig 按参数生成TLS配置，都为默认值时返回nil
+func (f dialFlags) tlsConfig() (*tls.Config, error) {
+	if f.caFile == "" && !f.insecure {
+		return nil, nil
+	}
+	conf := &tls.Config{InsecureSkipVerify: f.insecure}
+	if f.caFile != "" {
+		pem, err := ioutil.ReadFile(f.caFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in " + f.caFile)
+		}
+	}
+	return conf, nil
+}
+
+// resolveTarget 地址都为空时按server.toml在进程内启动网关，只监听本机随机端口
+// 指定地址时tcp消息格式取自本地server.toml，读取失败时使用默认格式
+func resolveTarget(ctx context.Context, paths env.Paths, ws, tcp string) (*target, error) {
+	if ws != "" || tcp != "" {
+		env.Setup(paths)
+		var conf *gate.Config
+		file, err := env.ServerConfFile()
+		if err == nil {
+			conf, err = gate.LoadConfig(file)
+		}
+		if err != nil {
+			if conf, err = gate.NewConfig(); err != nil {
+				return nil, err
+			}
+		}
+		return &target{ws: ws, tcp: tcp, framing: conf.TCPConf, close: func() {}}, nil
+	}
+
+	b, err := bootstrap.NewBootstrap(ctx, paths).InitLocal()
+	if err != nil {
+		return nil, err
+	}
+	g := b.Gate()
+	if err := g.Start(ctx); err != nil {
+		return nil, err
+	}
+	t := &target{
+		framing: g.TCPConf,
+		close:   func() { _ = g.Shutdown(context.Background()) },
+	}
+	if addr := g.WSAddr(); addr != nil {
+		t.ws = "ws://" + addr.String() + network.WS_PATH
+	}
+	if addr := g.TCPAddr(); addr != nil {
+		t.tcp = addr.String()
+	}
+	return t, nil
+}